@@ -0,0 +1,408 @@
+package cli
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"lanmanvan/core"
+)
+
+// builtinFunc computes a builtin's result. Piped input arrives as the last argument.
+type builtinFunc func(cli *CLI, args []string) (string, error)
+
+// builtin is a Go-native function usable as $(name args) or name(args) in pipes
+type builtin struct {
+	name        string
+	usage       string
+	category    string
+	description string
+	fn          builtinFunc
+}
+
+// builtins is the registry of builtin functions by name
+var builtins = make(map[string]*builtin)
+
+// registerBuiltin adds a builtin to the registry
+func registerBuiltin(b *builtin) {
+	builtins[b.name] = b
+}
+
+// lookupBuiltin returns the builtin called name, or nil
+func lookupBuiltin(name string) *builtin {
+	return builtins[name]
+}
+
+func init() {
+	// Hashing
+	for _, h := range []struct {
+		name string
+		sum  func([]byte) string
+	}{
+		{"md5", func(b []byte) string { s := md5.Sum(b); return hex.EncodeToString(s[:]) }},
+		{"sha1", func(b []byte) string { s := sha1.Sum(b); return hex.EncodeToString(s[:]) }},
+		{"sha256", func(b []byte) string { s := sha256.Sum256(b); return hex.EncodeToString(s[:]) }},
+		{"sha512", func(b []byte) string { s := sha512.Sum512(b); return hex.EncodeToString(s[:]) }},
+	} {
+		sum := h.sum
+		registerBuiltin(&builtin{name: h.name, usage: h.name + " <text>", category: "Hashing",
+			description: "Hex " + strings.ToUpper(h.name) + " digest of the text",
+			fn:          func(cli *CLI, args []string) (string, error) { return sum([]byte(joinArgs(args))), nil }})
+	}
+
+	// Encoding
+	registerBuiltin(&builtin{name: "base64", usage: "base64 <text>", category: "Encoding", description: "Base64-encode the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(joinArgs(args))), nil
+		}})
+	registerBuiltin(&builtin{name: "base64d", usage: "base64d <text>", category: "Encoding", description: "Base64-decode the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			text := strings.TrimSpace(joinArgs(args))
+			data, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				if data, err = base64.RawStdEncoding.DecodeString(text); err != nil {
+					return "", fmt.Errorf("invalid base64: %v", err)
+				}
+			}
+			return string(data), nil
+		}})
+	registerBuiltin(&builtin{name: "hex", usage: "hex <text>", category: "Encoding", description: "Hex-encode the text",
+		fn: func(cli *CLI, args []string) (string, error) { return hex.EncodeToString([]byte(joinArgs(args))), nil }})
+	registerBuiltin(&builtin{name: "hexd", usage: "hexd <hex>", category: "Encoding", description: "Hex-decode the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			data, err := hex.DecodeString(strings.TrimSpace(joinArgs(args)))
+			if err != nil {
+				return "", fmt.Errorf("invalid hex: %v", err)
+			}
+			return string(data), nil
+		}})
+	registerBuiltin(&builtin{name: "url", usage: "url <text>", category: "Encoding", description: "URL-encode the text (query escaping)",
+		fn: func(cli *CLI, args []string) (string, error) { return url.QueryEscape(joinArgs(args)), nil }})
+	registerBuiltin(&builtin{name: "urld", usage: "urld <text>", category: "Encoding", description: "URL-decode the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			s, err := url.QueryUnescape(joinArgs(args))
+			if err != nil {
+				return "", fmt.Errorf("invalid URL encoding: %v", err)
+			}
+			return s, nil
+		}})
+	registerBuiltin(&builtin{name: "html", usage: "html <text>", category: "Encoding", description: "Escape <, >, &, ' and \" as HTML entities",
+		fn: func(cli *CLI, args []string) (string, error) { return html.EscapeString(joinArgs(args)), nil }})
+	registerBuiltin(&builtin{name: "htmld", usage: "htmld <text>", category: "Encoding", description: "Unescape HTML entities",
+		fn: func(cli *CLI, args []string) (string, error) { return html.UnescapeString(joinArgs(args)), nil }})
+
+	// Text
+	registerBuiltin(&builtin{name: "upper", usage: "upper <text>", category: "Text", description: "Upper-case the text",
+		fn: func(cli *CLI, args []string) (string, error) { return strings.ToUpper(joinArgs(args)), nil }})
+	registerBuiltin(&builtin{name: "lower", usage: "lower <text>", category: "Text", description: "Lower-case the text",
+		fn: func(cli *CLI, args []string) (string, error) { return strings.ToLower(joinArgs(args)), nil }})
+	registerBuiltin(&builtin{name: "rev", usage: "rev <text>", category: "Text", description: "Reverse the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			r := []rune(joinArgs(args))
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			return string(r), nil
+		}})
+	registerBuiltin(&builtin{name: "len", usage: "len <text>", category: "Text", description: "Number of characters in the text",
+		fn: func(cli *CLI, args []string) (string, error) {
+			return strconv.Itoa(utf8.RuneCountInString(joinArgs(args))), nil
+		}})
+	registerBuiltin(&builtin{name: "split", usage: "split <sep> <text>", category: "Text", description: "Split the text on sep, one part per line",
+		fn: func(cli *CLI, args []string) (string, error) {
+			if len(args) < 2 {
+				return "", fmt.Errorf("usage: split <sep> <text>")
+			}
+			return strings.Join(strings.Split(joinArgs(args[1:]), args[0]), "\n"), nil
+		}})
+	registerBuiltin(&builtin{name: "join", usage: "join <sep> <text>", category: "Text", description: "Join the lines of the text with sep",
+		fn: func(cli *CLI, args []string) (string, error) {
+			if len(args) < 2 {
+				return "", fmt.Errorf("usage: join <sep> <text>")
+			}
+			return strings.Join(splitLines(joinArgs(args[1:])), args[0]), nil
+		}})
+
+	// Math
+	registerBuiltin(&builtin{name: "calc", usage: "calc <a> <+|-|*|/|%> <b>", category: "Math",
+		description: "Integer arithmetic, e.g. i=$(calc $i + 1) in a while loop",
+		fn:          builtinCalc})
+
+	// System
+	registerBuiltin(&builtin{name: "timestamp", usage: "timestamp [unix|unixms|iso|date|time|<layout>]", category: "System",
+		description: "Current time, RFC 3339 by default or a Go time layout",
+		fn: func(cli *CLI, args []string) (string, error) {
+			now := time.Now()
+			format := "iso"
+			if len(args) > 0 {
+				format = joinArgs(args)
+			}
+			switch format {
+			case "unix":
+				return strconv.FormatInt(now.Unix(), 10), nil
+			case "unixms":
+				return strconv.FormatInt(now.UnixMilli(), 10), nil
+			case "iso", "rfc3339":
+				return now.Format(time.RFC3339), nil
+			case "date":
+				return now.Format(time.DateOnly), nil
+			case "time":
+				return now.Format(time.TimeOnly), nil
+			}
+			return now.Format(format), nil
+		}})
+	registerBuiltin(&builtin{name: "ipaddr", usage: "ipaddr [interface]", category: "System",
+		description: "First non-loopback IPv4 address, of the given interface if any",
+		fn:          func(cli *CLI, args []string) (string, error) { return localIPv4(joinArgs(args)) }})
+	registerBuiltin(&builtin{name: "hostname", usage: "hostname", category: "System", description: "This machine's host name",
+		fn: func(cli *CLI, args []string) (string, error) { return os.Hostname() }})
+	registerBuiltin(&builtin{name: "whoami", usage: "whoami", category: "System", description: "The current user name",
+		fn: func(cli *CLI, args []string) (string, error) {
+			u, err := user.Current()
+			if err != nil {
+				return "", err
+			}
+			return u.Username, nil
+		}})
+	registerBuiltin(&builtin{name: "pwd", usage: "pwd", category: "System", description: "The shell's working directory",
+		fn: func(cli *CLI, args []string) (string, error) { return cli.currentDirectory, nil }})
+	registerBuiltin(&builtin{name: "cat", usage: "cat <file>", category: "System", description: "Contents of a file, without the trailing newline",
+		fn: func(cli *CLI, args []string) (string, error) {
+			if len(args) == 0 {
+				return "", fmt.Errorf("usage: cat <file>")
+			}
+			path := args[0]
+			if strings.HasPrefix(path, "~/") {
+				if home, err := os.UserHomeDir(); err == nil {
+					path = filepath.Join(home, path[2:])
+				}
+			} else if !filepath.IsAbs(path) {
+				path = filepath.Join(cli.currentDirectory, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}})
+
+	// Random
+	registerBuiltin(&builtin{name: "random", usage: "random [length] | random <min> <max>", category: "Random",
+		description: "Random alphanumeric string (16 chars by default) or integer in [min, max]",
+		fn:          builtinRandom})
+	registerBuiltin(&builtin{name: "uuid", usage: "uuid", category: "Random", description: "Random version 4 UUID",
+		fn: func(cli *CLI, args []string) (string, error) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+		}})
+}
+
+// joinArgs joins builtin arguments back into one text
+func joinArgs(args []string) string {
+	return strings.Join(args, " ")
+}
+
+// localIPv4 returns the first non-loopback IPv4 address, optionally of one interface
+func localIPv4(iface string) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, ifc := range ifaces {
+		if iface != "" && ifc.Name != iface {
+			continue
+		}
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 && iface == "" {
+			continue
+		}
+		addrs, err := ifc.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				return ipnet.IP.String(), nil
+			}
+		}
+	}
+	if iface != "" {
+		return "", fmt.Errorf("no IPv4 address on interface '%s'", iface)
+	}
+	return "", fmt.Errorf("no non-loopback IPv4 address found")
+}
+
+// calcPattern matches an integer expression: a operator b
+var calcPattern = regexp.MustCompile(`^\s*(-?\d+)\s*([-+*/%])\s*(-?\d+)\s*$`)
+
+// builtinCalc evaluates one integer operation
+func builtinCalc(cli *CLI, args []string) (string, error) {
+	m := calcPattern.FindStringSubmatch(joinArgs(args))
+	if m == nil {
+		return "", fmt.Errorf("usage: calc <a> <+|-|*|/|%%> <b> with integers")
+	}
+	a, _ := strconv.ParseInt(m[1], 10, 64)
+	b, _ := strconv.ParseInt(m[3], 10, 64)
+	switch m[2] {
+	case "+":
+		return strconv.FormatInt(a+b, 10), nil
+	case "-":
+		return strconv.FormatInt(a-b, 10), nil
+	case "*":
+		return strconv.FormatInt(a*b, 10), nil
+	}
+	if b == 0 {
+		return "", fmt.Errorf("division by zero")
+	}
+	if m[2] == "/" {
+		return strconv.FormatInt(a/b, 10), nil
+	}
+	return strconv.FormatInt(a%b, 10), nil
+}
+
+// builtinRandom returns a random string, or an integer when given a range
+func builtinRandom(cli *CLI, args []string) (string, error) {
+	if len(args) == 2 {
+		lo, err1 := strconv.ParseInt(args[0], 10, 64)
+		hi, err2 := strconv.ParseInt(args[1], 10, 64)
+		if err1 != nil || err2 != nil || lo > hi {
+			return "", fmt.Errorf("usage: random <min> <max> with min <= max")
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(hi-lo+1))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(lo+n.Int64(), 10), nil
+	}
+
+	length := 16
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > 4096 {
+			return "", fmt.Errorf("usage: random [length] with length 1-4096")
+		}
+		length = n
+	}
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	out := make([]byte, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		out[i] = alphabet[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// evalBuiltin runs the expression inside $(...): a builtin name followed by its arguments
+func (cli *CLI) evalBuiltin(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	i := 0
+	name := cli.collectIdentifier(expr, &i)
+	b := lookupBuiltin(name)
+	if b == nil {
+		return "", fmt.Errorf("unknown builtin '%s' (see 'builtins')", name)
+	}
+	args, err := cli.parseAdvancedArguments(expr[i:], false)
+	if err != nil {
+		return "", err
+	}
+	result, err := b.fn(cli, args)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return result, nil
+}
+
+// builtinCallName returns the builtin name of a $(...) expression starting at s[i],
+// or "" when it isn't a call to a registered builtin (e.g. a $(var->field) reference)
+func (cli *CLI) builtinCallName(s string, i int) string {
+	if !strings.HasPrefix(s[i:], "$(") {
+		return ""
+	}
+	j := i + 2
+	for j < len(s) && s[j] == ' ' {
+		j++
+	}
+	name := cli.collectIdentifier(s, &j)
+	if lookupBuiltin(name) == nil || (j < len(s) && s[j] != ' ' && s[j] != ')') {
+		return ""
+	}
+	return name
+}
+
+// expandBuiltins replaces every $(builtin args) in s with its result. Variables in the
+// rest of s are expanded too, but never inside a builtin's result.
+func (cli *CLI) expandBuiltins(s string) (string, error) {
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if cli.builtinCallName(s, i) == "" {
+			continue
+		}
+		end := cli.findMatchingParen(s, i+2)
+		if end < 0 {
+			return "", fmt.Errorf("unclosed $( in %q", s)
+		}
+		result, err := cli.evalBuiltin(s[i+2 : end])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(cli.expandVariables(s[last:i]))
+		out.WriteString(result)
+		last = end + 1
+		i = end
+	}
+	out.WriteString(cli.expandVariables(s[last:]))
+	return out.String(), nil
+}
+
+// ListBuiltins prints the builtin functions by category
+func (cli *CLI) ListBuiltins() {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := builtins[names[i]], builtins[names[j]]
+		if a.category != b.category {
+			return a.category < b.category
+		}
+		return a.name < b.name
+	})
+
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Builtins (%d)", len(names))))
+	table := core.NewTable([]string{"Category", "Usage", "Description"})
+	for _, name := range names {
+		b := builtins[name]
+		table.AddRow(b.category, b.usage, b.description)
+	}
+	fmt.Fprint(cli.out(), table.Render())
+	fmt.Fprintln(cli.out(), core.NmapSubBox("Use as $(name args) in arguments, e.g. hash=$(sha256 $(cat key.txt)),"))
+	fmt.Fprintln(cli.out(), core.NmapSubBox("or as name(args) in pipes, e.g. whoami() |> upper() |> base64()"))
+	fmt.Fprintln(cli.out())
+}
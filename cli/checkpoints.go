@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// resumeState is a checkpoint being resumed, picked up by the next loop or sharded run
+type resumeState struct {
+	cp          *core.Checkpoint
+	retryFailed bool
+}
+
+// openCheckpoint returns the checkpoint a loop or sharded run records into and the
+// item indexes it should skip: the checkpoint being resumed, or a new one made from
+// header. cp is nil when no checkpoint could be written; the run goes ahead without.
+func (cli *CLI) openCheckpoint(header *core.Checkpoint) (cp *core.Checkpoint, skip map[int]bool) {
+	if r := cli.resuming; r != nil {
+		cli.resuming = nil
+		if err := r.cp.Reopen(); err != nil {
+			cli.printWarning(fmt.Sprintf("Could not reopen checkpoint %s: %v", r.cp.ID, err))
+			return nil, r.cp.Skip(r.retryFailed)
+		}
+		return r.cp, r.cp.Skip(r.retryFailed)
+	}
+
+	cp, err := core.NewCheckpoint(header)
+	if err != nil {
+		cli.printWarning(fmt.Sprintf("Could not create checkpoint: %v", err))
+		return nil, nil
+	}
+	return cp, nil
+}
+
+// recordCheckpoint notes a finished loop iteration
+func recordCheckpoint(cp *core.Checkpoint, it loopIteration, exitCode int) {
+	if cp != nil {
+		cp.Record(it.index, it.label, exitCode)
+	}
+}
+
+// closeCheckpoint closes cp and, when items are left or failed, tells how to resume it
+func closeCheckpoint(cp *core.Checkpoint, out io.Writer) {
+	if cp == nil {
+		return
+	}
+	kept, err := cp.Close()
+	if err != nil {
+		fmt.Fprintf(out, "%s Checkpoint %s: %v\n", core.Color("yellow", "[!]"), cp.ID, err)
+	}
+	if !kept {
+		return
+	}
+
+	info := core.Color("yellow", "[*]")
+	secrets := ""
+	for _, name := range cp.Omitted {
+		secrets += " " + name + "=<value>"
+	}
+	if done := cp.Done(); done < cp.Total {
+		fmt.Fprintf(out, "%s Checkpoint %s saved (%d/%d done), continue with: resume %s%s\n", info, cp.ID, done, cp.Total, cp.ID, secrets)
+	} else if failed := len(cp.Failed()); failed > 0 {
+		fmt.Fprintf(out, "%s Checkpoint %s saved, retry the %d failed item(s) with: resume %s --failed%s\n", info, cp.ID, failed, cp.ID, secrets)
+	}
+}
+
+// skipFinished drops iterations a resumed loop already finished and returns what is left
+func skipFinished(next func() (loopIteration, bool), skip map[int]bool, total int) (func() (loopIteration, bool), int) {
+	if len(skip) == 0 {
+		return next, total
+	}
+	left := total
+	for index := range skip {
+		if index >= 1 && index <= total {
+			left--
+		}
+	}
+	return func() (loopIteration, bool) {
+		for {
+			it, ok := next()
+			if !ok || !skip[it.index] {
+				return it, ok
+			}
+		}
+	}, left
+}
+
+// HandleCheckpoints lists checkpoints or deletes them
+func (cli *CLI) HandleCheckpoints(args []string) {
+	if len(args) == 0 {
+		cli.ListCheckpoints()
+		return
+	}
+
+	usage := "Usage: checkpoints [-d <id>|all]"
+	if len(args) != 2 || (args[0] != "-d" && args[0] != "--delete") {
+		cli.printError(usage)
+		return
+	}
+
+	if args[1] != "all" {
+		if err := core.DeleteCheckpoint(args[1]); err != nil {
+			cli.printError(err.Error())
+			return
+		}
+		cli.printSuccess(fmt.Sprintf("Checkpoint %s deleted", args[1]))
+		return
+	}
+
+	checkpoints, err := core.ListCheckpoints()
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+	for _, cp := range checkpoints {
+		if err := core.DeleteCheckpoint(cp.ID); err != nil {
+			cli.printError(err.Error())
+		}
+	}
+	cli.printSuccess(fmt.Sprintf("Deleted %d checkpoint(s)", len(checkpoints)))
+}
+
+// ListCheckpoints prints the saved checkpoints with their progress
+func (cli *CLI) ListCheckpoints() {
+	checkpoints, err := core.ListCheckpoints()
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Checkpoints (%d)", len(checkpoints))))
+	if len(checkpoints) == 0 {
+		fmt.Fprintln(cli.out(), core.NmapSubBox("No checkpoints, interrupted loops and threads= runs leave one behind"))
+		fmt.Fprintln(cli.out())
+		return
+	}
+
+	table := core.NewTable([]string{"ID", "Kind", "Progress", "Failed", "Updated", "Command"})
+	for _, cp := range checkpoints {
+		done := cp.Done()
+		table.AddRow(
+			cp.ID,
+			cp.Kind,
+			fmt.Sprintf("%s %d/%d", core.ProgressBar(done, cp.Total, 10), done, cp.Total),
+			fmt.Sprint(len(cp.Failed())),
+			cp.Updated.Format("2006-01-02 15:04"),
+			truncate(checkpointCommand(cp), 60),
+		)
+	}
+	fmt.Fprint(cli.out(), table.Render())
+	fmt.Fprintln(cli.out())
+}
+
+// checkpointCommand returns the command a checkpoint resumes
+func checkpointCommand(cp *core.Checkpoint) string {
+	if cp.Kind == "module" {
+		return strings.TrimSpace(cp.Module + " " + strings.Join(cp.Args, " "))
+	}
+	return cp.Command
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// HandleResume continues a checkpointed loop or module run with its unfinished items.
+// A module run takes the secret options its checkpoint left out as option=value.
+func (cli *CLI) HandleResume(args []string) {
+	usage := "Usage: resume <id> [--failed] [option=value ...]"
+	if len(args) == 0 {
+		cli.printError(usage)
+		return
+	}
+	retryFailed := false
+	var extra []string
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--failed":
+			retryFailed = true
+		case strings.Contains(arg, "="):
+			extra = append(extra, arg)
+		default:
+			cli.printError(usage)
+			return
+		}
+	}
+
+	cp, err := core.LoadCheckpoint(args[0])
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	left := cp.Total - len(cp.Skip(retryFailed))
+	if left <= 0 {
+		if failed := len(cp.Failed()); failed > 0 && !retryFailed {
+			cli.printInfo(fmt.Sprintf("All items of %s ran, %d failed - use 'resume %s --failed' to retry them", cp.ID, failed, cp.ID))
+		} else {
+			cli.printInfo(fmt.Sprintf("Nothing left to run in checkpoint %s", cp.ID))
+		}
+		return
+	}
+
+	if len(extra) > 0 && cp.Kind != "module" {
+		cli.printError(fmt.Sprintf("Checkpoint %s is a loop, option=value only applies to module runs", cp.ID))
+		return
+	}
+	given := cli.parseArguments(extra)
+	for _, name := range cp.Omitted {
+		if _, ok := given[name]; !ok {
+			cli.printWarning(fmt.Sprintf("Checkpoint %s doesn't store the secret option '%s', give it again with %s=<value> unless a variable sets it", cp.ID, name, name))
+		}
+	}
+
+	cli.printInfo(fmt.Sprintf("Resuming checkpoint %s: %d of %d items left (started %s)",
+		cp.ID, left, cp.Total, cp.Created.Format(time.DateTime)))
+
+	cli.resuming = &resumeState{cp: cp, retryFailed: retryFailed}
+	defer func() { cli.resuming = nil }() // not picked up if the command fails early
+
+	switch cp.Kind {
+	case "loop":
+		loop, err := parseForLoop(cp.Command)
+		if err != nil {
+			cli.printError(fmt.Sprintf("Checkpoint %s: %v", cp.ID, err))
+			return
+		}
+		cli.executeForLoop(loop)
+	case "module":
+		cli.RunModule(cp.Module, append(cp.Args, extra...))
+	default:
+		cli.printError(fmt.Sprintf("Checkpoint %s has unknown kind '%s'", cp.ID, cp.Kind))
+	}
+}
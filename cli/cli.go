@@ -1,15 +1,15 @@
 package cli
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"net"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"lanmanvan/core"
 
@@ -28,6 +28,36 @@ type CLI struct {
 	currentModule    string
 	moduleVariables  map[string]string
 	currentDirectory string
+
+	// workspace records runs and findings, opened on first use
+	workspace   *core.Workspace
+	workspaceMu sync.Mutex
+
+	// jobs are modules running in the background
+	jobs *JobManager
+
+	// lastExitCode is the exit code of the last module or shell command
+	lastExitCode int
+	// exitStatus is what $? expands to: lastExitCode from before the running command
+	exitStatus int
+	// wrapper is the session-wide command modules run under, e.g. sudo -E
+	wrapper []string
+	// stdout and stderr are where commands write, the terminal unless redirected.
+	// Parallel loop iterations read them, outMu guards them.
+	stdout, stderr io.Writer
+	outMu          sync.Mutex
+
+	// script is the script running, whose func name(args) { ... } functions can be called
+	script *scriptRunner
+	// scriptDepth counts running scripts and function calls, scriptStop asks them to stop
+	scriptDepth atomic.Int32
+	scriptStop  atomic.Bool
+	// loopDepth counts running sequential loops, loopStop asks them to stop after the current item
+	loopDepth atomic.Int32
+	loopStop  atomic.Bool
+
+	// resuming is the checkpoint 'resume' hands to the loop or sharded run it starts
+	resuming *resumeState
 }
 
 // NewCLI creates a new CLI instance
@@ -51,6 +81,7 @@ func NewCLI(modulesDirs interface{}) *CLI {
 		history: make([]string, 0),
 		envMgr:  NewEnvironmentManager(),
 		logger:  NewLogger(),
+		jobs:    NewJobManager(),
 
 		// v2.0: currentModule starts as empty (no module selected)
 		currentModule:    "",
@@ -170,14 +201,18 @@ func (cli *CLI) Start(banner__ bool) error {
 		return err
 	}
 	defer rl.Close()
+	defer cli.closeWorkspace()
+	defer removeStdinSpool()
+	defer cli.stopJobs()
 
 	for cli.running {
+		cli.jobs.AnnounceFinished()
 		rl.SetPrompt(cli.GetPrompt())
 
 		input, err := rl.Readline()
 		if err != nil {
 			if err.Error() == "Interrupt" {
-				fmt.Println()
+				fmt.Fprintln(cli.out())
 				continue
 			}
 			if err.Error() == "EOF" {
@@ -215,6 +250,8 @@ func (cli *CLI) IdleStart(banner__ bool, command__ string) error {
 		return err
 	}
 	defer rl.Close()
+	defer cli.closeWorkspace()
+	defer removeStdinSpool()
 
 	for cli.running {
 		//rl.SetPrompt(cli.GetPrompt())
@@ -229,428 +266,452 @@ func (cli *CLI) IdleStart(banner__ bool, command__ string) error {
 		cli.history = append(cli.history, input)
 		cli.ExecuteCommand(input)
 
+		// A one-shot command can't leave jobs behind, wait for them like a shell script would
+		if len(cli.jobs.running()) > 0 {
+			cli.jobs.wait()
+		}
+		cli.jobs.AnnounceFinished()
+
 		break
 	}
 
 	return nil
 }
 
-// ExecuteCommand processes user commands
+// ExecuteCommand parses a command line and runs it
+func (cli *CLI) ExecuteCommand(input string) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
 
-// handleBuiltinMacro returns true if the macro was handled (built-in), false otherwise
-func (cli *CLI) ExecuteCommand(inputx string) {
-	inputx = strings.TrimSpace(inputx)
-	if inputx == "" {
+	list, err := parseCommandLine(input)
+	if err != nil {
+		printParseError(cli.out(), input, err)
+		cli.lastExitCode = 2
 		return
 	}
+	for _, chain := range list.chains {
+		if !cli.running {
+			return
+		}
+		cli.runChain(chain)
+	}
+}
 
-	// ── Handle multiple commands separated by ; ─────────────────────────────
-	commands := strings.Split(inputx, ";")
-	for _, input := range commands {
-		input = strings.TrimSpace(input)
-		if input == "" {
+// runChain runs the pipelines of a chain, skipping those whose && or || condition isn't met
+func (cli *CLI) runChain(chain *cmdChain) {
+	if chain.background {
+		cli.runBackground(chain)
+		return
+	}
+	for i, pipeline := range chain.pipelines {
+		if i > 0 && (chain.ops[i-1] == "&&") != (cli.lastExitCode == 0) {
 			continue
 		}
+		cli.exitStatus = cli.lastExitCode
+		cli.lastExitCode = 0
+		switch {
+		case len(pipeline.redirects) > 0:
+			cli.runRedirected(pipeline)
+		case len(pipeline.stages) > 1:
+			cli.executePipedCommands(pipeline.stages)
+		default:
+			cli.runCommand(pipeline.stages[0])
+		}
+	}
+}
 
-		// ── 1. Structured / script-like syntaxes (highest priority) ───────────────
-
-		// for ... in ... -> ...
-		if strings.HasPrefix(input, "for ") &&
-			strings.Contains(input, " in ") &&
-			strings.Contains(input, " -> ") {
-			cli.executeForLoop(input)
+// runBackground starts a chain ending in &: a module as a job, a shell command in the shell
+func (cli *CLI) runBackground(chain *cmdChain) {
+	first := chain.pipelines[0].stages[0]
+	if len(chain.pipelines) == 1 && len(chain.pipelines[0].stages) == 1 && len(chain.pipelines[0].redirects) == 0 && first.loop == nil {
+		if cli.startBackgroundCommand(first.words) {
 			return
 		}
+	}
+	if strings.HasPrefix(chain.text, "$") || (first.loop == nil && !isReplCommand(first.name())) {
+		cli.ExecuteShellCommand(strings.TrimSpace(strings.TrimPrefix(chain.text, "$")) + " &")
+		return
+	}
+	cli.printError("Only modules and shell commands can run in the background with &")
+	cli.lastExitCode = 1
+}
 
-		// #proxychains cmd
-		// #sudo cmd
-		if strings.HasPrefix(input, "#proxychains ") || strings.HasPrefix(input, "#sudo ") {
-			prefix := ""
-			cmdAndMod := ""
-
-			if strings.HasPrefix(input, "#proxychains ") {
-				prefix = "proxychains "
-				cmdAndMod = strings.TrimSpace(input[len("#proxychains "):])
-			} else if strings.HasPrefix(input, "#sudo ") {
-				prefix = "sudo "
-				cmdAndMod = strings.TrimSpace(input[len("#sudo "):])
-			}
-
-			if cmdAndMod == "" {
-				core.PrintError("Missing command after " + strings.TrimSpace(prefix[:len(prefix)-1]))
-				return
-			}
+// assignmentPattern matches a VAR=value word
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
 
-			// Parse out #mod=... from cmdAndMod
-			modPath := "~/lanmanvan/modules" // default
-			finalCmd := cmdAndMod
-
-			if strings.Contains(cmdAndMod, "#mod=") {
-				// Use regex to extract #mod=... (non-greedy, allow spaces in path? but usually none)
-				modRe := regexp.MustCompile(`\s*#mod=(\S+)`)
-				modMatches := modRe.FindStringSubmatch(cmdAndMod)
-				if len(modMatches) > 1 {
-					modPath = modMatches[1]
-					// Remove the #mod=... part from the command
-					finalCmd = modRe.ReplaceAllString(cmdAndMod, "")
-					finalCmd = strings.TrimSpace(finalCmd)
-				}
-			}
+// runCommand runs one command: a for loop, a REPL command, a module or a shell command
+func (cli *CLI) runCommand(cmd *simpleCmd) {
+	input := cmd.text
 
-			if finalCmd == "" {
-				core.PrintError("Command is empty after removing #mod")
-				return
-			}
+	// ── 1. Structured / script-like syntaxes (highest priority) ───────────────
 
-			// Construct the wrapper command
-			wrapper := fmt.Sprintf(
-				`%s~/bin/lanmanvan -modules %q -idle-exec -idle-cmd %q`,
-				prefix,
-				modPath,
-				finalCmd,
-			)
+	// for ... in ... -> ...
+	if cmd.loop != nil {
+		cli.executeForLoop(cmd.loop)
+		return
+	}
 
-			core.PrintInfo("Executing in background/idle mode:")
-			fmt.Printf("  → %s\n\n", wrapper)
+	// #sudo cmd, #proxychains cmd: run one command under a wrapper
+	if cmd.name() == "#sudo" || cmd.name() == "#proxychains" {
+		cli.runWrapped(strings.TrimPrefix(cmd.name(), "#"), cmd)
+		return
+	}
 
-			cli.ExecuteShellCommand(wrapper)
-			return
-		}
+	// ── 2. Simple built-in printing commands ──────────────────────────────────
 
-		// Output redirection > and >>
-		if strings.Contains(input, " > ") || strings.Contains(input, " >> ") ||
-			(strings.HasSuffix(input, ">") && !strings.HasSuffix(input, "->")) ||
-			strings.HasSuffix(input, ">>") {
+	if cmd.name() == "echo" || cmd.name() == "print" {
+		fmt.Fprintln(cli.out(), cli.expandValue(strings.Join(cmd.args(), " ")))
+		return
+	}
 
-			greaterPos := strings.LastIndex(input, ">>")
-			if greaterPos == -1 {
-				greaterPos = strings.LastIndex(input, ">")
-			}
+	// ── 3. Variable operations ────────────────────────────────────────────────
 
-			if greaterPos > 0 {
-				cmd := strings.TrimSpace(input[:greaterPos])
-				redirectPart := strings.TrimSpace(input[greaterPos:])
+	// VAR=value  or  VAR=?
+	if len(cmd.words) == 1 && assignmentPattern.MatchString(cmd.words[0]) {
+		parts := strings.SplitN(cmd.words[0], "=", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
 
-				fields := strings.Fields(redirectPart)
-				if len(fields) < 2 {
-					core.PrintError("Redirection syntax: command > file  or  command >> file")
-					return
+			if value == "?" {
+				if val, exists := cli.envMgr.Get(key); exists {
+					fmt.Fprintf(cli.out(), "  %s = %s\n", core.Color("cyan", key), core.Color("green", val))
+				} else {
+					cli.printWarning(fmt.Sprintf("Variable '%s' not set", key))
 				}
+				return
+			}
 
-				op := fields[0] // > or >>
-				filename := strings.Join(fields[1:], " ")
-				filename = strings.Trim(filename, "\"'")
-
-				wrapper := fmt.Sprintf(
-					`lmv -idle-exec -idle-cmd %q %s %q`,
-					cmd,
-					op,
-					filename,
-				)
-
-				core.PrintInfo("Redirecting output via idle/background executor...")
-				fmt.Printf("  → %s\n\n", wrapper)
+			// 🔥 Expand @name: if in module, @name = module var; else = global var
+			expandedValue := value
+			if strings.HasPrefix(value, "@") && len(value) > 1 {
+				varName := value[1:]
+				// If a module is active, try module variable first
+				if cli.currentModule != "" {
+					if moduleVal, ok := cli.moduleVariables[varName]; ok {
+						expandedValue = moduleVal
+					} else {
+						// Optionally fall back to global? Or leave as @name?
+						// For safety, we fall back to global
+						if globalVal, ok := cli.envMgr.Get(varName); ok {
+							expandedValue = globalVal
+						}
+						// else: keep original @name (but unlikely)
+					}
+				} else {
+					// No module active → use global
+					if globalVal, ok := cli.envMgr.Get(varName); ok {
+						expandedValue = globalVal
+					}
+				}
+			} else {
+				// $var, $? and $(builtin) are expanded once, at assignment
+				expandedValue = cli.expandValue(value)
+			}
 
-				cli.ExecuteShellCommand(wrapper)
+			if err := cli.envMgr.Set(key, expandedValue); err != nil {
+				cli.printError(fmt.Sprintf("Failed to set variable: %v", err))
 				return
 			}
+
+			cli.printSuccess(fmt.Sprintf("Set %s = %s", key, expandedValue))
+			return
 		}
+	}
+	// ── 4. Direct shell execution with $ prefix ───────────────────────────────
 
-		// ── 2. Simple built-in printing commands ──────────────────────────────────
+	if strings.HasPrefix(input, "$") {
+		realCmd := strings.TrimSpace(input[1:])
+		cli.ExecuteShellCommand(realCmd)
+		return
+	}
 
-		if strings.HasPrefix(input, "echo ") ||
-			strings.HasPrefix(input, "print ") {
+	// set / get
 
-			content := ""
-			if strings.HasPrefix(input, "echo ") {
-				content = strings.TrimSpace(input[5:])
-			} else {
-				content = strings.TrimSpace(input[6:])
-			}
+	// ── 3b. @var → print module variable (only if module selected) ─────────────
 
-			fmt.Println(content)
+	if strings.HasPrefix(input, "@") && len(input) > 1 {
+		varName := strings.TrimSpace(input[1:])
+		if cli.currentModule == "" {
+			cli.printError("No module selected. Use 'use <module>' first.")
 			return
 		}
+		if val, ok := cli.moduleVariables[varName]; ok {
+			fmt.Fprintln(cli.out(), val)
+		} else {
+			cli.printWarning(fmt.Sprintf("Module variable '@%s' not set.", varName))
+		}
+		return
+	}
 
-		// ── 3. Variable operations ────────────────────────────────────────────────
+	// ── 5. Built-in commands & module execution ───────────────────────────────
 
-		// VAR=value  or  VAR=?
-		if strings.Contains(input, "=") && !strings.Contains(input, " ") {
-			parts := strings.SplitN(input, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
+	cmdName := cmd.name()
+	args := cmd.args()
 
-				if value == "?" {
-					if val, exists := cli.envMgr.Get(key); exists {
-						fmt.Printf("  %s = %s\n", core.Color("cyan", key), core.Color("green", val))
-					} else {
-						core.PrintWarning(fmt.Sprintf("Variable '%s' not set", key))
-					}
-					return
-				}
+	// Functions of the running script; they can't be named like a command or module
+	if fn, ok := cli.scriptFunction(cmdName); ok {
+		cli.callFunction(fn, args)
+		return
+	}
 
-				// 🔥 Expand @name: if in module, @name = module var; else = global var
-				expandedValue := value
-				if strings.HasPrefix(value, "@") && len(value) > 1 {
-					varName := value[1:]
-					// If a module is active, try module variable first
-					if cli.currentModule != "" {
-						if moduleVal, ok := cli.moduleVariables[varName]; ok {
-							expandedValue = moduleVal
-						} else {
-							// Optionally fall back to global? Or leave as @name?
-							// For safety, we fall back to global
-							if globalVal, ok := cli.envMgr.Get(varName); ok {
-								expandedValue = globalVal
-							}
-							// else: keep original @name (but unlikely)
-						}
-					} else {
-						// No module active → use global
-						if globalVal, ok := cli.envMgr.Get(varName); ok {
-							expandedValue = globalVal
-						}
-					}
-				}
+	switch cmdName {
+	case "help", "h", "?":
+		cli.PrintHelp()
 
-				if err := cli.envMgr.Set(key, expandedValue); err != nil {
-					core.PrintError(fmt.Sprintf("Failed to set variable: %v", err))
-					return
-				}
+	case "list", "ls", "modules":
+		cli.ListModules()
 
-				core.PrintSuccess(fmt.Sprintf("Set %s = %s", key, expandedValue))
-				return
-			}
-		}
-		// ── 4. Direct shell execution with $ prefix ───────────────────────────────
-
-		if strings.HasPrefix(input, "$") {
-			realCmd := strings.TrimSpace(input[1:])
-			cli.ExecuteShellCommand(realCmd)
+	case "search":
+		if len(args) == 0 {
+			cli.printError("Usage: search <keyword>")
 			return
 		}
+		cli.SearchModules(strings.Join(args, " "))
 
-		// set / get
-
-		// ── 3b. @var → print module variable (only if module selected) ─────────────
-
-		if strings.HasPrefix(input, "@") && len(input) > 1 {
-			varName := strings.TrimSpace(input[1:])
+	case "info":
+		if len(args) == 0 {
 			if cli.currentModule == "" {
-				core.PrintError("No module selected. Use 'use <module>' first.")
+				cli.printError("Usage: info <module>  OR  select a module with 'use <module>' and run 'info'")
 				return
 			}
-			if val, ok := cli.moduleVariables[varName]; ok {
-				fmt.Println(val)
+			// Show info for currently selected module
+			cli.ShowModuleInfo(cli.currentModule, 1)
+			return
+		}
+		// Show info for explicitly given module
+		cli.ShowModuleInfo(args[0], 1)
+		return
+
+	case "use":
+		if len(args) == 0 {
+			if cli.currentModule != "" {
+				cli.printInfo(fmt.Sprintf("Currently using module: %s", core.Color("cyan", cli.currentModule)))
 			} else {
-				core.PrintWarning(fmt.Sprintf("Module variable '@%s' not set.", varName))
+				cli.printInfo("No module currently selected.")
 			}
 			return
 		}
 
-		// ── 5. Built-in commands & module execution ───────────────────────────────
+		moduleName := args[0]
 
-		parts := strings.Fields(input)
-		if len(parts) == 0 {
+		// Validate module exists
+		if !cli.moduleExists(moduleName) {
+			cli.printError(fmt.Sprintf("Module '%s' not found. Use 'list' to see available modules.", moduleName))
 			return
 		}
 
-		cmdName := parts[0]
-		args := parts[1:]
-
-		switch cmdName {
-		case "help", "h", "?":
-			cli.PrintHelp()
-
-		case "list", "ls", "modules":
-			cli.ListModules()
+		cli.currentModule = moduleName
+		cli.printSuccess(fmt.Sprintf("Using module: %s", core.Color("cyan", moduleName)))
+		return
 
-		case "search":
-			if len(args) == 0 {
-				core.PrintError("Usage: search <keyword>")
-				return
-			}
-			cli.SearchModules(strings.Join(args, " "))
+	case "set":
+		if cli.currentModule == "" {
+			cli.printError("No module selected. Use 'use <module>' first.")
+			return
+		}
 
-		case "info":
-			if len(args) == 0 {
-				if cli.currentModule == "" {
-					core.PrintError("Usage: info <module>  OR  select a module with 'use <module>' and run 'info'")
-					return
+		if len(args) == 0 {
+			// List module variables
+			if len(cli.moduleVariables) == 0 {
+				cli.printInfo("No variables set for module '" + cli.currentModule + "'.")
+			} else {
+				cli.printInfo("Module variables for '" + cli.currentModule + "':")
+				for k, v := range cli.moduleVariables {
+					fmt.Fprintf(cli.out(), "  %s = %s\n", core.Color("cyan", k), core.Color("green", v))
 				}
-				// Show info for currently selected module
-				cli.ShowModuleInfo(cli.currentModule, 1)
-				return
 			}
-			// Show info for explicitly given module
-			cli.ShowModuleInfo(args[0], 1)
 			return
+		}
 
-		case "use":
-			if len(args) == 0 {
-				if cli.currentModule != "" {
-					core.PrintInfo(fmt.Sprintf("Currently using module: %s", core.Color("cyan", cli.currentModule)))
-				} else {
-					core.PrintInfo("No module currently selected.")
-				}
-				return
-			}
+		if len(args) < 2 {
+			cli.printError("Usage: set <name> <value>")
+			return
+		}
 
-			moduleName := args[0]
+		key := args[0]
 
-			// Validate module exists
-			if !cli.moduleExists(moduleName) {
-				core.PrintError(fmt.Sprintf("Module '%s' not found. Use 'list' to see available modules.", moduleName))
-				return
-			}
+		rawValue := strings.Join(args[1:], " ")
 
-			cli.currentModule = moduleName
-			core.PrintSuccess(fmt.Sprintf("Using module: %s", core.Color("cyan", moduleName)))
-			return
+		// Expand @name → global env var, and $name → global env var
+		expandedValue := cli.expandGlobalReferences(rawValue)
 
-		case "set":
-			if cli.currentModule == "" {
-				core.PrintError("No module selected. Use 'use <module>' first.")
-				return
-			}
+		cli.moduleVariables[key] = expandedValue
+		cli.printSuccess(fmt.Sprintf("Set %s = %s", core.Color("cyan", key), core.Color("green", expandedValue)))
 
-			if len(args) == 0 {
-				// List module variables
-				if len(cli.moduleVariables) == 0 {
-					core.PrintInfo("No variables set for module '" + cli.currentModule + "'.")
-				} else {
-					core.PrintInfo("Module variables for '" + cli.currentModule + "':")
-					for k, v := range cli.moduleVariables {
-						fmt.Printf("  %s = %s\n", core.Color("cyan", k), core.Color("green", v))
-					}
-				}
-				return
-			}
+		return
 
-			if len(args) < 2 {
-				core.PrintError("Usage: set <name> <value>")
-				return
-			}
+	case "run":
+		if cli.currentModule == "" {
+			cli.printError("No module selected. Use 'use <module>' first, or run explicitly: run <module> [args...]")
+			return
+		}
 
-			key := args[0]
+		// -j launches the current module as a background job
+		background := false
+		if len(args) > 0 && args[0] == "-j" {
+			background = true
+			args = args[1:]
+		}
+		finalArgs := cli.currentModuleArgs(args)
 
-			rawValue := strings.Join(args[1:], " ")
+		if background {
+			cli.StartJob(cli.currentModule, finalArgs)
+			return
+		}
 
-			// Expand @name → global env var, and $name → global env var
-			expandedValue := cli.expandGlobalReferences(rawValue)
+		// Run the current module with merged args
+		cli.RunModule(cli.currentModule, finalArgs)
+		return
 
-			cli.moduleVariables[key] = expandedValue
-			core.PrintSuccess(fmt.Sprintf("Set %s = %s", core.Color("cyan", key), core.Color("green", expandedValue)))
+	case "create", "new":
+		if len(args) == 0 {
+			cli.printError("Usage: create <name> [type]")
+			return
+		}
+		cli.CreateModule(args[0], args[1:])
 
+	case "edit":
+		if len(args) == 0 {
+			cli.printError("Usage: edit <module>")
 			return
+		}
+		cli.EditModule(args[0])
 
-		case "run":
-			if cli.currentModule == "" {
-				core.PrintError("No module selected. Use 'use <module>' first, or run explicitly: run <module> [args...]")
-				return
-			}
+	case "delete", "rm", "remove":
+		if len(args) == 0 {
+			cli.printError("Usage: delete <module>")
+			return
+		}
+		cli.DeleteModule(args[0])
 
-			// Build final args list: start with module defaults, then apply overrides
-			finalArgs := make([]string, 0)
+	case "env", "envs":
+		cli.envMgr.Display(cli.out())
 
-			// Add all current module variables as key=value
-			for k, v := range cli.moduleVariables {
-				finalArgs = append(finalArgs, k+"="+v)
-			}
+	case "workspace", "workspaces", "ws":
+		cli.HandleWorkspace(args)
 
-			// Override with command-line args (e.g., run url=...)
-			for _, arg := range args {
-				if strings.Contains(arg, "=") {
-					// Extract key to allow override
-					parts := strings.SplitN(arg, "=", 2)
-					key := parts[0]
-					// Remove existing key from finalArgs (to avoid duplicates)
-					newFinal := make([]string, 0)
-					for _, a := range finalArgs {
-						if !strings.HasPrefix(a, key+"=") {
-							newFinal = append(newFinal, a)
-						}
-					}
-					finalArgs = newFinal
-					// Add new override
-					finalArgs = append(finalArgs, arg)
-				} else {
-					// Not a key=value? Pass through (maybe your module supports positional args)
-					finalArgs = append(finalArgs, arg)
-				}
-			}
+	case "hosts", "services", "findings":
+		cli.HandleWorkspaceQuery(cmdName, args)
 
-			// Run the current module with merged args
-			cli.RunModule(cli.currentModule, finalArgs)
-			return
+	case "jobs":
+		cli.HandleJobs(args)
 
-		case "create", "new":
-			if len(args) == 0 {
-				core.PrintError("Usage: create <name> [python|bash|go]")
-				return
-			}
-			cli.CreateModule(args[0], args[1:])
+	case "fg":
+		cli.ForegroundJob(args)
 
-		case "edit":
-			if len(args) == 0 {
-				core.PrintError("Usage: edit <module>")
-				return
-			}
-			cli.EditModule(args[0])
+	case "checkpoints":
+		cli.HandleCheckpoints(args)
 
-		case "delete", "rm", "remove":
-			if len(args) == 0 {
-				core.PrintError("Usage: delete <module>")
-				return
-			}
-			cli.DeleteModule(args[0])
+	case "builtins":
+		cli.ListBuiltins()
+
+	case "resume":
+		cli.HandleResume(args)
+
+	case "runs":
+		if len(args) == 2 && args[0] == "show" {
+			cli.ShowRun(args[1])
+			return
+		}
+		cli.HandleWorkspaceQuery(cmdName, args)
+
+	case "history":
+		cli.PrintHistory()
+
+	case "clear", "cls":
+		cli.ClearScreen()
 
-		case "env", "envs":
-			cli.envMgr.Display()
+	case "refresh", "reload":
+		cli.RefreshModules()
 
-		case "history":
-			cli.PrintHistory()
+	case "modules-path", "module-paths":
+		cli.ShowModulesPaths()
 
-		case "clear", "cls":
-			cli.ClearScreen()
+	case "module":
+		cli.handleModuleCommand(args)
 
-		case "refresh", "reload":
-			cli.RefreshModules()
+	case "doctor":
+		cli.Doctor(args)
 
-		case "modules-path", "module-paths":
-			cli.ShowModulesPaths()
+	case "wrapper":
+		cli.handleWrapperCommand(args)
 
-		case "exit", "quit", "q":
-			cli.running = false
-			fmt.Println()
-			core.PrintSuccess("Goodbye! See you next time.")
+	case "source":
+		if len(args) != 1 {
+			cli.printError("Usage: source <script.lmv>")
+			cli.lastExitCode = 2
 			return
+		}
+		cli.RunScript(args[0])
+
+	case "exit", "quit", "q":
+		cli.running = false
+		cli.stopJobs()
+		cli.closeWorkspace()
+		fmt.Fprintln(cli.out())
+		cli.printSuccess("Goodbye! See you next time.")
+		return
 
-		default:
-			// Handle "!" -> show info for current module
-			if cmdName == "!" {
-				if cli.currentModule == "" {
-					core.PrintError("No active module selected. Use 'use <module>' first.")
-					return
-				}
-				cli.ShowModuleInfo(cli.currentModule, 0)
+	default:
+		// Handle "!" -> show info for current module
+		if cmdName == "!" {
+			if cli.currentModule == "" {
+				cli.printError("No active module selected. Use 'use <module>' first.")
 				return
 			}
+			cli.ShowModuleInfo(cli.currentModule, 0)
+			return
+		}
 
-			// Handle "modname!" -> show info for that module
-			if strings.HasSuffix(cmdName, "!") {
-				moduleName := strings.TrimSuffix(cmdName, "!")
-				cli.ShowModuleInfo(moduleName, 0)
-				return
-			}
+		// Handle "modname!" -> show info for that module
+		if strings.HasSuffix(cmdName, "!") {
+			moduleName := strings.TrimSuffix(cmdName, "!")
+			cli.ShowModuleInfo(moduleName, 0)
+			return
+		}
+
+		// Try as module first → fallback to system shell
+		if !cli.RunModule(cmdName, args) {
+			cli.ExecuteShellCommand(input)
+		}
+	}
+}
 
-			// Try as module first → fallback to system shell
-			if !cli.RunModule(cmdName, args) {
-				cli.ExecuteShellCommand(input)
+// currentModuleArgs merges the current module's variables with the args given to 'run'
+func (cli *CLI) currentModuleArgs(args []string) []string {
+	// Build final args list: start with module defaults, then apply overrides
+	finalArgs := make([]string, 0)
+
+	// Add all current module variables as key=value
+	for k, v := range cli.moduleVariables {
+		finalArgs = append(finalArgs, k+"="+v)
+	}
+
+	// Override with command-line args (e.g., run url=...)
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			// Extract key to allow override
+			parts := strings.SplitN(arg, "=", 2)
+			key := parts[0]
+			// Remove existing key from finalArgs (to avoid duplicates)
+			newFinal := make([]string, 0)
+			for _, a := range finalArgs {
+				if !strings.HasPrefix(a, key+"=") {
+					newFinal = append(newFinal, a)
+				}
 			}
+			finalArgs = newFinal
+			// Add new override
+			finalArgs = append(finalArgs, arg)
+		} else {
+			// Not a key=value? Pass through (maybe your module supports positional args)
+			finalArgs = append(finalArgs, arg)
 		}
 	}
+	return finalArgs
 }
 
 // ExecuteShellCommand runs the command through the real shell,
@@ -683,52 +744,70 @@ func (cli *CLI) Stop() {
 
 // RefreshModules refreshes and reloads all modules from the modules directory
 func (cli *CLI) RefreshModules() {
-	fmt.Println()
-	core.PrintInfo("Refreshing modules...")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	cli.printInfo("Refreshing modules...")
+	fmt.Fprintln(cli.out())
 
 	// Clear and reinitialize the module manager with the same directories
 	cli.manager = core.NewModuleManager(cli.manager.ModulesDirs)
 
 	// Discover modules again
 	if err := cli.manager.DiscoverModules(); err != nil {
-		core.PrintError(fmt.Sprintf("Failed to refresh modules: %v", err))
-		fmt.Println()
+		cli.printError(fmt.Sprintf("Failed to refresh modules: %v", err))
+		fmt.Fprintln(cli.out())
 		return
 	}
 
-	// Count loaded modules
+	// Count loaded modules and those missing dependencies
 	modules := cli.manager.ListModules()
 	moduleCount := len(modules)
+	ready := make(map[string]bool, moduleCount)
+	for _, module := range modules {
+		ready[module.Name] = module.Loaded && len(core.FailedDependencies(cli.manager.CheckDependencies(module))) == 0
+	}
 
-	fmt.Println()
-	core.PrintSuccess(fmt.Sprintf("Modules refreshed successfully! Loaded %d module(s)", moduleCount))
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	cli.printSuccess(fmt.Sprintf("Modules refreshed successfully! Loaded %d module(s)", moduleCount))
+	fmt.Fprintln(cli.out())
 
 	// Display summary of loaded modules
 	if moduleCount > 0 {
-		fmt.Println(core.NmapBox("Loaded Modules"))
+		fmt.Fprintln(cli.out(), core.NmapBox("Loaded Modules"))
 		for i, module := range modules {
-			status := ""
-			fmt.Printf("   [%d] %s %s\n", i+1, status, core.Color("cyan", module.Name))
+			status := core.Color("green", "✓")
+			if !ready[module.Name] {
+				status = core.Color("red", "✗")
+			}
+			fmt.Fprintf(cli.out(), "   [%d] %s %s\n", i+1, status, core.Color("cyan", module.Name))
 		}
-		fmt.Println()
+		fmt.Fprintln(cli.out())
+	}
+
+	broken := 0
+	for _, ok := range ready {
+		if !ok {
+			broken++
+		}
+	}
+	if broken > 0 {
+		cli.printWarning(fmt.Sprintf("%d module(s) have unmet dependencies, run 'doctor' for details", broken))
+		fmt.Fprintln(cli.out())
 	}
 }
 
 // ShowModulesPaths displays the modules directories configured in this session
 func (cli *CLI) ShowModulesPaths() {
-	fmt.Println()
-	core.PrintInfo("Module Search Paths (configured in this session)")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	cli.printInfo("Module Search Paths (configured in this session)")
+	fmt.Fprintln(cli.out())
 
 	if len(cli.manager.ModulesDirs) == 0 {
-		core.PrintWarning("No modules directories configured")
-		fmt.Println()
+		cli.printWarning("No modules directories configured")
+		fmt.Fprintln(cli.out())
 		return
 	}
 
-	fmt.Println(core.NmapBox("Modules Directories"))
+	fmt.Fprintln(cli.out(), core.NmapBox("Modules Directories"))
 
 	for i, dir := range cli.manager.ModulesDirs {
 		// Count modules in this directory
@@ -743,47 +822,50 @@ func (cli *CLI) ShowModulesPaths() {
 		}
 
 		absPath, _ := filepath.Abs(dir)
-		fmt.Printf("  [%d] %s %s\n", i+1, core.Color("cyan", status), absPath)
-		fmt.Printf("      └─ Contains ~%d items\n", moduleCount)
+		fmt.Fprintf(cli.out(), "  [%d] %s %s\n", i+1, core.Color("cyan", status), absPath)
+		fmt.Fprintf(cli.out(), "      └─ Contains ~%d items\n", moduleCount)
 	}
 
-	fmt.Println()
-	fmt.Println(core.Color("yellow", "Tip:") + " You can add more directories using: ./lanmanvan -modules /path1:/path2:/path3")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.Color("yellow", "Tip:")+" You can add more directories using: ./lanmanvan -modules /path1:/path2:/path3")
+	fmt.Fprintln(cli.out())
 }
 
-// Iterator represents something that can produce values one by one
-type Iterator interface {
-	Next() (string, bool) // value, ok
-	Len() int             // total expected items (for progress)
-	Close() error         // optional cleanup
-}
+// executeForLoop runs a parsed for loop over its source
+func (cli *CLI) executeForLoop(loop *forLoop) {
+	input := loop.text
+	vars := loop.vars
+	varName := vars[0]
+	sourceExpr := loop.source
+	commandTemplate := loop.body
 
-func (cli *CLI) executeForLoop(input string) {
-	input = strings.TrimSpace(input)
-
-	// Match: for [var] in ... -> command
-	re := regexp.MustCompile(`(?i)^for\s+(?:\$?(\w+))\s+(?:in\s+)?(.+?)\s*[-=]{1,2}>\s*(.+)$`)
-	matches := re.FindStringSubmatch(input)
-	if len(matches) != 4 {
-		core.PrintError("Invalid for-loop syntax.\nExamples:\n  for $x in 1..100 -> echo $x\n  for ip in 192.168.1.1..50 -> ping $ip\n  for url in $cat(\"urls.txt\") -> curl $url")
+	// Trailing parallel=/rate=/delay=/jitter=/on-error= options switch to the parallel runner
+	sourceExpr, loopOpts, parallel, err := parseLoopOptions(sourceExpr)
+	if err != nil {
+		cli.printError(err.Error())
 		return
 	}
 
-	varName := matches[1]
-	sourceExpr := strings.TrimSpace(matches[2])
-	commandTemplate := strings.TrimSpace(matches[3])
+	if len(vars) > 1 {
+		cli.executeTupleLoop(input, vars, sourceExpr, commandTemplate, loopOpts, parallel)
+		return
+	}
 
-	// Check if source is $cat("...")
+	// Check if source is $cat("..."); line-based wordlists are streamed like @file
+	// rather than loaded into memory, only JSON/YAML data is loaded
 	catRe := regexp.MustCompile(`^\$cat\(\s*["']([^"']+)["']\s*\)$`)
 	catMatches := catRe.FindStringSubmatch(sourceExpr)
+	if len(catMatches) == 2 && !isStructuredData(catMatches[1]) {
+		sourceExpr = "@" + catMatches[1]
+		catMatches = nil
+	}
 	if len(catMatches) == 2 {
 		filePath := catMatches[1]
 		// Expand ~
 		if strings.HasPrefix(filePath, "~/") {
 			home, err := os.UserHomeDir()
 			if err != nil {
-				core.PrintError("Cannot expand ~: " + err.Error())
+				cli.printError("Cannot expand ~: " + err.Error())
 				return
 			}
 			filePath = filepath.Join(home, filePath[2:])
@@ -791,64 +873,47 @@ func (cli *CLI) executeForLoop(input string) {
 
 		data, err := cli.loadStructuredData(filePath)
 		if err != nil {
-			core.PrintError("Failed to load data: " + err.Error())
+			cli.printError("Failed to load data: " + err.Error())
 			return
 		}
-
-		cli.runLoopOverData(varName, data, commandTemplate)
+		data = windowData(data, loopOpts.source)
+		if len(data) == 0 {
+			cli.printWarning("No data loaded – nothing to do")
+			return
+		}
+		cli.runLoop(input, varName, "$cat(...)", len(data), cli.dataLoopIterations(varName, data, commandTemplate), loopOpts, parallel)
 		return
 	}
 
-	// Fallback: original range-based iteration (1..100, a..z, etc.)
-	iter, err := parseRangeSource(sourceExpr)
+	// Fallback: range-based iteration (1..100, a..z, 10.0.0.0/24, @file, etc.)
+	factory, err := loopSourceFactory(sourceExpr, loopOpts.source.dedup)
+	var iter Iterator
+	if err == nil {
+		iter, err = factory()
+	}
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Cannot parse range: %v\nSource was: %s", err, sourceExpr))
+		cli.printError(fmt.Sprintf("Cannot parse range: %v\nSource was: %s", err, sourceExpr))
 		return
 	}
+	iter = newWindowIterator(iter, loopOpts.source)
 	defer iter.Close()
 
 	total := iter.Len()
 	if total == 0 {
-		core.PrintWarning("Empty range - nothing to do")
+		cli.printWarning("Empty range - nothing to do")
 		return
 	}
 
-	fmt.Println()
-	core.PrintInfo(fmt.Sprintf("Loop: %s ∈ %s  (%d items)", varName, sourceExpr, total))
-	fmt.Println()
-
-	results := []string{}
-	count := 0
-
-	for {
-		value, ok := iter.Next()
-		if !ok {
-			break
-		}
-		count++
-
-		expanded := regexp.MustCompile(`\$\{`+regexp.QuoteMeta(varName)+`\}|\$`+regexp.QuoteMeta(varName)).
-			ReplaceAllString(commandTemplate, value)
-
-		var result string
-		if strings.Contains(expanded, "|>") {
-			result = cli.executePipedCommandsForLoop(expanded)
-			if result != "" {
-				results = append(results, result)
-			}
-		} else {
-			cli.ExecuteCommand(expanded)
-		}
-	}
+	cli.runLoop(input, varName, sourceExpr, total, rangeLoopIterations(varName, iter, commandTemplate), loopOpts, parallel)
+}
 
-	if len(results) > 0 {
-		fmt.Println()
-		core.PrintSuccess(fmt.Sprintf("Collected results (%d):", len(results)))
-		for i, res := range results {
-			fmt.Printf("  [%2d] %s\n", i+1, strings.TrimSpace(res))
-		}
-		fmt.Println()
+// isStructuredData reports whether path is a JSON or YAML data file
+func isStructuredData(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
 	}
+	return false
 }
 
 // loadStructuredData loads .txt, .json, .yaml
@@ -897,68 +962,32 @@ func (cli *CLI) loadStructuredData(path string) ([]interface{}, error) {
 	}
 }
 
-// runLoopOverData handles both simple and structured items
-func (cli *CLI) runLoopOverData(varName string, items []interface{}, commandTemplate string) {
-	if len(items) == 0 {
-		core.PrintWarning("No data loaded – nothing to do")
-		return
-	}
-
-	fmt.Println()
-	core.PrintInfo(fmt.Sprintf("Loop: %s ∈ $cat(...)  (%d items)", varName, len(items)))
-	fmt.Println()
-
-	results := []string{}
-
-	for _, item := range items {
-		// Prepare substitution context
-		var expanded string
-
-		switch v := item.(type) {
-		case string:
-			// Simple: replace $var and ${var}
-			expanded = regexp.MustCompile(`\$\{`+regexp.QuoteMeta(varName)+`\}|\$`+regexp.QuoteMeta(varName)).
-				ReplaceAllString(commandTemplate, v)
-
-		case map[interface{}]interface{}:
-			// YAML often uses interface{} keys → convert to string-keyed map
-			strMap := make(map[string]interface{})
-			for k, val := range v {
-				if ks, ok := k.(string); ok {
-					strMap[ks] = val
-				}
+// expandLoopItem substitutes one loaded item into the loop's command template
+func (cli *CLI) expandLoopItem(varName string, item interface{}, commandTemplate string) string {
+	switch v := item.(type) {
+	case string:
+		// Simple: replace $var and ${var}
+		return regexp.MustCompile(`\$\{`+regexp.QuoteMeta(varName)+`\}|\$`+regexp.QuoteMeta(varName)).
+			ReplaceAllLiteralString(commandTemplate, v)
+
+	case map[interface{}]interface{}:
+		// YAML often uses interface{} keys → convert to string-keyed map
+		strMap := make(map[string]interface{})
+		for k, val := range v {
+			if ks, ok := k.(string); ok {
+				strMap[ks] = val
 			}
-			expanded = cli.expandStructuredCommand(varName, strMap, commandTemplate)
-
-		case map[string]interface{}:
-			expanded = cli.expandStructuredCommand(varName, v, commandTemplate)
-
-		default:
-			// Fallback: treat as string via fmt.Sprint
-			valStr := fmt.Sprintf("%v", v)
-			expanded = regexp.MustCompile(`\$\{`+regexp.QuoteMeta(varName)+`\}|\$`+regexp.QuoteMeta(varName)).
-				ReplaceAllString(commandTemplate, valStr)
 		}
+		return cli.expandStructuredCommand(varName, strMap, commandTemplate)
 
-		// Execute
-		var result string
-		if strings.Contains(expanded, "|>") {
-			result = cli.executePipedCommandsForLoop(expanded)
-			if result != "" {
-				results = append(results, result)
-			}
-		} else {
-			cli.ExecuteCommand(expanded)
-		}
-	}
+	case map[string]interface{}:
+		return cli.expandStructuredCommand(varName, v, commandTemplate)
 
-	if len(results) > 0 {
-		fmt.Println()
-		core.PrintSuccess(fmt.Sprintf("Collected results (%d):", len(results)))
-		for i, res := range results {
-			fmt.Printf("  [%2d] %s\n", i+1, strings.TrimSpace(res))
-		}
-		fmt.Println()
+	default:
+		// Fallback: treat as string via fmt.Sprint
+		valStr := fmt.Sprintf("%v", v)
+		return regexp.MustCompile(`\$\{`+regexp.QuoteMeta(varName)+`\}|\$`+regexp.QuoteMeta(varName)).
+			ReplaceAllLiteralString(commandTemplate, valStr)
 	}
 }
 
@@ -985,532 +1014,15 @@ func (cli *CLI) expandStructuredCommand(varName string, data map[string]interfac
 	return expanded
 }
 
-// parseRangeSource returns an iterator for different kinds of ranges
-func parseRangeSource(s string) (Iterator, error) {
-	s = strings.TrimSpace(s)
-
-	// 1. List style: item1|item2|item3
-	if strings.Contains(s, "|") {
-		items := strings.Split(s, "|")
-		cleanItems := make([]string, 0, len(items))
-		for _, item := range items {
-			trimmed := strings.TrimSpace(item)
-			if trimmed != "" {
-				cleanItems = append(cleanItems, trimmed)
-			}
-		}
-		return &listIterator{items: cleanItems}, nil
-	}
-
-	// 2. Multiple ranges with + : a..z+A..Z+0..9
-	if strings.Contains(s, "+") {
-		parts := strings.Split(s, "+")
-		iterators := make([]Iterator, 0, len(parts))
-		for _, part := range parts {
-			it, err := parseSingleRange(strings.TrimSpace(part))
-			if err != nil {
-				return nil, fmt.Errorf("invalid part %q: %v", part, err)
-			}
-			iterators = append(iterators, it)
-		}
-		return newChainIterator(iterators...), nil
-	}
-
-	// 3. Single range
-	return parseSingleRange(s)
-}
-
-// ────────────────────────────────────────────────────────────────────────────────
-// Chain Iterator (for a..z + 0..9 + !@# style)
-// ────────────────────────────────────────────────────────────────────────────────
-
-type chainIterator struct {
-	iterators []Iterator
-	current   int
-}
-
-func newChainIterator(iters ...Iterator) Iterator {
-	return &chainIterator{
-		iterators: iters,
-		current:   0,
-	}
-}
-
-func (it *chainIterator) Next() (string, bool) {
-	for it.current < len(it.iterators) {
-		val, ok := it.iterators[it.current].Next()
-		if ok {
-			return val, true
-		}
-		it.current++
-	}
-	return "", false
-}
-
-func (it *chainIterator) Len() int {
-	total := 0
-	for _, i := range it.iterators {
-		total += i.Len()
-	}
-	return total
-}
-
-func (it *chainIterator) Close() error {
-	for _, i := range it.iterators {
-		_ = i.Close() // best effort
-	}
-	return nil
-}
-
-// ────────────────────────────────────────────────────────────────────────────────
-// IP Range Iterator (full IPs: 192.168.1.1 .. 192.168.2.00)
-// ────────────────────────────────────────────────────────────────────────────────
-
-type ipRangeIterator struct {
-	start net.IP
-	end   net.IP
-	curr  net.IP
-}
-
-func newIPRangeIterator(start, end net.IP) Iterator {
-	// Make copies because net.IP is slice
-	curr := make(net.IP, len(start))
-	copy(curr, start)
-
-	return &ipRangeIterator{
-		start: start,
-		end:   end,
-		curr:  curr,
-	}
-}
-
-func (it *ipRangeIterator) Next() (string, bool) {
-	if bytes.Compare(it.curr, it.end) > 0 {
-		return "", false
-	}
-
-	result := it.curr.String()
-
-	// Increment IP
-	for i := len(it.curr) - 1; i >= 0; i-- {
-		it.curr[i]++
-		if it.curr[i] > 0 {
-			break
-		}
-		// carry over
-		it.curr[i] = 0
-	}
-
-	return result, true
-}
-
-func (it *ipRangeIterator) Len() int {
-	// Very rough estimate - good enough for progress bar
-	diff := ipToInt(it.end) - ipToInt(it.start)
-	if diff < 0 {
-		return 0
-	}
-	return int(diff) + 1
-}
-
-func (it *ipRangeIterator) Close() error { return nil }
-
-// Helper: IPv4 only!
-func ipToInt(ip net.IP) int64 {
-	ip = ip.To4()
-	if ip == nil {
-		return 0
-	}
-	return int64(ip[0])<<24 | int64(ip[1])<<16 | int64(ip[2])<<8 | int64(ip[3])
-}
-
-// ────────────────────────────────────────────────────────────────────────────────
-// Partial IP Range (last octet only)  e.g. 192.168.1.10..192.168.2.00
-// ────────────────────────────────────────────────────────────────────────────────
-
-type partialIPRangeIterator struct {
-	prefix string
-	start  int
-	end    int
-	curr   int
-}
-
-func newPartialIPRangeIterator(startStr, endStr string) (Iterator, error) {
-	// Assume format like: 192.168.1.   or  10.0.0.
-	// We expect startStr and endStr to be last octet numbers
-
-	// Very naive version - you can make it more robust later
-	start, err1 := strconv.Atoi(startStr)
-	if err1 != nil {
-		return nil, fmt.Errorf("invalid start octet: %v", err1)
-	}
-	end, err2 := strconv.Atoi(endStr)
-	if err2 != nil {
-		return nil, fmt.Errorf("invalid end octet: %v", err2)
-	}
-
-	// Guess prefix from startStr if possible
-	prefix := ""
-	if dot := strings.LastIndex(startStr, "."); dot != -1 {
-		prefix = startStr[:dot+1]
-	}
-
-	return &partialIPRangeIterator{
-		prefix: prefix,
-		start:  start,
-		end:    end,
-		curr:   start,
-	}, nil
-}
-
-func (it *partialIPRangeIterator) Next() (string, bool) {
-	if it.curr > it.end {
-		return "", false
-	}
-	ip := fmt.Sprintf("%s%d", it.prefix, it.curr)
-	it.curr++
-	return ip, true
-}
-
-func (it *partialIPRangeIterator) Len() int {
-	return it.end - it.curr + 1
-}
-
-func (it *partialIPRangeIterator) Close() error { return nil }
-
-// ────────────────────────────────────────────────────────────────────────────────
-// Character Range Iterator   a..z    or   0..9
-// ────────────────────────────────────────────────────────────────────────────────
-
-type charRangeIterator struct {
-	current byte
-	end     byte
-}
-
-func newCharRangeIterator(start, end byte) Iterator {
-	return &charRangeIterator{
-		current: start,
-		end:     end,
-	}
-}
-
-func (it *charRangeIterator) Next() (string, bool) {
-	if it.current > it.end {
-		return "", false
-	}
-	val := string(it.current)
-	it.current++
-	return val, true
-}
-
-func (it *charRangeIterator) Len() int {
-	return int(it.end - it.current + 1)
-}
-
-func (it *charRangeIterator) Close() error { return nil }
-
-func parseSingleRange(s string) (Iterator, error) {
-	if strings.Contains(s, "..") {
-		parts := strings.SplitN(s, "..", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid .. range format")
-		}
-		startStr, endStr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-
-		// Try IP range first
-		startIP := net.ParseIP(startStr)
-		if startIP != nil {
-			endIP := net.ParseIP(endStr)
-			if endIP != nil {
-				return newIPRangeIterator(startIP, endIP), nil
-			}
-			// Maybe last octet only?
-			if strings.HasPrefix(startStr, "192.168.") || strings.Contains(startStr, ".") {
-				return newPartialIPRangeIterator(startStr, endStr)
-			}
-		}
-
-		// Numeric range
-		start, err1 := strconv.Atoi(startStr)
-		end, err2 := strconv.Atoi(endStr)
-		if err1 == nil && err2 == nil {
-			return newNumericRangeIterator(start, end), nil
-		}
-
-		// Character range
-		if len(startStr) == 1 && len(endStr) == 1 {
-			return newCharRangeIterator(startStr[0], endStr[0]), nil
-		}
-	}
-
-	return nil, fmt.Errorf("unsupported range format: %s", s)
-}
-
-// ────────────────────────────────────────────────────────────────────────────────
-// Simple iterators implementations (you can put them in separate file)
-// ────────────────────────────────────────────────────────────────────────────────
-
-type listIterator struct {
-	items []string
-	idx   int
-}
-
-func (it *listIterator) Next() (string, bool) {
-	if it.idx >= len(it.items) {
-		return "", false
-	}
-	v := it.items[it.idx]
-	it.idx++
-	return v, true
-}
-func (it *listIterator) Len() int     { return len(it.items) }
-func (it *listIterator) Close() error { return nil }
-
-type numericRangeIterator struct {
-	current, end int
-}
-
-func newNumericRangeIterator(start, end int) *numericRangeIterator {
-	return &numericRangeIterator{current: start, end: end}
-}
-func (it *numericRangeIterator) Next() (string, bool) {
-	if it.current > it.end {
-		return "", false
-	}
-	v := fmt.Sprintf("%d", it.current)
-	it.current++
-	return v, true
-}
-func (it *numericRangeIterator) Len() int     { return it.end - it.current + 1 }
-func (it *numericRangeIterator) Close() error { return nil }
-
-// Add these yourself (similar style):
-// - newIPRangeIterator
-// - newPartialIPRangeIterator
-// - newCharRangeIterator
-// - newChainIterator (for + separated ranges)
-
-// executePipedCommandsForLoop handles pipes and returns output instead of printing
-func (cli *CLI) executePipedCommandsForLoop(input string) string {
-	parts := strings.Split(input, "|>")
-	if len(parts) < 2 {
-		return ""
-	}
-
-	var result string
-	var err error
-
-	// Execute first command
-	firstCmd := strings.TrimSpace(parts[0])
-	result, err = cli.executePipedCommand(firstCmd, "")
-	if err != nil {
-		return ""
-	}
-
-	// Execute remaining commands, passing output as input
-	for i := 1; i < len(parts); i++ {
-		nextCmd := strings.TrimSpace(parts[i])
-		result, err = cli.executePipedCommand(nextCmd, result)
-		if err != nil {
-			return ""
-		}
-	}
-
-	return result
-}
-
-// executePipedCommands handles piped commands with |> syntax
-// Example: whoami() |> sha256() or cat(file.txt) |> base64()
-func (cli *CLI) executePipedCommands(input string) {
-	parts := strings.Split(input, "|>")
-	if len(parts) < 2 {
-		return
-	}
-
-	var result string
-	var err error
-
-	// Execute first command
-	firstCmd := strings.TrimSpace(parts[0])
-	result, err = cli.executePipedCommand(firstCmd, "")
-	if err != nil {
-		core.PrintError(fmt.Sprintf("Pipe error in first command: %v", err))
-		return
-	}
-
-	// Execute remaining commands, passing output as input
-	for i := 1; i < len(parts); i++ {
-		nextCmd := strings.TrimSpace(parts[i])
-		result, err = cli.executePipedCommand(nextCmd, result)
-		if err != nil {
-			core.PrintError(fmt.Sprintf("Pipe error at step %d: %v", i+1, err))
-			return
-		}
-	}
-
-	// Only print result if the last command is not file() - file() handles its own output
-	lastCmd := strings.TrimSpace(parts[len(parts)-1])
-	if !strings.HasPrefix(lastCmd, "file(") {
-		fmt.Println()
-		fmt.Println(result)
-		fmt.Println()
-	}
-}
-
-// executePipedCommand executes a single command in a pipe chain
-// Supports: builtin(args), module, module arg=value
-func (cli *CLI) executePipedCommand(cmd string, input string) (string, error) {
-	cmd = strings.TrimSpace(cmd)
-
-	// Handle string literals in pipes: "\n", "\t", "text", etc.
-	if (strings.HasPrefix(cmd, "\"") && strings.HasSuffix(cmd, "\"")) ||
-		(strings.HasPrefix(cmd, "'") && strings.HasSuffix(cmd, "'")) {
-		// Remove quotes and process escape sequences
-		literal := cmd[1 : len(cmd)-1]
-
-		// Process escape sequences
-		literal = strings.ReplaceAll(literal, "\\n", "\n")
-		literal = strings.ReplaceAll(literal, "\\t", "\t")
-		literal = strings.ReplaceAll(literal, "\\r", "\r")
-		literal = strings.ReplaceAll(literal, "\\\\", "\\")
-
-		// String literals just pass through, potentially appending to input
-		return input + literal, nil
-	}
-
-	// If input from previous command, inject it appropriately
-	if input != "" {
-		// If command is a builtin function call
-		if strings.Contains(cmd, "(") && strings.Contains(cmd, ")") {
-			openParen := strings.Index(cmd, "(")
-			closeParen := strings.LastIndex(cmd, ")")
-			if openParen > 0 && closeParen > openParen {
-				funcName := cmd[:openParen]
-				args := cmd[openParen+1 : closeParen]
-				if args != "" {
-					args += ", \"" + input + "\""
-				} else {
-					args = "\"" + input + "\""
-				}
-				cmd = funcName + "(" + args + ")"
-			}
-		} else {
-			// It's a module call with potential arguments
-			// Check if there's an argument pattern like: modulename ip=$somevar
-			if strings.Contains(cmd, "=") {
-				// Module with specific arguments - find what argument to inject into
-				// If pattern is "module arg=$var", replace $var with input
-				if strings.Contains(cmd, "$") {
-					// Find the variable and replace it
-					parts := strings.Split(cmd, "=")
-					if len(parts) >= 2 {
-						// Replace the variable value with piped input
-						lastPart := parts[len(parts)-1]
-						if strings.HasPrefix(lastPart, "$") {
-							// Replace the variable
-							varName := strings.TrimSpace(lastPart)
-							cmd = strings.Replace(cmd, varName, "\""+input+"\"", 1)
-						} else {
-							// Append input as new argument
-							cmd = cmd + " input=\"" + input + "\""
-						}
-					}
-				} else {
-					// Append input as new argument
-					cmd = cmd + " input=\"" + input + "\""
-				}
-			} else {
-				// No arguments, just module name
-				cmd = cmd + " input=\"" + input + "\""
-			}
-		}
-	}
-
-	// Try to execute as module
-	parts := strings.Fields(cmd)
-	if len(parts) > 0 {
-		moduleName := parts[0]
-		args := parts[1:]
-
-		// Check if module exists
-		if _, err := cli.manager.GetModule(moduleName); err == nil {
-			// Execute module and capture output
-			return cli.executeModuleForPipe(moduleName, args)
-		}
-	}
-
-	return "", fmt.Errorf("invalid pipe command: %s", cmd)
-}
-
-// executeModuleForPipe executes a module and returns its output
-func (cli *CLI) executeModuleForPipe(moduleName string, args []string) (string, error) {
-	_, err := cli.manager.GetModule(moduleName)
-	if err != nil {
-		return "", err
-	}
-
-	// Parse arguments with support for variable expansion
-	moduleArgs := make(map[string]string)
-	parsedArgs := cli.parseArguments(args)
-
-	for key, value := range parsedArgs {
-		switch key {
-		case "threads", "save":
-			// Skip these
-		default:
-			moduleArgs[key] = value
-		}
-	}
-
-	// Merge global environment variables
-	for key, value := range cli.envMgr.GetAll() {
-		if _, exists := moduleArgs[key]; !exists {
-			moduleArgs[key] = value
-		}
-	}
-
-	// Save original stdout to restore later
-	saveOut := os.Stdout
-	reader, writer, err := os.Pipe()
-	if err != nil {
-		// Fallback: execute without capturing stdout
-		result, execErr := cli.manager.ExecuteModule(moduleName, moduleArgs)
-		if execErr != nil {
-			return "", execErr
-		}
-		return strings.TrimSpace(result.Output), nil
-	}
-
-	// Redirect stdout to our pipe
-	os.Stdout = writer
-
-	// Execute module
-	result, err := cli.manager.ExecuteModule(moduleName, moduleArgs)
-
-	// Restore stdout
-	writer.Close()
-	os.Stdout = saveOut
-
-	// Read captured stdout (not used but needed to drain the pipe)
-	_ = reader
-	reader.Close()
-
-	if err != nil {
-		return "", err
-	}
-
-	// Return the module output directly, which contains the structured output
-	return strings.TrimSpace(result.Output), nil
-}
-
 // parseAdvancedArguments parses function arguments with support for:
 // - Quoted strings (both "..." and '...')
 // - Nested builtins $(builtin args) and builtin() function call syntax
 // - Variable expansion $var
-// - Space-separated arguments
-func (cli *CLI) parseAdvancedArguments(argsStr string) []string {
+// - Space-separated arguments, and comma-separated ones when commas is set
+func (cli *CLI) parseAdvancedArguments(argsStr string, commas bool) ([]string, error) {
 	var args []string
 	var currentArg strings.Builder
+	quoted := false
 	i := 0
 
 	for i < len(argsStr) {
@@ -1519,6 +1031,7 @@ func (cli *CLI) parseAdvancedArguments(argsStr string) []string {
 		// Handle quoted strings
 		if ch == '"' || ch == '\'' {
 			quote := ch
+			quoted = true
 			i++ // skip opening quote
 			for i < len(argsStr) && argsStr[i] != quote {
 				if argsStr[i] == '\\' && i+1 < len(argsStr) {
@@ -1534,6 +1047,21 @@ func (cli *CLI) parseAdvancedArguments(argsStr string) []string {
 			continue
 		}
 
+		// Handle nested builtins: $(name args), whose result is taken verbatim
+		if cli.builtinCallName(argsStr, i) != "" {
+			end := cli.findMatchingParen(argsStr, i+2)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed $( in %q", argsStr)
+			}
+			result, err := cli.evalBuiltin(argsStr[i+2 : end])
+			if err != nil {
+				return nil, err
+			}
+			currentArg.WriteString(result)
+			i = end + 1
+			continue
+		}
+
 		// Handle variable expansion: $varname
 		if ch == '$' && i+1 < len(argsStr) && isValidVarChar(rune(argsStr[i+1])) {
 			i++ // skip $
@@ -1547,24 +1075,14 @@ func (cli *CLI) parseAdvancedArguments(argsStr string) []string {
 			continue
 		}
 
-		// Handle comma-separated arguments
-		if ch == ',' {
+		// Handle separators: spaces, and commas in function call syntax
+		if ch == ' ' || (ch == ',' && commas) {
 			arg := strings.TrimSpace(currentArg.String())
-			if arg != "" {
-				args = append(args, arg)
-			}
-			currentArg.Reset()
-			i++
-			continue
-		}
-
-		// Handle spaces (space-separated arguments)
-		if ch == ' ' {
-			arg := strings.TrimSpace(currentArg.String())
-			if arg != "" {
+			if arg != "" || quoted {
 				args = append(args, arg)
 			}
 			currentArg.Reset()
+			quoted = false
 			i++
 			continue
 		}
@@ -1575,11 +1093,11 @@ func (cli *CLI) parseAdvancedArguments(argsStr string) []string {
 
 	// Add final argument
 	arg := strings.TrimSpace(currentArg.String())
-	if arg != "" {
+	if arg != "" || quoted {
 		args = append(args, arg)
 	}
 
-	return args
+	return args, nil
 }
 
 // isValidVarChar checks if a rune is valid in a variable name
@@ -1646,3 +1164,55 @@ func (cli *CLI) expandVariable(varName string) string {
 	}
 	return "$" + varName
 }
+
+// out returns the writer of the command's output
+func (cli *CLI) out() io.Writer {
+	cli.outMu.Lock()
+	defer cli.outMu.Unlock()
+	if cli.stdout == nil {
+		return os.Stdout
+	}
+	return cli.stdout
+}
+
+// errOut returns the writer of the command's errors
+func (cli *CLI) errOut() io.Writer {
+	cli.outMu.Lock()
+	defer cli.outMu.Unlock()
+	if cli.stderr == nil {
+		return os.Stderr
+	}
+	return cli.stderr
+}
+
+// setOutput points the CLI's writers at stdout and stderr, nil is the terminal
+func (cli *CLI) setOutput(stdout, stderr io.Writer) {
+	cli.outMu.Lock()
+	cli.stdout, cli.stderr = stdout, stderr
+	cli.outMu.Unlock()
+}
+
+// printSuccess prints a success message to the command's output
+func (cli *CLI) printSuccess(msg string) {
+	core.FprintSuccess(cli.out(), msg)
+}
+
+// printError prints an error message to the command's output
+func (cli *CLI) printError(msg string) {
+	core.FprintError(cli.out(), msg)
+}
+
+// printInfo prints an info message to the command's output
+func (cli *CLI) printInfo(msg string) {
+	core.FprintInfo(cli.out(), msg)
+}
+
+// printDebug prints a debug message to the command's output
+func (cli *CLI) printDebug(msg string) {
+	core.FprintDebug(cli.out(), msg)
+}
+
+// printWarning prints a warning to the command's output
+func (cli *CLI) printWarning(msg string) {
+	core.FprintWarning(cli.out(), msg)
+}
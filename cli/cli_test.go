@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testModule is a module written into the modules directory of a test CLI
+type testModule struct {
+	yaml   string // module.yaml
+	script string // main.sh
+}
+
+// newTestCLI returns a CLI with its own home, working directory and the given bash modules
+func newTestCLI(t *testing.T, modules map[string]testModule) *CLI {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, "modules")
+	for name, m := range modules {
+		moduleDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(moduleDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(moduleDir, "module.yaml"), []byte("name: "+name+"\ntype: bash\n"+m.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(moduleDir, "main.sh"), []byte(m.script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cli := NewCLI([]string{dir})
+	if err := cli.manager.DiscoverModules(); err != nil {
+		t.Fatal(err)
+	}
+	cli.currentDirectory = t.TempDir()
+	t.Cleanup(cli.closeWorkspace)
+	return cli
+}
@@ -15,9 +15,9 @@ import (
 
 // PrintHelp prints available commands
 func (cli *CLI) PrintHelp() {
-	fmt.Println()
-	color.New(color.FgCyan, color.Bold).Println("Available Commands:")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	color.New(color.FgCyan, color.Bold).Fprintln(cli.out(), "Available Commands:")
+	fmt.Fprintln(cli.out())
 
 	commands := []struct {
 		name string
@@ -36,9 +36,23 @@ func (cli *CLI) PrintHelp() {
 		{"env, envs", "Display all global environment variables (alias: envs)"},
 		{"key=value", "Set persistent global environment variable (ex: timeout=30)"},
 		{"key=?", "View value of a global variable (ex: timeout=?)"},
-		{"create <name> [python|bash]", "Create new module (ex: create exploit python)"},
+		{"create <name> [type]", "Create new module, python by default (ex: create exploit bash)"},
 		{"edit <module>", "Edit module source code (ex: edit myexploit)"},
 		{"delete, rm <module>", "Delete a module (ex: delete myexploit)"},
+		{"<module> [args...] &", "Run module as a background job (also: run -j [args...])"},
+		{"jobs [-o <id>] [-k <id>]", "List background jobs, show a job's output (-o) or kill it (-k)"},
+		{"fg [id]", "Follow a running job's live output, Ctrl+C detaches (ex: fg 1)"},
+		{"checkpoints [-d <id>|all]", "List checkpoints of interrupted loops and threads= runs, or delete them"},
+		{"resume <id> [--failed]", "Continue a checkpointed run with its unfinished (and failed) items"},
+		{"module deps <install|rebuild|clean> <m>", "Manage the virtualenv of a Python module with requirements (ex: module deps rebuild webscan)"},
+		{"doctor [module...]", "Check the interpreters, tools and packages modules require (ex: doctor portscan)"},
+		{"wrapper [sudo|proxychains|tor|nice|<cmd>|off]", "Run every module under a command, or one run with wrap= (ex: portscan host=$ip wrap=sudo)"},
+		{"source <script.lmv>", "Run a script with if/else, while, func, include and set -e (ex: source scan.lmv)"},
+		{"builtins", "List builtin functions for $(...) and pipes (ex: $(sha256 $(cat key.txt)))"},
+		{"workspace [list|create|use|delete]", "Manage workspaces that record every run (ex: workspace create acme)"},
+		{"hosts, services [filters]", "List hosts/services seen in findings (ex: services port=22)"},
+		{"findings [filters] [-o file]", "List findings, export with -o (ex: findings severity=high -o out.csv)"},
+		{"runs [filters] | runs show <id>", "List recorded runs or show one with its output (ex: runs module=portscan)"},
 		{"history", "Show command history"},
 		{"clear, cls", "Clear the terminal screen (alias: cls)"},
 		{"refresh, reload", "Reload/refresh all modules from disk"},
@@ -47,16 +61,16 @@ func (cli *CLI) PrintHelp() {
 	}
 
 	for _, cmd := range commands {
-		fmt.Printf("  %s%-34s %s\n",
+		fmt.Fprintf(cli.out(), "  %s%-34s %s\n",
 			color.GreenString(""),
 			color.CyanString(cmd.name),
 			cmd.desc,
 		)
 	}
 
-	fmt.Println()
-	color.New(color.FgWhite, color.Bold).Println("Advanced Argument Features:")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	color.New(color.FgWhite, color.Bold).Fprintln(cli.out(), "Advanced Argument Features:")
+	fmt.Fprintln(cli.out())
 
 	advancedFeatures := []struct {
 		name string
@@ -67,28 +81,36 @@ func (cli *CLI) PrintHelp() {
 		{"Variable Expansion", "Use $var_name: run module target=$mytarget (from global env or system env)."},
 		{"Builtin Functions", "Execute builtins in args: run module pwd=$(pwd) hash=$(sha256 password)."},
 		{"Combined Usage", "Mix variables and builtins: run module path=$workdir sig=$(sha256 $password)."},
+		{"Chaining", "Combine commands with ; && || and &: portscan host=$ip && echo open || echo closed. Quote ; to keep it in an argument."},
+		{"Redirection", "Send output to files: portscan host=$ip > scan.txt, 2> errors.txt, &> all.txt, >> to append, |> tee [-a] scan.txt to also show it."},
+		{"Pipelines", "Chain stages with |>: $ cat hosts.txt |> sort_hosts |> sha256() |> file(out.txt). Modules get the input on stdin (and as input= if declared)."},
 		{"Save Output", "Save module execution to log file: module_name arg=value save=1 ."},
-		{"Threaded Execution", "Run module with multiple threads: module_name arg=value threads=5 ."},
+		{"Threaded Execution", "Split a list across workers: module host=@targets.txt threads=10 (or host=10.0.0.1..254), ordered=1 keeps input order."},
+		{"Timeouts", "Stop a module after a duration (30s, 5m, or seconds): module_name arg=value timeout=30s ."},
+		{"For Loops", "Repeat a command over a range or list: for ip in 10.0.0.1..254 -> portscan host=$ip (also 10.0.0.0/24:hosts, 10.0.1-3.*, 0..100:5, 001..100)."},
+		{"Multi-Variable Loops", "Bind several variables: for host,port in @hosts.txt x 22|80|443 -> ... or for u,p in zip(@users.txt, @pass.txt) -> ..."},
+		{"Wordlists", "Stream huge or gzipped lists: for pw in @rockyou.txt.gz dedup=yes skip=1000 limit=500 -> ... (@- reads stdin)."},
+		{"Parallel Loops", "Add parallel=N, rate=10/s, delay=, jitter= and on-error=stop|continue before the -> ."},
 		{"Log Location", "Output files saved to ./logs/ with timestamp: module_2006-01-02_15-04-05.log ."},
 	}
 
 	for _, feat := range advancedFeatures {
-		fmt.Printf("  %s%-20s %s\n",
+		fmt.Fprintf(cli.out(), "  %s%-20s %s\n",
 			color.BlueString("- "),
 			color.CyanString(feat.name),
 			feat.desc,
 		)
 	}
 
-	fmt.Println()
-	color.New(color.FgWhite, color.Bold).Println("Variable & Function Examples:")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	color.New(color.FgWhite, color.Bold).Fprintln(cli.out(), "Variable & Function Examples:")
+	fmt.Fprintln(cli.out())
 
 	varExamples := []string{
 		"Set global var:      myhost=192.168.1.1",
 		"View global var:     myhost=?",
 		"Expand in module:    run scanner target=$myhost",
-		"Builtin function:    run hasher data=$(echo \"hello world\")",
+		"Builtin function:    run hasher data=$(upper \"hello world\")",
 		"Combine both:        run crypto key=$(sha256 $password) iv=$(pwd)",
 		"Network info:        run netmod local=$(ipaddr) host=$(hostname)",
 		"Timestamp:           run logger timestamp=$(timestamp unix) save=1",
@@ -96,12 +118,12 @@ func (cli *CLI) PrintHelp() {
 	}
 
 	for _, example := range varExamples {
-		fmt.Printf("  %s\n", color.GreenString(example))
+		fmt.Fprintf(cli.out(), "  %s\n", color.GreenString(example))
 	}
 
-	fmt.Println()
-	color.New(color.FgWhite, color.Bold).Println("Shell Commands (prefix with $):")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	color.New(color.FgWhite, color.Bold).Fprintln(cli.out(), "Shell Commands (prefix with $):")
+	fmt.Fprintln(cli.out())
 
 	shellExamples := []string{
 		"$ ls -la                      (Execute shell command)",
@@ -112,12 +134,12 @@ func (cli *CLI) PrintHelp() {
 	}
 
 	for _, example := range shellExamples {
-		fmt.Printf("  %s\n", color.YellowString(example))
+		fmt.Fprintf(cli.out(), "  %s\n", color.YellowString(example))
 	}
 
-	fmt.Println()
-	color.New(color.FgWhite, color.Bold).Println("Quick Examples:")
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	color.New(color.FgWhite, color.Bold).Fprintln(cli.out(), "Quick Examples:")
+	fmt.Fprintln(cli.out())
 
 	examples := []string{
 		"arp-spoofer interface=eth0 target=\"192.168.1.100\" save=1",
@@ -128,10 +150,10 @@ func (cli *CLI) PrintHelp() {
 	}
 
 	for _, example := range examples {
-		fmt.Printf("  - %s\n", color.CyanString(example))
+		fmt.Fprintf(cli.out(), "  - %s\n", color.CyanString(example))
 	}
 
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 }
 
 // formatModuleLine formats a single module line for display
@@ -170,13 +192,13 @@ func (cli *CLI) formatModuleLine(module *core.ModuleConfig, index int, total int
 func (cli *CLI) ListModules() {
 	modules := cli.manager.ListModules()
 	if len(modules) == 0 {
-		core.PrintWarning("No modules loaded. Check the modules directory or specify it with: lanmanvan -modules <path>")
-		fmt.Println()
+		cli.printWarning("No modules loaded. Check the modules directory or specify it with: lanmanvan -modules <path>")
+		fmt.Fprintln(cli.out())
 		return
 	}
 
-	fmt.Println()
-	fmt.Println(core.NmapBox(fmt.Sprintf("AVAILABLE MODULES (%d)", len(modules))))
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("AVAILABLE MODULES (%d)", len(modules))))
 
 	// Sort modules by name
 	sort.Slice(modules, func(i, j int) bool {
@@ -184,12 +206,12 @@ func (cli *CLI) ListModules() {
 	})
 
 	for i, module := range modules {
-		fmt.Println(cli.formatModuleLine(module, i, len(modules)))
+		fmt.Fprintln(cli.out(), cli.formatModuleLine(module, i, len(modules)))
 	}
 
-	fmt.Println()
-	core.PrintSuccess(fmt.Sprintf("Total: %d modules loaded", len(modules)))
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	cli.printSuccess(fmt.Sprintf("Total: %d modules loaded", len(modules)))
+	fmt.Fprintln(cli.out())
 }
 
 // SearchModules searches modules by keyword with highlighting
@@ -223,7 +245,7 @@ func (cli *CLI) SearchModules(keyword string) {
 	}
 
 	if len(results) == 0 {
-		core.PrintWarning(fmt.Sprintf("No modules found for '%s', skipping...", keyword))
+		cli.printWarning(fmt.Sprintf("No modules found for '%s', skipping...", keyword))
 		return
 	}
 
@@ -232,16 +254,16 @@ func (cli *CLI) SearchModules(keyword string) {
 		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
 	})
 
-	fmt.Println()
-	fmt.Println(core.NmapBox(fmt.Sprintf("SEARCH: %s (%d results)", keyword, len(results))))
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("SEARCH: %s (%d results)", keyword, len(results))))
 
 	for i, module := range results {
-		fmt.Println(cli.formatModuleLineWithHighlight(module, i, len(results), keyword))
+		fmt.Fprintln(cli.out(), cli.formatModuleLineWithHighlight(module, i, len(results), keyword))
 	}
 
-	fmt.Println()
-	core.PrintSuccess(fmt.Sprintf("Found %d module(s)", len(results)))
-	fmt.Println()
+	fmt.Fprintln(cli.out())
+	cli.printSuccess(fmt.Sprintf("Found %d module(s)", len(results)))
+	fmt.Fprintln(cli.out())
 }
 
 // formatModuleLineWithHighlight formats a module line with keyword highlighting
@@ -309,36 +331,50 @@ func (cli *CLI) highlightKeyword(text, keyword string) string {
 func (cli *CLI) ShowModuleInfo(moduleName string, showREADME int) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Error: %v, skipping...", err))
+		cli.printError(fmt.Sprintf("Error: %v, skipping...", err))
 		return
 	}
 
-	fmt.Println()
-	fmt.Println(core.NmapBox(fmt.Sprintf("MODULE: %s", moduleName)))
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("MODULE: %s", moduleName)))
 
 	if module.Metadata != nil {
 		meta := module.Metadata
-		fmt.Printf("   ├─ %s %s\n", color.WhiteString("Description:"), color.WhiteString(meta.Description))
-		fmt.Printf("   ├─ %s %s\n", color.WhiteString("Type:"), cli.getTypeBadge(meta.Type))
-		fmt.Printf("   ├─ %s %s\n", color.WhiteString("Author:"), color.RedString(meta.Author))
-		fmt.Printf("   ├─ %s %s\n", color.WhiteString("Version:"), color.MagentaString(meta.Version))
+		fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Description:"), color.WhiteString(meta.Description))
+		fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Type:"), cli.getTypeBadge(meta.Type))
+		fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Author:"), color.RedString(meta.Author))
+		fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Version:"), color.MagentaString(meta.Version))
 
 		if len(meta.Tags) > 0 {
-			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Tags:"), color.CyanString(strings.Join(meta.Tags, ", ")))
+			fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Tags:"), color.CyanString(strings.Join(meta.Tags, ", ")))
 		}
 
 		// Display GitHub and X URLs
 		if meta.GitHubURL != "" || meta.XUrl != "" {
 			if meta.GitHubURL != "" {
-				fmt.Printf("   ├─ %s %s\n", color.WhiteString("GitHub:"), color.BlueString(meta.GitHubURL))
+				fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("GitHub:"), color.BlueString(meta.GitHubURL))
 			}
 			if meta.XUrl != "" {
-				fmt.Printf("   ├─ %s %s\n", color.WhiteString("X/Twitter:"), color.BlueString(meta.XUrl))
+				fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("X/Twitter:"), color.BlueString(meta.XUrl))
 			}
 		}
 
+		if venv := venvStatus(module); venv != "" {
+			fmt.Fprintf(cli.out(), "   ├─ %s %s\n", color.WhiteString("Venv:"), venv)
+		}
+
+		checks := cli.manager.CheckDependencies(module)
+		if len(checks) > 0 {
+			branch, indent := "├─", "   │  "
+			if len(meta.Options) == 0 {
+				branch, indent = "└─", "      "
+			}
+			fmt.Fprintf(cli.out(), "   %s %s\n", branch, color.WhiteString("Requires:"))
+			printDependencies(cli.out(), checks, indent)
+		}
+
 		if len(meta.Options) > 0 {
-			fmt.Printf("   └─ %s\n", color.WhiteString("Options:"))
+			fmt.Fprintf(cli.out(), "   └─ %s\n", color.WhiteString("Options:"))
 
 			// Sort option names for consistent output
 			optNames := make([]string, 0, len(meta.Options))
@@ -361,25 +397,32 @@ func (cli *CLI) ShowModuleInfo(moduleName string, showREADME int) {
 					childPrefix = "          └─ "
 				}
 
-				fmt.Printf("%s%s %s%s\n",
+				fmt.Fprintf(cli.out(), "%s%s %s%s\n",
 					prefix,
 					color.GreenString(optName),
 					color.WhiteString(fmt.Sprintf("(%s)", opt.Type)),
 					required,
 				)
-				fmt.Printf("%s%s\n", childPrefix, color.WhiteString(opt.Description))
+				details := opt.Description
+				if len(opt.Choices) > 0 {
+					details += color.CyanString(fmt.Sprintf(" [choices: %s]", strings.Join(opt.Choices, ", ")))
+				}
+				if opt.Default != "" {
+					details += color.YellowString(fmt.Sprintf(" (default: %s)", opt.Default))
+				}
+				fmt.Fprintf(cli.out(), "%s%s\n", childPrefix, color.WhiteString(details))
 			}
 		}
 	} else {
-		fmt.Printf("   └─ %s %s\n", color.WhiteString("Type:"), cli.getTypeBadge(module.Type))
-		fmt.Println("   (No metadata available) ")
+		fmt.Fprintf(cli.out(), "   └─ %s %s\n", color.WhiteString("Type:"), cli.getTypeBadge(module.Type))
+		fmt.Fprintln(cli.out(), "   (No metadata available) ")
 	}
 
 	// Display README as "About This Module"
 	if showREADME == 1 {
 		cli.displayReadme(moduleName, module)
 	}
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 }
 
 // displayReadme reads and displays the README.md as "About This Module"
@@ -409,8 +452,8 @@ func (cli *CLI) displayReadme(moduleName string, module *core.ModuleConfig) {
 		return
 	}
 
-	fmt.Println()
-	fmt.Println(core.NmapBox("ABOUT THIS MODULE"))
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox("ABOUT THIS MODULE"))
 
 	// Create markdown renderer
 	renderer := NewMarkdownRenderer()
@@ -435,9 +478,9 @@ func (cli *CLI) displayReadme(moduleName string, module *core.ModuleConfig) {
 				// End code block
 				inCodeBlock = false
 				if len(codeBlockContent) > 0 {
-					fmt.Println()
-					fmt.Println(renderer.RenderCodeBlock(strings.Join(codeBlockContent, "\n"), codeBlockLang))
-					fmt.Println()
+					fmt.Fprintln(cli.out())
+					fmt.Fprintln(cli.out(), renderer.RenderCodeBlock(strings.Join(codeBlockContent, "\n"), codeBlockLang))
+					fmt.Fprintln(cli.out())
 				}
 				codeBlockContent = []string{}
 			}
@@ -448,26 +491,26 @@ func (cli *CLI) displayReadme(moduleName string, module *core.ModuleConfig) {
 			codeBlockContent = append(codeBlockContent, line)
 		} else {
 			if line == "" {
-				fmt.Println()
+				fmt.Fprintln(cli.out())
 			} else {
 				renderedLine := renderer.renderLine(line)
-				fmt.Printf("   %s\n", renderedLine)
+				fmt.Fprintf(cli.out(), "   %s\n", renderedLine)
 			}
 		}
 	}
 
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 }
 
 // PrintHistory shows command history
 func (cli *CLI) PrintHistory() {
 	if len(cli.history) == 0 {
-		core.PrintWarning("No command history, skipping...")
+		cli.printWarning("No command history, skipping...")
 		return
 	}
 
-	fmt.Println()
-	fmt.Println(core.NmapBox(fmt.Sprintf("COMMAND HISTORY (%d)", len(cli.history))))
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("COMMAND HISTORY (%d)", len(cli.history))))
 
 	for i, cmd := range cli.history {
 		prefix := "   ├─ "
@@ -475,14 +518,14 @@ func (cli *CLI) PrintHistory() {
 			prefix = "   └─ "
 		}
 
-		fmt.Printf("%s%s %s\n",
+		fmt.Fprintf(cli.out(), "%s%s %s\n",
 			prefix,
 			color.GreenString(fmt.Sprintf("[%d]", i+1)),
 			color.WhiteString(cmd),
 		)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 }
 
 func HighlightPurple(text string, keyword string) string {
@@ -525,14 +568,10 @@ func HighlightPurple(text string, keyword string) string {
 
 // getTypeBadge returns a colored badge for module type
 func (cli *CLI) getTypeBadge(moduleType string) string {
-	switch moduleType {
-	case "python":
-		return color.BlueString("[PY]")
-	case "bash":
-		return color.CyanString("[SH]")
-	case "go":
-		return color.MagentaString("[GO]")
-	default:
+	rt := core.LookupRuntime(moduleType)
+	if rt == nil {
 		return color.WhiteString("[??]")
 	}
+	label, badgeColor := rt.Badge()
+	return core.Color(badgeColor, "["+label+"]")
 }
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Doctor checks the dependencies of every module, or prints the full report of one
+func (cli *CLI) Doctor(args []string) {
+	if len(args) > 0 {
+		for _, name := range args {
+			module, err := cli.manager.GetModule(name)
+			if err != nil {
+				cli.printError(err.Error())
+				cli.lastExitCode = 1
+				continue
+			}
+			fmt.Fprintln(cli.out())
+			fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("DEPENDENCIES: %s", name)))
+			checks := cli.manager.CheckDependencies(module)
+			printDependencies(cli.out(), checks, "   ")
+			if len(core.FailedDependencies(checks)) > 0 {
+				cli.lastExitCode = 1
+			}
+		}
+		fmt.Fprintln(cli.out())
+		return
+	}
+
+	modules := cli.manager.ListModules()
+	fmt.Fprintln(cli.out())
+	cli.printInfo(fmt.Sprintf("lmv %s, checking %d module(s)...", core.Version, len(modules)))
+	fmt.Fprintln(cli.out())
+
+	table := core.NewTable([]string{"Module", "Type", "Status", "Problems"})
+	broken := 0
+	for _, module := range modules {
+		if !module.Loaded {
+			table.AddRow(module.Name, module.Type, core.Color("red", "not loaded"), module.LoadError)
+			broken++
+			continue
+		}
+		failed := core.FailedDependencies(cli.manager.CheckDependencies(module))
+		if len(failed) == 0 {
+			table.AddRow(module.Name, module.Type, core.Color("green", "ready"), "")
+			continue
+		}
+		problems := make([]string, len(failed))
+		for i, d := range failed {
+			problems[i] = fmt.Sprintf("%s: %s", d.String(), d.Problem)
+		}
+		table.AddRow(module.Name, module.Type, core.Color("red", "missing"), strings.Join(problems, "; "))
+		broken++
+	}
+	fmt.Fprint(cli.out(), table.Render())
+	fmt.Fprintln(cli.out())
+
+	if broken > 0 {
+		cli.printWarning(fmt.Sprintf("%d of %d module(s) can't run, 'doctor <module>' shows the details", broken, len(modules)))
+		cli.lastExitCode = 1
+	} else {
+		cli.printSuccess("All modules have their dependencies")
+	}
+	fmt.Fprintln(cli.out())
+}
+
+// printDependencies prints a ✓/✗ line per dependency check
+func printDependencies(w io.Writer, checks []core.DependencyCheck, indent string) {
+	for i, d := range checks {
+		branch := "├─"
+		if i == len(checks)-1 {
+			branch = "└─"
+		}
+
+		line := fmt.Sprintf("%s %s", core.Color("white", d.Kind), d.String())
+		if d.OK {
+			if d.Found != "" {
+				line += core.Color("cyan", fmt.Sprintf(" (%s)", d.Found))
+			}
+			fmt.Fprintf(w, "%s%s %s %s\n", indent, branch, core.Color("green", "✓"), line)
+		} else {
+			fmt.Fprintf(w, "%s%s %s %s %s\n", indent, branch, core.Color("red", "✗"), line, core.Color("red", "- "+d.Problem))
+		}
+	}
+}
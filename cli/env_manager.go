@@ -3,6 +3,7 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 // EnvironmentManager handles global environment variables
 type EnvironmentManager struct {
 	vars     map[string]string
+	locals   []map[string]string // arguments of the script functions being called, innermost last
 	filePath string
 }
 
@@ -31,29 +33,88 @@ func NewEnvironmentManager() *EnvironmentManager {
 	return em
 }
 
-// Set sets a global environment variable
+// Set sets a global environment variable, or a function argument of that name
 func (em *EnvironmentManager) Set(key, value string) error {
+	if frame := em.localFrame(key); frame != nil {
+		frame[key] = value
+		return nil
+	}
 	em.vars[key] = value
 	return em.Save()
 }
 
-// Get retrieves a global environment variable
+// Get retrieves a function argument or a global environment variable
 func (em *EnvironmentManager) Get(key string) (string, bool) {
+	if frame := em.localFrame(key); frame != nil {
+		return frame[key], true
+	}
 	val, exists := em.vars[key]
 	return val, exists
 }
 
-// GetAll returns all environment variables
+// GetAll returns all environment variables, function arguments included
 func (em *EnvironmentManager) GetAll() map[string]string {
-	return em.vars
+	if len(em.locals) == 0 {
+		return em.vars
+	}
+	all := make(map[string]string, len(em.vars))
+	for k, v := range em.vars {
+		all[k] = v
+	}
+	for _, frame := range em.locals {
+		for k, v := range frame {
+			all[k] = v
+		}
+	}
+	return all
 }
 
 // Delete removes an environment variable
 func (em *EnvironmentManager) Delete(key string) error {
+	if frame := em.localFrame(key); frame != nil {
+		delete(frame, key)
+		return nil
+	}
 	delete(em.vars, key)
 	return em.Save()
 }
 
+// PushLocals binds the arguments of a script function call. They shadow global
+// variables of the same name until PopLocals and are never saved.
+func (em *EnvironmentManager) PushLocals(vars map[string]string) {
+	em.locals = append(em.locals, vars)
+}
+
+// PopLocals drops the arguments of the innermost function call
+func (em *EnvironmentManager) PopLocals() {
+	em.locals = em.locals[:len(em.locals)-1]
+}
+
+// LocalEnv returns the bound function arguments as KEY=value pairs for a shell
+func (em *EnvironmentManager) LocalEnv() []string {
+	bound := make(map[string]string)
+	for _, frame := range em.locals {
+		for k, v := range frame {
+			bound[k] = v
+		}
+	}
+	env := make([]string, 0, len(bound))
+	for k, v := range bound {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// localFrame returns the innermost function call binding key, or nil
+func (em *EnvironmentManager) localFrame(key string) map[string]string {
+	for i := len(em.locals) - 1; i >= 0; i-- {
+		if _, ok := em.locals[i][key]; ok {
+			return em.locals[i]
+		}
+	}
+	return nil
+}
+
 // Save persists environment variables to JSON file
 func (em *EnvironmentManager) Save() error {
 	data, err := json.MarshalIndent(em.vars, "", "  ")
@@ -84,15 +145,15 @@ func (em *EnvironmentManager) Clear() error {
 }
 
 // Display shows all environment variables
-func (em *EnvironmentManager) Display() {
+func (em *EnvironmentManager) Display(w io.Writer) {
 	if len(em.vars) == 0 {
-		core.PrintWarning("No global environment variables set, use '<key> = <value>' to add some, or type '<key>=?' to view its value")
-		fmt.Println()
+		core.FprintWarning(w, "No global environment variables set, use '<key> = <value>' to add some, or type '<key>=?' to view its value")
+		fmt.Fprintln(w)
 		return
 	}
 
-	fmt.Println()
-	fmt.Println(core.NmapBox("GLOBAL ENVIRONMENT VARIABLES"))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, core.NmapBox("GLOBAL ENVIRONMENT VARIABLES"))
 
 	i := 0
 	for key, value := range em.vars {
@@ -101,7 +162,7 @@ func (em *EnvironmentManager) Display() {
 		if i == len(em.vars) {
 			prefix = "   └─ "
 		}
-		fmt.Printf("%s%s = %s\n", prefix, core.Color("cyan", key), core.Color("green", value))
+		fmt.Fprintf(w, "%s%s = %s\n", prefix, core.Color("cyan", key), core.Color("green", value))
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
@@ -0,0 +1,713 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Iterator represents something that can produce values one by one
+type Iterator interface {
+	Next() (string, bool) // value, ok
+	Len() int             // items still to come (for progress)
+	Close() error         // optional cleanup
+}
+
+// parseRangeSource returns an iterator for different kinds of ranges
+//
+//	a|b|c              list
+//	1..100  100..1     numeric, forward or reverse
+//	0..100:5           stepped
+//	001..100           zero-padded
+//	a..z               characters
+//	10.0.0.1..10.0.1.5 IPv4 or IPv6 address range
+//	10.0.0.1..254      IPv4 range, the end replaces the last octet(s)
+//	10.0.0.0/24        CIDR block, every address (10.0.0.0/24:hosts skips network/broadcast)
+//	2001:db8::/120     IPv6 prefix
+//	10.0.1-3.*         octet-wise glob
+//	a..z+0..9          several of the above chained with +
+func parseRangeSource(s string) (Iterator, error) {
+	s = strings.TrimSpace(s)
+
+	// 1. List style: item1|item2|item3
+	if strings.Contains(s, "|") {
+		items := strings.Split(s, "|")
+		cleanItems := make([]string, 0, len(items))
+		for _, item := range items {
+			trimmed := strings.TrimSpace(item)
+			if trimmed != "" {
+				cleanItems = append(cleanItems, trimmed)
+			}
+		}
+		return &listIterator{items: cleanItems}, nil
+	}
+
+	// 2. Multiple ranges with + : a..z+A..Z+0..9
+	if strings.Contains(s, "+") {
+		parts := strings.Split(s, "+")
+		iterators := make([]Iterator, 0, len(parts))
+		for _, part := range parts {
+			it, err := parseSingleRange(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid part %q: %v", part, err)
+			}
+			iterators = append(iterators, it)
+		}
+		return newChainIterator(iterators...), nil
+	}
+
+	// 3. Single range
+	return parseSingleRange(s)
+}
+
+// isRangeExpr reports whether s looks like a range rather than a plain value,
+// without treating paths or URLs (which may contain .. or /) as ranges
+func isRangeExpr(s string) bool {
+	if strings.Contains(s, "..") || octetGlobPattern.MatchString(s) {
+		_, err := parseRangeSource(s)
+		return err == nil
+	}
+	if strings.Contains(s, "/") {
+		_, err := parseCIDR(s)
+		return err == nil
+	}
+	return false
+}
+
+// steppedRangePattern matches numeric ranges with an optional step: 1..10, 10..1, 0..100:5
+var steppedRangePattern = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)(?::(\d+))?$`)
+
+// octetGlobPattern matches IPv4 globs where each octet is n, a-b, a,b or *
+var octetGlobPattern = regexp.MustCompile(`^(\*|\d{1,3}(-\d{1,3})?(,\d{1,3}(-\d{1,3})?)*)(\.(\*|\d{1,3}(-\d{1,3})?(,\d{1,3}(-\d{1,3})?)*)){3}$`)
+
+func parseSingleRange(s string) (Iterator, error) {
+	// CIDR blocks and IPv6 prefixes
+	if strings.Contains(s, "/") {
+		return parseCIDR(s)
+	}
+
+	// Octet globs: 10.0.1-3.*  192.168.1,3.1-10
+	if octetGlobPattern.MatchString(s) && strings.ContainsAny(s, "*-,") {
+		return newOctetGlobIterator(s)
+	}
+
+	// Numeric, possibly stepped, reversed or zero-padded
+	if m := steppedRangePattern.FindStringSubmatch(s); m != nil {
+		start, _ := strconv.Atoi(m[1])
+		end, _ := strconv.Atoi(m[2])
+		step := 1
+		if m[3] != "" {
+			step, _ = strconv.Atoi(m[3])
+			if step <= 0 {
+				return nil, fmt.Errorf("step must be positive")
+			}
+		}
+		return newNumericRangeIterator(start, end, step, paddingWidth(m[1], m[2])), nil
+	}
+
+	if strings.Contains(s, "..") {
+		parts := strings.SplitN(s, "..", 2)
+		startStr, endStr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		// Address ranges, IPv4 or IPv6
+		if startAddr, err := netip.ParseAddr(startStr); err == nil {
+			if endAddr, err := netip.ParseAddr(endStr); err == nil {
+				if startAddr.Is4() != endAddr.Is4() {
+					return nil, fmt.Errorf("cannot mix IPv4 and IPv6 in a range")
+				}
+				return newAddrRangeIterator(startAddr, endAddr), nil
+			}
+			// 10.0.0.1..254 or 10.0.0.1..1.254: the end replaces the trailing octets
+			if startAddr.Is4() {
+				endAddr, err := completeIPv4(startAddr, endStr)
+				if err != nil {
+					return nil, err
+				}
+				return newAddrRangeIterator(startAddr, endAddr), nil
+			}
+			return nil, fmt.Errorf("invalid IPv6 range end %q", endStr)
+		}
+
+		// Character range
+		if len(startStr) == 1 && len(endStr) == 1 {
+			return newCharRangeIterator(startStr[0], endStr[0]), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported range format: %s", s)
+}
+
+// paddingWidth returns the zero-padded width of a range like 001..100, or 0
+func paddingWidth(startStr, endStr string) int {
+	padded := func(s string) bool {
+		s = strings.TrimPrefix(s, "-")
+		return len(s) > 1 && s[0] == '0'
+	}
+	if !padded(startStr) && !padded(endStr) {
+		return 0
+	}
+	width := len(startStr)
+	if len(endStr) > width {
+		width = len(endStr)
+	}
+	return width
+}
+
+// completeIPv4 builds the end address of a short range: the given octets replace
+// the last octets of start (10.0.0.1..254 → 10.0.0.254, 10.0.0.1..1.5 → 10.0.1.5)
+func completeIPv4(start netip.Addr, endStr string) (netip.Addr, error) {
+	parts := strings.Split(endStr, ".")
+	if len(parts) > 3 {
+		return netip.Addr{}, fmt.Errorf("invalid range end %q", endStr)
+	}
+	octets := start.As4()
+	offset := 4 - len(parts)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 255 {
+			return netip.Addr{}, fmt.Errorf("invalid octet %q in range end", part)
+		}
+		octets[offset+i] = byte(n)
+	}
+	return netip.AddrFrom4(octets), nil
+}
+
+// parseCIDR returns an iterator over a CIDR block; a ":hosts" suffix skips the
+// network and broadcast addresses of IPv4 blocks larger than /31
+func parseCIDR(s string) (Iterator, error) {
+	hostsOnly := false
+	if strings.HasSuffix(s, ":hosts") {
+		hostsOnly = true
+		s = strings.TrimSuffix(s, ":hosts")
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block %q", s)
+	}
+	prefix = prefix.Masked()
+
+	first := prefix.Addr()
+	last := lastAddr(prefix)
+	if hostsOnly && first.Is4() && prefix.Bits() < 31 {
+		first = first.Next()
+		last = last.Prev()
+	}
+	return newAddrRangeIterator(first, last), nil
+}
+
+// lastAddr returns the highest address of a prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	for i := range bytes {
+		for b := 7; b >= 0; b-- {
+			if i*8+(7-b) >= bits {
+				bytes[i] |= 1 << uint(b)
+			}
+		}
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Chain Iterator (for a..z + 0..9 + !@# style)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type chainIterator struct {
+	iterators []Iterator
+	current   int
+}
+
+func newChainIterator(iters ...Iterator) Iterator {
+	return &chainIterator{
+		iterators: iters,
+		current:   0,
+	}
+}
+
+func (it *chainIterator) Next() (string, bool) {
+	for it.current < len(it.iterators) {
+		val, ok := it.iterators[it.current].Next()
+		if ok {
+			return val, true
+		}
+		it.current++
+	}
+	return "", false
+}
+
+func (it *chainIterator) Len() int {
+	total := 0
+	for _, i := range it.iterators[it.current:] {
+		total = addLen(total, i.Len())
+	}
+	return total
+}
+
+func (it *chainIterator) Close() error {
+	for _, i := range it.iterators {
+		_ = i.Close() // best effort
+	}
+	return nil
+}
+
+// addLen adds two lengths without overflowing
+func addLen(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Address Range Iterator (IPv4 and IPv6, forward or reverse)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type addrRangeIterator struct {
+	curr    netip.Addr
+	end     netip.Addr
+	reverse bool
+	done    bool
+}
+
+func newAddrRangeIterator(start, end netip.Addr) Iterator {
+	return &addrRangeIterator{curr: start, end: end, reverse: start.Compare(end) > 0}
+}
+
+func (it *addrRangeIterator) Next() (string, bool) {
+	if it.done || !it.curr.IsValid() {
+		return "", false
+	}
+	result := it.curr.String()
+
+	if it.curr == it.end {
+		it.done = true
+	} else if it.reverse {
+		it.curr = it.curr.Prev()
+	} else {
+		it.curr = it.curr.Next()
+	}
+	return result, true
+}
+
+// Len is exact, capped at MaxInt for huge IPv6 ranges
+func (it *addrRangeIterator) Len() int {
+	if it.done || !it.curr.IsValid() {
+		return 0
+	}
+	a := new(big.Int).SetBytes(it.curr.AsSlice())
+	b := new(big.Int).SetBytes(it.end.AsSlice())
+	diff := new(big.Int).Sub(b, a)
+	diff.Abs(diff)
+	diff.Add(diff, big.NewInt(1))
+	if !diff.IsInt64() || diff.Int64() > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(diff.Int64())
+}
+
+func (it *addrRangeIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Octet Glob Iterator   10.0.1-3.*   192.168.1,5.10-20
+// ────────────────────────────────────────────────────────────────────────────────
+
+type octetGlobIterator struct {
+	octets [4][]int // allowed values per octet
+	pos    [4]int   // odometer position
+	done   bool
+}
+
+func newOctetGlobIterator(s string) (Iterator, error) {
+	it := &octetGlobIterator{}
+	for i, part := range strings.Split(s, ".") {
+		values, err := parseOctetSpec(part)
+		if err != nil {
+			return nil, err
+		}
+		it.octets[i] = values
+	}
+	return it, nil
+}
+
+// parseOctetSpec expands *, n, a-b and comma lists of those into octet values
+func parseOctetSpec(spec string) ([]int, error) {
+	if spec == "*" {
+		spec = "0-255"
+	}
+	var values []int
+	for _, piece := range strings.Split(spec, ",") {
+		lo, hi := piece, piece
+		if i := strings.Index(piece, "-"); i != -1 {
+			lo, hi = piece[:i], piece[i+1:]
+		}
+		a, err1 := strconv.Atoi(lo)
+		b, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || a > 255 || b > 255 || a > b {
+			return nil, fmt.Errorf("invalid octet %q", piece)
+		}
+		for n := a; n <= b; n++ {
+			values = append(values, n)
+		}
+	}
+	return values, nil
+}
+
+func (it *octetGlobIterator) Next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+	result := fmt.Sprintf("%d.%d.%d.%d",
+		it.octets[0][it.pos[0]], it.octets[1][it.pos[1]],
+		it.octets[2][it.pos[2]], it.octets[3][it.pos[3]])
+
+	// Advance the odometer, last octet fastest
+	for i := 3; i >= 0; i-- {
+		it.pos[i]++
+		if it.pos[i] < len(it.octets[i]) {
+			return result, true
+		}
+		it.pos[i] = 0
+	}
+	it.done = true
+	return result, true
+}
+
+func (it *octetGlobIterator) Len() int {
+	if it.done {
+		return 0
+	}
+	// Remaining = total - consumed, where consumed is the odometer reading
+	total, consumed := 1, 0
+	for i := 0; i < 4; i++ {
+		total *= len(it.octets[i])
+		consumed = consumed*len(it.octets[i]) + it.pos[i]
+	}
+	return total - consumed
+}
+
+func (it *octetGlobIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Character Range Iterator   a..z    or   z..a
+// ────────────────────────────────────────────────────────────────────────────────
+
+type charRangeIterator struct {
+	current int
+	end     int
+	step    int
+}
+
+func newCharRangeIterator(start, end byte) Iterator {
+	step := 1
+	if start > end {
+		step = -1
+	}
+	return &charRangeIterator{current: int(start), end: int(end), step: step}
+}
+
+func (it *charRangeIterator) Next() (string, bool) {
+	if (it.step > 0 && it.current > it.end) || (it.step < 0 && it.current < it.end) {
+		return "", false
+	}
+	val := string(rune(it.current))
+	it.current += it.step
+	return val, true
+}
+
+func (it *charRangeIterator) Len() int {
+	n := (it.end-it.current)*it.step + 1
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (it *charRangeIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Simple iterators
+// ────────────────────────────────────────────────────────────────────────────────
+
+type listIterator struct {
+	items []string
+	idx   int
+}
+
+func (it *listIterator) Next() (string, bool) {
+	if it.idx >= len(it.items) {
+		return "", false
+	}
+	v := it.items[it.idx]
+	it.idx++
+	return v, true
+}
+func (it *listIterator) Len() int     { return len(it.items) - it.idx }
+func (it *listIterator) Close() error { return nil }
+
+// numericRangeIterator counts from start to end (either direction) by step,
+// optionally zero-padding to width
+type numericRangeIterator struct {
+	current, end, step, width int
+}
+
+func newNumericRangeIterator(start, end, step, width int) *numericRangeIterator {
+	if start > end {
+		step = -step
+	}
+	return &numericRangeIterator{current: start, end: end, step: step, width: width}
+}
+func (it *numericRangeIterator) Next() (string, bool) {
+	if (it.step > 0 && it.current > it.end) || (it.step < 0 && it.current < it.end) {
+		return "", false
+	}
+	v := fmt.Sprintf("%0*d", it.width, it.current)
+	it.current += it.step
+	return v, true
+}
+func (it *numericRangeIterator) Len() int {
+	// Past the end the division would truncate toward zero and count one more
+	if (it.step > 0 && it.current > it.end) || (it.step < 0 && it.current < it.end) {
+		return 0
+	}
+	return (it.end-it.current)/it.step + 1
+}
+func (it *numericRangeIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Tuple iterators for multi-variable loops
+//   for host,port in @hosts.txt x 22|80|443 -> ...
+//   for user,pass in zip(@users.txt, @passwords.txt) -> ...
+// ────────────────────────────────────────────────────────────────────────────────
+
+// TupleIterator produces one value per loop variable
+type TupleIterator interface {
+	Next() ([]string, bool)
+	Len() int // tuples still to come
+	Close() error
+}
+
+// iteratorFactory opens a fresh iterator over one source, so a product can rewind it
+type iteratorFactory func() (Iterator, error)
+
+// loopSourceFactory returns a factory for a range expression or a streamed @file
+// wordlist (@- reads stdin); dedup drops repeated lines of files
+func loopSourceFactory(expr string, dedup bool) (iteratorFactory, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") && len(expr) > 1 {
+		path := expr[1:]
+		open := func() (Iterator, error) { return newLineFileIterator(path, dedup) }
+		it, err := open()
+		if err != nil {
+			return nil, err
+		}
+		it.Close()
+		return open, nil
+	}
+	if _, err := parseRangeSource(expr); err != nil {
+		return nil, err
+	}
+	return func() (Iterator, error) { return parseRangeSource(expr) }, nil
+}
+
+// productSeparator splits the sources of a cartesian product: A x B x C
+var productSeparator = regexp.MustCompile(`\s+x\s+`)
+
+// zipPattern matches zip(A, B, ...)
+var zipPattern = regexp.MustCompile(`^zip\(\s*(.+?)\s*\)$`)
+
+// parseTupleSource builds the iterator for a multi-variable loop, which needs
+// exactly one source per variable
+func parseTupleSource(expr string, vars int, dedup bool) (TupleIterator, error) {
+	expr = strings.TrimSpace(expr)
+
+	zip := false
+	var parts []string
+	if m := zipPattern.FindStringSubmatch(expr); m != nil {
+		zip = true
+		parts = strings.Split(m[1], ",")
+	} else {
+		parts = productSeparator.Split(expr, -1)
+	}
+	if len(parts) != vars {
+		return nil, fmt.Errorf("%d variables need %d sources, got %d (use A x B or zip(A, B))", vars, vars, len(parts))
+	}
+
+	factories := make([]iteratorFactory, 0, len(parts))
+	for _, part := range parts {
+		factory, err := loopSourceFactory(part, dedup)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source %q: %v", strings.TrimSpace(part), err)
+		}
+		factories = append(factories, factory)
+	}
+
+	if zip {
+		return newZipIterator(factories)
+	}
+	return newProductIterator(factories)
+}
+
+// productIterator yields every combination of its sources, the last one varying fastest
+type productIterator struct {
+	factories []iteratorFactory
+	iters     []Iterator
+	current   []string
+	total     int // combinations overall
+	produced  int
+	started   bool
+	done      bool
+}
+
+func newProductIterator(factories []iteratorFactory) (TupleIterator, error) {
+	it := &productIterator{
+		factories: factories,
+		iters:     make([]Iterator, len(factories)),
+		current:   make([]string, len(factories)),
+		total:     1,
+	}
+	for i, factory := range factories {
+		iter, err := factory()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.iters[i] = iter
+		it.total = mulLen(it.total, iter.Len())
+	}
+	return it, nil
+}
+
+func (it *productIterator) Next() ([]string, bool) {
+	if it.done {
+		return nil, false
+	}
+
+	if !it.started {
+		it.started = true
+		for i, iter := range it.iters {
+			v, ok := iter.Next()
+			if !ok {
+				it.done = true
+				return nil, false
+			}
+			it.current[i] = v
+		}
+		return it.emit(), true
+	}
+
+	// Advance like an odometer, rewinding each exhausted source
+	for i := len(it.iters) - 1; i >= 0; i-- {
+		if v, ok := it.iters[i].Next(); ok {
+			it.current[i] = v
+			return it.emit(), true
+		}
+		if i == 0 {
+			break
+		}
+		it.iters[i].Close()
+		iter, err := it.factories[i]()
+		if err != nil {
+			break
+		}
+		it.iters[i] = iter
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		it.current[i] = v
+	}
+	it.done = true
+	return nil, false
+}
+
+// emit returns a copy of the current combination
+func (it *productIterator) emit() []string {
+	it.produced++
+	return append([]string(nil), it.current...)
+}
+
+func (it *productIterator) Len() int {
+	if it.done {
+		return 0
+	}
+	return it.total - it.produced
+}
+
+func (it *productIterator) Close() error {
+	for _, iter := range it.iters {
+		if iter != nil {
+			_ = iter.Close() // best effort
+		}
+	}
+	return nil
+}
+
+// mulLen multiplies two lengths without overflowing
+func mulLen(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// zipIterator yields the i-th value of every source together, stopping at the shortest
+type zipIterator struct {
+	iters []Iterator
+	done  bool
+}
+
+func newZipIterator(factories []iteratorFactory) (TupleIterator, error) {
+	it := &zipIterator{iters: make([]Iterator, 0, len(factories))}
+	for _, factory := range factories {
+		iter, err := factory()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.iters = append(it.iters, iter)
+	}
+	return it, nil
+}
+
+func (it *zipIterator) Next() ([]string, bool) {
+	if it.done {
+		return nil, false
+	}
+	values := make([]string, len(it.iters))
+	for i, iter := range it.iters {
+		v, ok := iter.Next()
+		if !ok {
+			it.done = true
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+func (it *zipIterator) Len() int {
+	if it.done || len(it.iters) == 0 {
+		return 0
+	}
+	n := it.iters[0].Len()
+	for _, iter := range it.iters[1:] {
+		if l := iter.Len(); l < n {
+			n = l
+		}
+	}
+	return n
+}
+
+func (it *zipIterator) Close() error {
+	for _, iter := range it.iters {
+		_ = iter.Close() // best effort
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+// drain reads every value of it, checking that Len counts down to the end
+func drain(t *testing.T, it Iterator) []string {
+	t.Helper()
+	defer it.Close()
+
+	var values []string
+	for want := it.Len(); ; want-- {
+		v, ok := it.Next()
+		if !ok {
+			if want != 0 {
+				t.Errorf("iterator ended with Len() %d", want)
+			}
+			return values
+		}
+		values = append(values, v)
+		if got := it.Len(); got != want-1 {
+			t.Errorf("Len() after %q = %d, want %d", v, got, want-1)
+			want = got + 1
+		}
+	}
+}
+
+func TestParseRangeSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"a|b| c ||d", []string{"a", "b", "c", "d"}},
+		{"1..5", []string{"1", "2", "3", "4", "5"}},
+		{"3..1", []string{"3", "2", "1"}},
+		{"-1..1", []string{"-1", "0", "1"}},
+		{"0..10:5", []string{"0", "5", "10"}},
+		{"0..9:4", []string{"0", "4", "8"}},
+		{"10..0:5", []string{"10", "5", "0"}},
+		{"08..11", []string{"08", "09", "10", "11"}},
+		{"a..e", []string{"a", "b", "c", "d", "e"}},
+		{"C..A", []string{"C", "B", "A"}},
+		{"a..b+1..2", []string{"a", "b", "1", "2"}},
+		{"10.0.0.254..10.0.1.1", []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{"10.0.0.1..3", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"10.0.0.255..1.0", []string{"10.0.0.255", "10.0.1.0"}},
+		{"10.0.0.0/30", []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"10.0.0.5/30", []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"}},
+		{"10.0.0.0/29:hosts", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}},
+		{"10.0.0.0/31:hosts", []string{"10.0.0.0", "10.0.0.1"}},
+		{"192.168.1.1/32", []string{"192.168.1.1"}},
+		{"2001:db8::/126", []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{"2001:db8::ff/127:hosts", []string{"2001:db8::fe", "2001:db8::ff"}},
+		{"fe80::fffe..fe80::1:1", []string{"fe80::fffe", "fe80::ffff", "fe80::1:0", "fe80::1:1"}},
+		{"10.0.1-2.1,3", []string{"10.0.1.1", "10.0.1.3", "10.0.2.1", "10.0.2.3"}},
+		{"192.168.0.254-255", []string{"192.168.0.254", "192.168.0.255"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			it, err := parseRangeSource(tt.source)
+			if err != nil {
+				t.Fatalf("parseRangeSource(%q) error: %v", tt.source, err)
+			}
+			if got := drain(t, it); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRangeSource(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRangeSourceLargeBlocks(t *testing.T) {
+	tests := []struct {
+		source      string
+		len         int
+		first, last string
+	}{
+		{"10.0.0.0/16", 65536, "10.0.0.0", "10.0.255.255"},
+		{"10.0.0.0/24:hosts", 254, "10.0.0.1", "10.0.0.254"},
+		{"10.0.*.1", 256, "10.0.0.1", "10.0.255.1"},
+		{"1..1000000:7", 142858, "1", "1000000"},
+	}
+	for _, tt := range tests {
+		it, err := parseRangeSource(tt.source)
+		if err != nil {
+			t.Errorf("parseRangeSource(%q) error: %v", tt.source, err)
+			continue
+		}
+		if got := it.Len(); got != tt.len {
+			t.Errorf("parseRangeSource(%q).Len() = %d, want %d", tt.source, got, tt.len)
+		}
+		values := drain(t, it)
+		if len(values) != tt.len || values[0] != tt.first || values[len(values)-1] != tt.last {
+			t.Errorf("parseRangeSource(%q) gave %d values from %s to %s, want %d from %s to %s",
+				tt.source, len(values), values[0], values[len(values)-1], tt.len, tt.first, tt.last)
+		}
+	}
+
+	// A /64 has more addresses than an int counts, Len saturates instead of overflowing
+	it, err := parseRangeSource("2001:db8::/64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := it.Len(); n <= 0 {
+		t.Errorf("Len() of a /64 = %d, want a large positive count", n)
+	}
+	if v, _ := it.Next(); v != "2001:db8::" {
+		t.Errorf("first address of a /64 = %q", v)
+	}
+}
+
+func TestParseRangeSourceErrors(t *testing.T) {
+	for _, source := range []string{
+		"1..10:0",
+		"10.0.0.0/33",
+		"10.0.0.1..::1",
+		"10.0.0.1..300",
+		"10.0.0.1..1.2.3.4.5",
+		"10.0.300.*",
+		"10.0.5-2.*",
+		"hello",
+		"a..b+nope",
+	} {
+		if it, err := parseRangeSource(source); err == nil {
+			t.Errorf("parseRangeSource(%q) succeeded with %q, want an error", source, drain(t, it))
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// Job is a module running in the background
+type Job struct {
+	ID      int
+	Module  string
+	Args    map[string]string
+	Started time.Time
+	Ended   time.Time
+
+	mu          sync.Mutex
+	result      *core.ExecutionResult
+	err         error
+	killed      bool
+	announced   bool
+	progress    int
+	progressMsg string
+	output      *jobOutput
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// jobOutput buffers a job's combined stdout/stderr and optionally mirrors it live
+type jobOutput struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	live      io.Writer // set while the job is attached with 'fg'
+}
+
+// Write implements io.Writer, keeping at most limit bytes
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if room := o.limit - o.buf.Len(); room < len(p) {
+		if room > 0 {
+			o.buf.Write(p[:room])
+		}
+		o.truncated = true
+	} else {
+		o.buf.Write(p)
+	}
+	if o.live != nil {
+		o.live.Write(p)
+	}
+	return len(p), nil
+}
+
+// attach returns the output so far and mirrors everything written afterwards to w
+func (o *jobOutput) attach(w io.Writer) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.live = w
+	return o.buf.String()
+}
+
+// detach stops mirroring output
+func (o *jobOutput) detach() {
+	o.mu.Lock()
+	o.live = nil
+	o.mu.Unlock()
+}
+
+// String returns the buffered output
+func (o *jobOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// running reports whether the job hasn't finished yet
+func (j *Job) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// status returns a short description of the job's state
+func (j *Job) status() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case j.running():
+		return "running"
+	case j.killed:
+		return "killed"
+	case j.err != nil || j.result == nil:
+		return "error"
+	case j.result.TimedOut:
+		return "timed out"
+	case j.result.Success:
+		return "done"
+	default:
+		return "failed"
+	}
+}
+
+// duration returns how long the job ran, or has been running
+func (j *Job) duration() time.Duration {
+	if j.running() {
+		return time.Since(j.Started)
+	}
+	return j.Ended.Sub(j.Started)
+}
+
+// exitCode returns the exit code as text, empty while running
+func (j *Job) exitCode() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.running() || j.result == nil {
+		return ""
+	}
+	return strconv.Itoa(j.result.ExitCode)
+}
+
+// summary formats the one-line completion notice
+func (j *Job) summary() string {
+	line := fmt.Sprintf("[%d] %-9s %s (%s", j.ID, j.status(), j.Module, j.duration().Round(time.Millisecond))
+	if code := j.exitCode(); code != "" {
+		line += ", exit " + code
+	}
+	return line + ")"
+}
+
+// JobManager keeps track of background jobs for the session
+type JobManager struct {
+	mu         sync.Mutex
+	jobs       []*Job
+	nextID     int
+	foreground *Job          // job currently attached with 'fg'
+	detachCh   chan struct{} // closed by Ctrl+C to detach from the foreground job
+}
+
+// NewJobManager creates an empty job table
+func NewJobManager() *JobManager {
+	return &JobManager{nextID: 1}
+}
+
+// add registers a new job and assigns its ID
+func (jm *JobManager) add(job *Job) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job.ID = jm.nextID
+	jm.nextID++
+	jm.jobs = append(jm.jobs, job)
+}
+
+// get returns a job by its ID
+func (jm *JobManager) get(id int) *Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	for _, job := range jm.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// list returns a snapshot of all jobs
+func (jm *JobManager) list() []*Job {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	return append([]*Job(nil), jm.jobs...)
+}
+
+// running returns the jobs that haven't finished
+func (jm *JobManager) running() []*Job {
+	var jobs []*Job
+	for _, job := range jm.list() {
+		if job.running() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// AnnounceFinished prints a notice for every job that finished since the last prompt
+func (jm *JobManager) AnnounceFinished() {
+	for _, job := range jm.list() {
+		if job.running() {
+			continue
+		}
+		job.mu.Lock()
+		announced := job.announced
+		job.announced = true
+		job.mu.Unlock()
+		if announced {
+			continue
+		}
+
+		switch job.status() {
+		case "done":
+			core.PrintSuccess(job.summary())
+		case "killed":
+			core.PrintWarning(job.summary())
+		default:
+			core.PrintError(job.summary())
+		}
+	}
+}
+
+// setForeground marks job as attached and returns the channel closed on detach
+func (jm *JobManager) setForeground(job *Job) chan struct{} {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.foreground = job
+	jm.detachCh = make(chan struct{})
+	return jm.detachCh
+}
+
+// clearForeground forgets the attached job
+func (jm *JobManager) clearForeground() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.foreground = nil
+	jm.detachCh = nil
+}
+
+// DetachForeground detaches from the job attached with 'fg', it reports whether there was one
+func (jm *JobManager) DetachForeground() bool {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if jm.foreground == nil {
+		return false
+	}
+	close(jm.detachCh)
+	jm.foreground = nil
+	jm.detachCh = nil
+	return true
+}
+
+// killAll stops every running job and waits up to timeout for them to exit
+func (jm *JobManager) killAll(timeout time.Duration) {
+	jobs := jm.running()
+	for _, job := range jobs {
+		job.kill()
+	}
+	deadline := time.After(timeout)
+	for _, job := range jobs {
+		select {
+		case <-job.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// wait blocks until every running job has finished
+func (jm *JobManager) wait() {
+	for _, job := range jm.running() {
+		<-job.done
+	}
+}
+
+// kill cancels the job's context, which terminates its process group
+func (j *Job) kill() {
+	j.mu.Lock()
+	j.killed = true
+	j.mu.Unlock()
+	j.cancel()
+}
+
+// stopJobs kills the jobs still running when the session ends
+func (cli *CLI) stopJobs() {
+	running := cli.jobs.running()
+	if len(running) == 0 {
+		return
+	}
+	cli.printWarning(fmt.Sprintf("Killing %d background job(s)...", len(running)))
+	cli.jobs.killAll(core.TerminateGracePeriod + 2*time.Second)
+}
+
+// StartJob runs a module in the background with its output buffered
+func (cli *CLI) StartJob(moduleName string, args []string) bool {
+	run, ok := cli.prepareModuleRun(moduleName, args)
+	if run == nil {
+		return ok
+	}
+	if run.saveLog {
+		cli.printWarning("save= is ignored for background jobs, use 'jobs -o <id>' to read the output")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if run.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), run.timeout)
+	}
+
+	limit := cli.manager.OutputLimit
+	if limit <= 0 {
+		limit = core.DefaultOutputLimit
+	}
+	job := &Job{
+		Module:  moduleName,
+		Args:    run.displayArgs(),
+		Started: time.Now(),
+		output:  &jobOutput{limit: limit},
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	cli.jobs.add(job)
+
+	opts := core.ExecOptions{
+		Stdout:  job.output,
+		Stderr:  job.output,
+		Stdin:   strings.NewReader(""), // the REPL keeps the terminal
+		Wrapper: run.wrapper,
+		Progress: func(pct int, message string) {
+			job.mu.Lock()
+			job.progress, job.progressMsg = pct, message
+			job.mu.Unlock()
+		},
+	}
+
+	// Opened here rather than in the job so the checkpoint is created before the prompt returns
+	var cp *core.Checkpoint
+	var skip map[int]bool
+	if run.threads > 1 {
+		cp, skip = cli.openCheckpoint(run.checkpointHeader())
+	}
+
+	go func() {
+		defer cancel()
+
+		var result *core.ExecutionResult
+		var err error
+		if run.threads > 1 {
+			itemOpts := opts
+			itemOpts.Quiet = true
+			result, err = cli.runModuleThreaded(ctx, run, shardOptions{
+				exec:       itemOpts,
+				out:        job.output,
+				ordered:    run.ordered,
+				checkpoint: cp,
+				skip:       skip,
+				onItem: func(done, total int) {
+					job.mu.Lock()
+					if total > 0 {
+						job.progress = done * 100 / total
+					}
+					job.progressMsg = fmt.Sprintf("%d/%d items", done, total)
+					job.mu.Unlock()
+				},
+			})
+		} else {
+			result = cli.manager.ExecutePrepared(ctx, run.module, run.args, opts)
+		}
+
+		job.mu.Lock()
+		job.Ended = time.Now()
+		job.result, job.err = result, err
+		if result != nil && job.killed {
+			result.Cancelled = true
+			result.Success = false
+		}
+		job.mu.Unlock()
+
+		if result != nil {
+			cli.recordRun(moduleName, job.Args, result, job.Ended.Sub(job.Started))
+		}
+		close(job.done)
+	}()
+
+	cli.printInfo(fmt.Sprintf("[%d] Started job for module '%s' in the background", job.ID, core.Color("cyan", moduleName)))
+	return true
+}
+
+// startBackgroundCommand launches "module args... &" or "run args... &" as a job.
+// It returns false when the command isn't a module, so the shell can handle '&' itself.
+func (cli *CLI) startBackgroundCommand(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+
+	if fields[0] == "run" {
+		if cli.currentModule == "" {
+			cli.printError("No module selected. Use 'use <module>' first.")
+			return true
+		}
+		args := fields[1:]
+		if len(args) > 0 && args[0] == "-j" {
+			args = args[1:]
+		}
+		cli.StartJob(cli.currentModule, cli.currentModuleArgs(args))
+		return true
+	}
+
+	if !cli.moduleExists(fields[0]) {
+		return false
+	}
+	cli.StartJob(fields[0], fields[1:])
+	return true
+}
+
+// HandleJobs implements the 'jobs' command
+func (cli *CLI) HandleJobs(args []string) {
+	if len(args) == 0 {
+		cli.ListJobs()
+		return
+	}
+
+	usage := "Usage: jobs [-o <id>] [-k <id>]"
+	if len(args) < 2 {
+		cli.printError(usage)
+		return
+	}
+	job := cli.lookupJob(args[1])
+	if job == nil {
+		return
+	}
+
+	switch args[0] {
+	case "-o", "--output":
+		cli.ShowJobOutput(job)
+	case "-k", "--kill":
+		if !job.running() {
+			cli.printWarning(fmt.Sprintf("Job %d already finished", job.ID))
+			return
+		}
+		job.kill()
+		cli.printWarning(fmt.Sprintf("[%d] Killing job for module '%s'...", job.ID, job.Module))
+	default:
+		cli.printError(usage)
+	}
+}
+
+// lookupJob parses a job ID (optionally written as %N) and reports unknown IDs
+func (cli *CLI) lookupJob(arg string) *Job {
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "%"))
+	if err != nil {
+		cli.printError(fmt.Sprintf("Invalid job ID '%s'", arg))
+		return nil
+	}
+	job := cli.jobs.get(id)
+	if job == nil {
+		cli.printError(fmt.Sprintf("No such job: %d", id))
+	}
+	return job
+}
+
+// ListJobs prints the job table
+func (cli *CLI) ListJobs() {
+	jobs := cli.jobs.list()
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Jobs (%d)", len(jobs))))
+	if len(jobs) == 0 {
+		fmt.Fprintln(cli.out(), core.NmapSubBox("No background jobs, start one with 'module args... &' or 'run -j'"))
+		fmt.Fprintln(cli.out())
+		return
+	}
+
+	table := core.NewTable([]string{"ID", "Module", "Status", "Duration", "Exit", "Progress", "Args"})
+	for _, job := range jobs {
+		job.mu.Lock()
+		progress := ""
+		if job.progress > 0 || job.progressMsg != "" {
+			progress = fmt.Sprintf("%d%% %s", job.progress, job.progressMsg)
+		}
+		job.mu.Unlock()
+
+		args := make([]string, 0, len(job.Args))
+		for k, v := range job.Args {
+			args = append(args, k+"="+v)
+		}
+		sort.Strings(args)
+
+		table.AddRow(
+			strconv.Itoa(job.ID),
+			job.Module,
+			job.status(),
+			job.duration().Round(time.Second).String(),
+			job.exitCode(),
+			strings.TrimSpace(progress),
+			strings.Join(args, " "),
+		)
+	}
+	fmt.Fprint(cli.out(), table.Render())
+	fmt.Fprintln(cli.out())
+}
+
+// ShowJobOutput prints a job's buffered output and, once finished, its results
+func (cli *CLI) ShowJobOutput(job *Job) {
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Job %d - %s (%s)", job.ID, job.Module, job.status())))
+	output := strings.TrimRight(job.output.String(), "\n")
+	if output == "" {
+		fmt.Fprintln(cli.out(), core.NmapSubBox("No output yet"))
+	} else {
+		fmt.Fprintln(cli.out(), output)
+	}
+	fmt.Fprintln(cli.out())
+
+	job.output.mu.Lock()
+	truncated := job.output.truncated
+	job.output.mu.Unlock()
+	if truncated {
+		cli.printWarning(fmt.Sprintf("Job output was truncated to %d bytes", job.output.limit))
+	}
+
+	if !job.running() {
+		cli.printJobResult(job)
+	}
+}
+
+// printJobResult shows the structured results and final status of a finished job
+func (cli *CLI) printJobResult(job *Job) {
+	job.mu.Lock()
+	result, err := job.result, job.err
+	job.announced = true
+	job.mu.Unlock()
+
+	if err != nil {
+		cli.printError(fmt.Sprintf("Execution failed: %v", err))
+		fmt.Fprintln(cli.out())
+		return
+	}
+	if result != nil {
+		cli.printStructuredResults(result)
+	}
+	switch job.status() {
+	case "done":
+		cli.printSuccess(job.summary())
+	case "killed":
+		cli.printWarning(job.summary())
+	default:
+		cli.printError(job.summary())
+	}
+	fmt.Fprintln(cli.out())
+}
+
+// ForegroundJob implements 'fg': it replays a job's output and follows it live
+// until the job finishes or Ctrl+C detaches
+func (cli *CLI) ForegroundJob(args []string) {
+	var job *Job
+	if len(args) > 0 {
+		if job = cli.lookupJob(args[0]); job == nil {
+			return
+		}
+	} else {
+		// Default to the most recent running job, like a shell
+		running := cli.jobs.running()
+		if len(running) == 0 {
+			cli.printError("No running jobs. Usage: fg <id>")
+			return
+		}
+		job = running[len(running)-1]
+	}
+
+	if !job.running() {
+		cli.ShowJobOutput(job)
+		return
+	}
+
+	fmt.Fprintln(cli.out())
+	cli.printInfo(fmt.Sprintf("[%d] Attached to job for module '%s', press Ctrl+C to detach", job.ID, core.Color("cyan", job.Module)))
+	fmt.Fprintln(cli.out())
+
+	detach := cli.jobs.setForeground(job)
+	fmt.Fprint(cli.out(), job.output.attach(cli.out()))
+
+	select {
+	case <-job.done:
+		job.output.detach()
+		cli.jobs.clearForeground()
+		fmt.Fprintln(cli.out())
+		cli.printJobResult(job)
+	case <-detach:
+		job.output.detach()
+		fmt.Fprintln(cli.out())
+		cli.printInfo(fmt.Sprintf("[%d] Detached, the job keeps running in the background", job.ID))
+		fmt.Fprintln(cli.out())
+	}
+}
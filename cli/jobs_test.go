@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jobModules are the modules of the job tests
+var jobModules = map[string]testModule{
+	"greet": {yaml: "options:\n  name:\n    type: string\n", script: "echo \"hi $ARG_NAME\"\n"},
+	"fail":  {script: "echo bad >&2\nexit 3\n"},
+	"hang":  {script: "sleep 30\n"},
+}
+
+// waitJob waits for a job to finish
+func waitJob(t *testing.T, job *Job) {
+	t.Helper()
+	select {
+	case <-job.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("job %d did not finish", job.ID)
+	}
+}
+
+func TestStartJob(t *testing.T) {
+	cli := newTestCLI(t, jobModules)
+	term := &termBuffer{}
+	cli.stdout, cli.stderr = term, term
+
+	tests := []struct {
+		command string
+		status  string
+		code    string
+		output  string
+	}{
+		{command: `greet name=x &`, status: "done", code: "0", output: "hi x"},
+		{command: `fail &`, status: "failed", code: "3", output: "bad"},
+	}
+
+	for i, tt := range tests {
+		term.Reset()
+		cli.ExecuteCommand(tt.command)
+		job := cli.jobs.get(i + 1)
+		if job == nil {
+			t.Fatalf("%s: no job %d, terminal shows %q", tt.command, i+1, term.String())
+		}
+		waitJob(t, job)
+
+		if got := job.status(); got != tt.status {
+			t.Errorf("%s: status = %q, want %q", tt.command, got, tt.status)
+		}
+		if got := job.exitCode(); got != tt.code {
+			t.Errorf("%s: exit code = %q, want %q", tt.command, got, tt.code)
+		}
+		if got := job.output.String(); !strings.Contains(got, tt.output) {
+			t.Errorf("%s: job output = %q, want %q in it", tt.command, got, tt.output)
+		}
+		// The output is kept for 'jobs -o', not printed at the prompt
+		if strings.Contains(term.String(), tt.output) {
+			t.Errorf("%s: terminal shows the job's output: %q", tt.command, term.String())
+		}
+	}
+}
+
+func TestJobKill(t *testing.T) {
+	cli := newTestCLI(t, jobModules)
+	term := &termBuffer{}
+	cli.stdout, cli.stderr = term, term
+
+	if !cli.StartJob("hang", nil) {
+		t.Fatal("job did not start")
+	}
+	job := cli.jobs.get(1)
+	if got := job.status(); got != "running" {
+		t.Fatalf("status = %q, want running", got)
+	}
+
+	cli.HandleJobs([]string{"-k", "%1"})
+	waitJob(t, job)
+	if got := job.status(); got != "killed" {
+		t.Errorf("status after jobs -k = %q, want killed", got)
+	}
+	if len(cli.jobs.running()) != 0 {
+		t.Error("a killed job is still listed as running")
+	}
+
+	term.Reset()
+	cli.HandleJobs([]string{"-k", "1"})
+	if !strings.Contains(term.String(), "already finished") {
+		t.Errorf("killing a finished job printed %q", term.String())
+	}
+	term.Reset()
+	cli.HandleJobs([]string{"-o", "7"})
+	if !strings.Contains(term.String(), "No such job: 7") {
+		t.Errorf("an unknown job printed %q", term.String())
+	}
+}
+
+func TestJobOutput(t *testing.T) {
+	o := &jobOutput{limit: 5}
+	o.Write([]byte("abc"))
+	o.Write([]byte("defg"))
+	if got := o.String(); got != "abcde" || !o.truncated {
+		t.Errorf("output = %q truncated=%v, want the first 5 bytes and truncated", got, o.truncated)
+	}
+
+	// While attached, writes are mirrored in full, the buffer stays capped
+	var live bytes.Buffer
+	if got := o.attach(&live); got != "abcde" {
+		t.Errorf("attach returned %q, want the output so far", got)
+	}
+	o.Write([]byte("hij"))
+	o.detach()
+	o.Write([]byte("klm"))
+	if live.String() != "hij" {
+		t.Errorf("mirrored %q, want only what was written while attached", live.String())
+	}
+}
@@ -0,0 +1,229 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind is the kind of a command-line token
+type tokenKind int
+
+const (
+	tokWord     tokenKind = iota // a word, with quotes removed
+	tokSemi                      // ;
+	tokAnd                       // &&
+	tokOr                        // ||
+	tokPipe                      // |>
+	tokAmp                       // &
+	tokRedirect                  // >, >>, 2>, 2>>, &> or &>>
+	tokArrow                     // -> of a for loop
+	tokEOF
+)
+
+// String returns the token kind as it is written
+func (k tokenKind) String() string {
+	switch k {
+	case tokWord:
+		return "word"
+	case tokSemi:
+		return "';'"
+	case tokAnd:
+		return "'&&'"
+	case tokOr:
+		return "'||'"
+	case tokPipe:
+		return "'|>'"
+	case tokAmp:
+		return "'&'"
+	case tokRedirect:
+		return "redirection"
+	case tokArrow:
+		return "'->'"
+	}
+	return "end of line"
+}
+
+// token is one lexical unit of a command line
+type token struct {
+	kind tokenKind
+	text string // the operator, or the word with quotes removed and escapes applied
+	pos  int    // byte offset of the token in the command line
+	end  int    // byte offset just past the token
+}
+
+// lexCommandLine splits a command line into words and operators.
+//
+// Quotes group words ("..." handles \" and \\, '...' is literal) and a backslash escapes
+// the next character. $(...) is kept whole, quotes included, for the builtin expander,
+// and so are the arguments of a name(...) call, which the builtin parses itself.
+// ; and |> are operators anywhere outside quotes and calls; &&, ||, &, the redirections and -> only
+// where a new token starts, so URLs like ?a=1&b=2 and arguments like a>b stay single words.
+func lexCommandLine(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(input) {
+		c := input[i]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			i++
+			continue
+		}
+
+		op, kind := "", tokWord
+		switch {
+		case c == ';':
+			op, kind = ";", tokSemi
+		case strings.HasPrefix(input[i:], "|>"):
+			op, kind = "|>", tokPipe
+		case strings.HasPrefix(input[i:], "&&"):
+			op, kind = "&&", tokAnd
+		case strings.HasPrefix(input[i:], "||"):
+			op, kind = "||", tokOr
+		case strings.HasPrefix(input[i:], "&>>"), strings.HasPrefix(input[i:], "2>>"):
+			op, kind = input[i:i+3], tokRedirect
+		case strings.HasPrefix(input[i:], "&>"), strings.HasPrefix(input[i:], "2>"):
+			op, kind = input[i:i+2], tokRedirect
+		case c == '&':
+			op, kind = "&", tokAmp
+		case strings.HasPrefix(input[i:], ">>"):
+			op, kind = ">>", tokRedirect
+		case c == '>':
+			op, kind = ">", tokRedirect
+		case strings.HasPrefix(input[i:], "->") && (i+2 == len(input) || isSpace(input[i+2])):
+			op, kind = "->", tokArrow
+		}
+		if kind != tokWord {
+			tokens = append(tokens, token{kind: kind, text: op, pos: i, end: i + len(op)})
+			i += len(op)
+			continue
+		}
+
+		tok, err := lexWord(input, i)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		i = tok.end
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(input), end: len(input)}), nil
+}
+
+// lexWord reads the word starting at input[start]
+func lexWord(input string, start int) (token, error) {
+	var text strings.Builder
+	i := start
+
+	for i < len(input) {
+		c := input[i]
+		if isSpace(c) || c == ';' || strings.HasPrefix(input[i:], "|>") {
+			break
+		}
+
+		switch {
+		case c == '(' && endsWithName(text.String()) && substitutionEnd(input, i+1) >= 0:
+			// name(...) call: the builtin parses its own arguments
+			end := substitutionEnd(input, i+1)
+			text.WriteString(input[i : end+1])
+			i = end + 1
+
+		case c == '\\':
+			if i+1 < len(input) {
+				text.WriteByte(input[i+1])
+				i += 2
+			} else {
+				text.WriteByte(c)
+				i++
+			}
+
+		case c == '\'':
+			end := strings.IndexByte(input[i+1:], '\'')
+			if end < 0 {
+				return token{}, &parseError{pos: i, msg: "unterminated ' quote"}
+			}
+			text.WriteString(input[i+1 : i+1+end])
+			i += end + 2
+
+		case c == '"':
+			j := i + 1
+			for ; j < len(input) && input[j] != '"'; j++ {
+				if input[j] == '\\' && j+1 < len(input) && (input[j+1] == '"' || input[j+1] == '\\') {
+					j++
+				}
+				text.WriteByte(input[j])
+			}
+			if j >= len(input) {
+				return token{}, &parseError{pos: i, msg: "unterminated \" quote"}
+			}
+			i = j + 1
+
+		case strings.HasPrefix(input[i:], "$("):
+			end := substitutionEnd(input, i+2)
+			if end < 0 {
+				return token{}, &parseError{pos: i, msg: "unclosed $( - missing ')'"}
+			}
+			text.WriteString(input[i : end+1])
+			i = end + 1
+
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+
+	return token{kind: tokWord, text: text.String(), pos: start, end: i}, nil
+}
+
+// endsWithName reports whether a word so far ends with a builtin name, making a
+// following ( the start of a call
+func endsWithName(word string) bool {
+	if word == "" {
+		return false
+	}
+	c := word[len(word)-1]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// substitutionEnd returns the index of the ) closing a $( whose body starts at start,
+// skipping quoted text and nested parentheses, or -1
+func substitutionEnd(s string, start int) int {
+	depth := 1
+	quote := byte(0)
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isSpace reports whether c separates words
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// parseError is a syntax error at a byte offset of the command line
+type parseError struct {
+	pos int
+	msg string
+}
+
+// Error implements the error interface
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s (at column %d)", e.msg, e.pos+1)
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tokenTexts renders tokens as their text, words in brackets to tell them from operators
+func tokenTexts(tokens []token) []string {
+	var texts []string
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokEOF:
+		case tokWord:
+			texts = append(texts, "["+tok.text+"]")
+		default:
+			texts = append(texts, tok.text)
+		}
+	}
+	return texts
+}
+
+func TestLexCommandLine(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"portscan host=10.0.0.1 ports=22", []string{"[portscan]", "[host=10.0.0.1]", "[ports=22]"}},
+		{"  a\tb  ", []string{"[a]", "[b]"}},
+		{"a;b", []string{"[a]", ";", "[b]"}},
+		{"a && b || c &", []string{"[a]", "&&", "[b]", "||", "[c]", "&"}},
+		{"a |> b|>c", []string{"[a]", "|>", "[b]", "|>", "[c]"}},
+		{"a > out >> log 2> err 2>> errs &> all &>> alls",
+			[]string{"[a]", ">", "[out]", ">>", "[log]", "2>", "[err]", "2>>", "[errs]", "&>", "[all]", "&>>", "[alls]"}},
+		{"curl url=http://h/?a=1&b=2", []string{"[curl]", "[url=http://h/?a=1&b=2]"}},
+		{"filter expr=a>b", []string{"[filter]", "[expr=a>b]"}},
+		{"for x in 1..3 -> echo $x", []string{"[for]", "[x]", "[in]", "[1..3]", "->", "[echo]", "[$x]"}},
+		{"echo a->b", []string{"[echo]", "[a->b]"}},
+		{"echo -> ", []string{"[echo]", "->"}},
+		{`echo "a b" 'c d'`, []string{"[echo]", "[a b]", "[c d]"}},
+		{`echo "say \"hi\" \\ \n"`, []string{"[echo]", `[say "hi" \ \n]`}},
+		{`echo 'it''s' "a;b" 'x |> y'`, []string{"[echo]", "[its]", "[a;b]", "[x |> y]"}},
+		{`echo a\ b \;`, []string{"[echo]", "[a b]", "[;]"}},
+		{`echo $(upper("a;b")) next`, []string{"[echo]", `[$(upper("a;b"))]`, "[next]"}},
+		{`x=$(cat(f) |> upper()) ; y`, []string{`[x=$(cat(f) |> upper())]`, ";", "[y]"}},
+		{"echo sha(a;b) ; next", []string{"[echo]", "[sha(a;b)]", ";", "[next]"}},
+		{"file(path, a;b) |> upper()", []string{"[file(path, a;b)]", "|>", "[upper()]"}},
+		{`file("my file", a) |> upper('x')`, []string{`[file("my file", a)]`, "|>", `[upper('x')]`}},
+		{"echo f(g(a;b);c)", []string{"[echo]", "[f(g(a;b);c)]"}},
+		{"echo :( ; b", []string{"[echo]", "[:(]", ";", "[b]"}},
+		{"echo open( ; b", []string{"[echo]", "[open(]", ";", "[b]"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		tokens, err := lexCommandLine(tt.input)
+		if err != nil {
+			t.Errorf("lexCommandLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := tokenTexts(tokens); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lexCommandLine(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLexCommandLinePositions(t *testing.T) {
+	input := `echo "a b" |> up`
+	tokens, err := lexCommandLine(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens[:len(tokens)-1] {
+		if tok.kind == tokWord && tok.text == "a b" {
+			if got := input[tok.pos:tok.end]; got != `"a b"` {
+				t.Errorf("source of %q = %q, want the quoted word", tok.text, got)
+			}
+		}
+	}
+	if last := tokens[len(tokens)-1]; last.kind != tokEOF || last.pos != len(input) {
+		t.Errorf("last token = %+v, want EOF at %d", last, len(input))
+	}
+}
+
+func TestLexCommandLineErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{`echo "abc`, 5},
+		{`echo 'abc`, 5},
+		{`echo $(upper(a)`, 5},
+		{`echo ok "a\"`, 8},
+	}
+	for _, tt := range tests {
+		_, err := lexCommandLine(tt.input)
+		perr, ok := err.(*parseError)
+		if !ok {
+			t.Errorf("lexCommandLine(%q) error = %v, want a *parseError", tt.input, err)
+			continue
+		}
+		if perr.pos != tt.pos {
+			t.Errorf("lexCommandLine(%q) error at %d, want %d", tt.input, perr.pos, tt.pos)
+		}
+	}
+}
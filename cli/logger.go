@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -85,6 +86,25 @@ func (l *Logger) LogSection(title string) {
 	}
 }
 
+// LogCaptured writes a module's captured stdout and stderr to the log file only
+func (l *Logger) LogCaptured(stdout, stderr string) {
+	if !l.enabled {
+		return
+	}
+	if stdout != "" {
+		l.writeToFile("[stdout]\n" + stdout)
+		if !strings.HasSuffix(stdout, "\n") {
+			l.writeToFile("\n")
+		}
+	}
+	if stderr != "" {
+		l.writeToFile("[stderr]\n" + stderr)
+		if !strings.HasSuffix(stderr, "\n") {
+			l.writeToFile("\n")
+		}
+	}
+}
+
 // GetFilePath returns the log file path
 func (l *Logger) GetFilePath() string {
 	return l.filePath
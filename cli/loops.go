@@ -0,0 +1,620 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// loopOptions are the execution settings of a for-loop
+//
+//	for ip in 10.0.0.1..254 parallel=20 rate=10/s on-error=stop -> portscan host=$ip
+type loopOptions struct {
+	parallel    int           // iterations running at once
+	interval    time.Duration // minimum gap between starts, from rate=N/unit
+	delay       time.Duration // fixed pause between starts
+	jitter      time.Duration // random extra pause, 0..jitter
+	stopOnError bool          // stop starting iterations after the first failure
+	source      sourceOptions // skip=/limit=/dedup=, these don't make the loop parallel
+}
+
+// loopOptionPattern matches a trailing loop option in the source expression
+var loopOptionPattern = regexp.MustCompile(`^(parallel|rate|delay|jitter|on-error|skip|limit|dedup)=(\S+)$`)
+
+// parseLoopOptions strips trailing key=value loop options from the source expression.
+// found is false when the loop has no execution options and should run the classic
+// sequential way.
+func parseLoopOptions(source string) (rest string, opts loopOptions, found bool, err error) {
+	opts = loopOptions{parallel: 1, source: sourceOptions{limit: -1}}
+	fields := strings.Fields(source)
+
+	for len(fields) > 1 {
+		m := loopOptionPattern.FindStringSubmatch(fields[len(fields)-1])
+		if m == nil {
+			break
+		}
+		fields = fields[:len(fields)-1]
+
+		key, val := m[1], m[2]
+		switch key {
+		case "skip", "limit":
+			n, convErr := strconv.Atoi(val)
+			if convErr != nil || n < 0 {
+				return "", opts, found, fmt.Errorf("%s= needs a number, got '%s'", key, val)
+			}
+			if key == "skip" {
+				opts.source.skip = n
+			} else {
+				opts.source.limit = n
+			}
+			continue
+		case "dedup":
+			opts.source.dedup = val == "1" || val == "true" || val == "yes"
+			continue
+		}
+
+		found = true
+		switch key {
+		case "parallel":
+			n, convErr := strconv.Atoi(val)
+			if convErr != nil || n < 1 {
+				return "", opts, found, fmt.Errorf("parallel= needs a positive number, got '%s'", val)
+			}
+			opts.parallel = n
+		case "rate":
+			interval, rateErr := parseRate(val)
+			if rateErr != nil {
+				return "", opts, found, rateErr
+			}
+			opts.interval = interval
+		case "delay", "jitter":
+			d, durErr := parseTimeout(val)
+			if durErr != nil {
+				return "", opts, found, fmt.Errorf("%s= needs a duration like 500ms or 2s, got '%s'", key, val)
+			}
+			if key == "delay" {
+				opts.delay = d
+			} else {
+				opts.jitter = d
+			}
+		case "on-error":
+			switch val {
+			case "stop":
+				opts.stopOnError = true
+			case "continue":
+				opts.stopOnError = false
+			default:
+				return "", opts, found, fmt.Errorf("on-error= must be 'stop' or 'continue', got '%s'", val)
+			}
+		}
+	}
+
+	return strings.Join(fields, " "), opts, found, nil
+}
+
+// parseRate turns "10/s", "30/m", "100/min" or "500/h" into the gap between starts
+func parseRate(val string) (time.Duration, error) {
+	count, unit := val, "s"
+	if i := strings.Index(val, "/"); i != -1 {
+		count, unit = val[:i], val[i+1:]
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("rate= needs a positive number per unit like 10/s, got '%s'", val)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s", "sec", "second":
+		per = time.Second
+	case "m", "min", "minute":
+		per = time.Minute
+	case "h", "hour":
+		per = time.Hour
+	default:
+		return 0, fmt.Errorf("rate= unit must be s, m or h, got '%s'", unit)
+	}
+	return time.Duration(float64(per) / n), nil
+}
+
+// pause returns how long to wait before starting the next iteration
+func (lo loopOptions) pause() time.Duration {
+	wait := lo.delay
+	if lo.interval > wait {
+		wait = lo.interval
+	}
+	if lo.jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(lo.jitter) + 1))
+	}
+	return wait
+}
+
+// loopIteration is one expanded command of a loop
+type loopIteration struct {
+	index   int
+	label   string // the loop variable's value
+	command string
+}
+
+// loopOutcome is a finished iteration with its isolated output
+type loopOutcome struct {
+	exitCode  int
+	iteration loopIteration
+	ok        bool
+	output    string
+}
+
+// runParallelLoop runs the iterations produced by next on a pool of lo.parallel workers,
+// each with its own output buffer, and prints them as they finish
+func (cli *CLI) runParallelLoop(varName, source string, total int, next func() (loopIteration, bool), lo loopOptions, cp *core.Checkpoint) {
+	// Iterations may redirect the CLI's output, the loop's own output stays put
+	out := cli.out()
+	fmt.Fprintln(out)
+	desc := fmt.Sprintf("Loop: %s ∈ %s  (%d items, parallel=%d", varName, source, total, lo.parallel)
+	if lo.interval > 0 {
+		desc += fmt.Sprintf(", one start every %s", lo.interval)
+	}
+	if lo.stopOnError {
+		desc += ", stop on error"
+	}
+	core.FprintInfo(out, desc+")")
+	fmt.Fprintln(out)
+
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	var failed atomic.Bool
+	stopped := func() bool {
+		return moduleExecutor.interrupted() || (lo.stopOnError && failed.Load())
+	}
+
+	iterations := make(chan loopIteration)
+	outcomes := make(chan loopOutcome)
+
+	// Start iterations at the configured pace until the source runs out or the loop stops
+	go func() {
+		defer close(iterations)
+		for i := 0; ; i++ {
+			if i > 0 {
+				if wait := lo.pause(); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			if stopped() {
+				return
+			}
+			it, ok := next()
+			if !ok {
+				return
+			}
+			select {
+			case iterations <- it:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < lo.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range iterations {
+				if stopped() {
+					continue // drain, counted as skipped
+				}
+				var buf bytes.Buffer
+				code := cli.runLoopIteration(ctx, it.command, &buf)
+				if code != 0 {
+					failed.Store(true)
+				}
+				outcomes <- loopOutcome{iteration: it, exitCode: code, ok: code == 0, output: buf.String()}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	started := time.Now()
+	done := 0
+	var failures []string
+	finished := make(map[int]bool) // iteration indexes, for the resume position
+	completed := 0                 // iterations 1..completed have all finished
+	drawLoopBar(out, done, total)
+	for o := range outcomes {
+		done++
+		if o.ok || !moduleExecutor.interrupted() {
+			finished[o.iteration.index] = true // a failure caused by Ctrl+C must run again
+			recordCheckpoint(cp, o.iteration, o.exitCode)
+		}
+		for finished[completed+1] {
+			delete(finished, completed+1)
+			completed++
+		}
+		fmt.Fprint(out, "\r\033[K")
+		printLoopOutcome(out, varName, o)
+		if !o.ok {
+			failures = append(failures, o.iteration.label)
+		}
+		drawLoopBar(out, done, total)
+	}
+	fmt.Fprint(out, "\r\033[K")
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, core.NmapBox("Summary"))
+	fmt.Fprintln(out, core.NmapSubBox(fmt.Sprintf("Items:     %d", total)))
+	fmt.Fprintln(out, core.NmapSubBox(fmt.Sprintf("Succeeded: %s", core.Color("green", fmt.Sprint(done-len(failures))))))
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		shown := failures
+		if len(shown) > 20 {
+			shown = append(shown[:20:20], fmt.Sprintf("... %d more", len(failures)-20))
+		}
+		fmt.Fprintln(out, core.NmapSubBox(fmt.Sprintf("Failed:    %s (%s)", core.Color("red", fmt.Sprint(len(failures))), strings.Join(shown, ", "))))
+	}
+	if skipped := total - done; skipped > 0 {
+		fmt.Fprintln(out, core.NmapSubBox(fmt.Sprintf("Skipped:   %s", core.Color("yellow", fmt.Sprint(skipped)))))
+	}
+	fmt.Fprintln(out)
+
+	duration := time.Since(started)
+	if moduleExecutor.interrupted() {
+		core.FprintWarning(out, fmt.Sprintf("Loop interrupted after %s", duration))
+	} else if len(failures) > 0 && lo.stopOnError {
+		core.FprintError(out, fmt.Sprintf("Loop stopped on first failure after %s", duration))
+	} else {
+		core.FprintSuccess(out, fmt.Sprintf("Loop finished in %s", duration))
+	}
+	if done < total && cp == nil {
+		core.FprintInfo(out, fmt.Sprintf("To continue where it stopped, rerun the loop with skip=%d", lo.source.skip+completed))
+	}
+	fmt.Fprintln(out)
+
+	cli.lastExitCode = 0
+	if len(failures) > 0 || moduleExecutor.interrupted() {
+		cli.lastExitCode = 1
+	}
+}
+
+// drawLoopBar redraws the loop's progress bar on the current line
+func drawLoopBar(w io.Writer, done, total int) {
+	fmt.Fprintf(w, "\r\033[K%s %d/%d", core.ProgressBar(done, total, 30), done, total)
+}
+
+// printLoopOutcome prints one iteration's header and its buffered output
+func printLoopOutcome(w io.Writer, varName string, o loopOutcome) {
+	mark := core.Color("green", "[+]")
+	if !o.ok {
+		mark = core.Color("red", "[-]")
+	}
+	fmt.Fprintln(w, core.NmapBox(fmt.Sprintf("%s %s=%s", mark, varName, o.iteration.label)))
+	for _, line := range splitLines(o.output) {
+		fmt.Fprintln(w, core.NmapSubBox(line))
+	}
+}
+
+// loopSerialMu serialises REPL built-ins inside parallel loops, they share the session state
+var loopSerialMu sync.Mutex
+
+// runLoopIteration runs one loop command with its output captured in out and returns its exit code.
+// Modules, pipes and shell commands run concurrently; other REPL commands run one at a time.
+func (cli *CLI) runLoopIteration(ctx context.Context, command string, out *bytes.Buffer) int {
+	list, err := parseCommandLine(command)
+	if err != nil {
+		fmt.Fprintln(out, core.Color("red", "Syntax error: "+err.Error()))
+		return 2
+	}
+	if len(list.chains) == 0 {
+		return 0
+	}
+
+	pipeline := list.onlyPipeline()
+	if pipeline == nil || len(pipeline.redirects) > 0 || pipeline.stages[0].loop != nil {
+		return cli.runLoopRepl(command)
+	}
+	if len(pipeline.stages) > 1 {
+		result, err := cli.runPipeline(ctx, pipeline.stages)
+		if err != nil {
+			fmt.Fprintln(out, core.Color("red", "Pipe error at "+err.Error()))
+			return 1
+		}
+		fmt.Fprintln(out, result)
+		return 0
+	}
+
+	cmd := pipeline.stages[0]
+	switch {
+	case cmd.name() == "echo" || cmd.name() == "print":
+		fmt.Fprintln(out, cli.expandValue(strings.Join(cmd.args(), " ")))
+		return 0
+
+	case strings.HasPrefix(cmd.text, "$"):
+		return cli.runLoopShell(strings.TrimSpace(cmd.text[1:]), out)
+
+	case cmd.name() == "run" && cli.currentModule != "":
+		return cli.runLoopModule(ctx, cli.currentModule, cli.currentModuleArgs(cmd.args()), out)
+
+	case cli.moduleExists(cmd.name()):
+		return cli.runLoopModule(ctx, cmd.name(), cmd.args(), out)
+
+	case isReplCommand(cmd.name()):
+		return cli.runLoopRepl(command)
+
+	default:
+		return cli.runLoopShell(cmd.text, out)
+	}
+}
+
+// runLoopRepl runs a REPL command for one iteration, one at a time, and returns its exit code
+func (cli *CLI) runLoopRepl(command string) int {
+	loopSerialMu.Lock()
+	defer loopSerialMu.Unlock()
+	cli.lastExitCode = 0
+	cli.ExecuteCommand(command)
+	return cli.lastExitCode
+}
+
+// runLoopModule runs a module quietly for one iteration and returns its exit code
+func (cli *CLI) runLoopModule(ctx context.Context, moduleName string, args []string, out *bytes.Buffer) int {
+	run, err := cli.resolveModuleRun(ctx, moduleName, args, out)
+	if err != nil {
+		fmt.Fprintln(out, core.Color("red", err.Error()))
+		return 2
+	}
+
+	started := time.Now()
+	var result *core.ExecutionResult
+	if run.threads > 1 {
+		result, err = cli.runModuleThreaded(ctx, run, shardOptions{exec: run.execOptions(true), out: out, ordered: run.ordered, stopped: moduleExecutor.interrupted})
+	} else {
+		result = cli.manager.ExecutePrepared(ctx, run.module, run.args, run.execOptions(true))
+	}
+	if err != nil {
+		fmt.Fprintln(out, core.Color("red", err.Error()))
+		return 1
+	}
+	cli.recordRun(moduleName, run.displayArgs(), result, time.Since(started))
+
+	if run.threads <= 1 {
+		out.WriteString(result.Output)
+		if !result.Success {
+			for _, line := range splitLines(result.Error) {
+				fmt.Fprintln(out, core.Color("red", line))
+			}
+		}
+	}
+	if n := len(result.Findings); n > 0 {
+		fmt.Fprintf(out, "\n%s\n", core.Color("cyan", fmt.Sprintf("%d finding(s) recorded", n)))
+	}
+	if !result.Success && result.ExitCode == 0 {
+		return 1
+	}
+	return result.ExitCode
+}
+
+// runLoopShell runs a shell command for one iteration in its own process group and returns its exit code
+func (cli *CLI) runLoopShell(command string, out *bytes.Buffer) int {
+	cmd, _, _ := cli.shellCommand(command)
+	cmd.Dir = cli.currentDirectory
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(out, core.Color("red", err.Error()))
+		return 127
+	}
+	moduleExecutor.track(cmd.Process.Pid)
+	err := cmd.Wait()
+	moduleExecutor.untrack(cmd.Process.Pid)
+
+	if err != nil {
+		fmt.Fprintln(out, core.Color("red", fmt.Sprintf("exit %d", exitStatus(err))))
+	}
+	return exitStatus(err)
+}
+
+// isReplCommand reports whether name is a built-in REPL command rather than a shell command
+func isReplCommand(name string) bool {
+	switch name {
+	case "help", "h", "?", "list", "ls", "modules", "search", "info", "use", "set", "run",
+		"create", "new", "edit", "delete", "rm", "remove", "env", "envs", "history",
+		"clear", "cls", "refresh", "reload", "modules-path", "module-paths",
+		"workspace", "workspaces", "ws", "hosts", "services", "findings", "runs", "jobs", "fg", "for",
+		"checkpoints", "resume", "builtins", "source", "wrapper", "doctor", "module":
+		return true
+	}
+	return strings.Contains(name, "=") || strings.HasSuffix(name, "!")
+}
+
+// rangeLoopIterations yields the range iterator's values substituted into the template
+func rangeLoopIterations(varName string, iter Iterator, commandTemplate string) func() (loopIteration, bool) {
+	re := regexp.MustCompile(`\$\{` + regexp.QuoteMeta(varName) + `\}|\$` + regexp.QuoteMeta(varName))
+	index := 0
+	var mu sync.Mutex
+	return func() (loopIteration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		value, ok := iter.Next()
+		if !ok {
+			return loopIteration{}, false
+		}
+		index++
+		return loopIteration{index: index, label: value, command: re.ReplaceAllLiteralString(commandTemplate, value)}, true
+	}
+}
+
+// dataLoopIterations yields loaded items substituted into the template
+func (cli *CLI) dataLoopIterations(varName string, items []interface{}, commandTemplate string) func() (loopIteration, bool) {
+	index := 0
+	return func() (loopIteration, bool) {
+		if index >= len(items) {
+			return loopIteration{}, false
+		}
+		item := items[index]
+		index++
+
+		label := fmt.Sprintf("%v", item)
+		if _, isString := item.(string); !isString {
+			label = fmt.Sprintf("#%d", index)
+		}
+		return loopIteration{index: index, label: label, command: cli.expandLoopItem(varName, item, commandTemplate)}, true
+	}
+}
+
+// substituteLoopVars replaces $var and ${var} for every loop variable. Longer names go
+// first so $h cannot clobber part of $host.
+func substituteLoopVars(vars, values []string, template string) string {
+	order := make([]int, len(vars))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(vars[order[a]]) > len(vars[order[b]]) })
+
+	for _, i := range order {
+		re := regexp.MustCompile(`\$\{` + regexp.QuoteMeta(vars[i]) + `\}|\$` + regexp.QuoteMeta(vars[i]))
+		template = re.ReplaceAllLiteralString(template, values[i])
+	}
+	return template
+}
+
+// tupleLoopIterations yields the tuple iterator's values substituted into the template
+func tupleLoopIterations(vars []string, iter TupleIterator, commandTemplate string) func() (loopIteration, bool) {
+	index := 0
+	var mu sync.Mutex
+	return func() (loopIteration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		values, ok := iter.Next()
+		if !ok {
+			return loopIteration{}, false
+		}
+		index++
+		return loopIteration{index: index, label: strings.Join(values, ","), command: substituteLoopVars(vars, values, commandTemplate)}, true
+	}
+}
+
+// executeTupleLoop runs a loop binding several variables, over a cartesian
+// product (A x B) or pairwise (zip(A, B))
+func (cli *CLI) executeTupleLoop(input string, vars []string, sourceExpr, commandTemplate string, lo loopOptions, parallel bool) {
+	tuples, err := parseTupleSource(sourceExpr, len(vars), lo.source.dedup)
+	if err != nil {
+		cli.printError(fmt.Sprintf("Cannot parse loop source: %v\nSource was: %s", err, sourceExpr))
+		return
+	}
+	iter := newWindowTupleIterator(tuples, lo.source)
+	defer iter.Close()
+
+	total := iter.Len()
+	if total == 0 {
+		cli.printWarning("Empty range - nothing to do")
+		return
+	}
+
+	cli.runLoop(input, strings.Join(vars, ","), sourceExpr, total, tupleLoopIterations(vars, iter, commandTemplate), lo, parallel)
+}
+
+// runLoop runs a loop's iterations one by one or in parallel, recording each finished
+// iteration in a checkpoint so an interrupted loop can be resumed
+func (cli *CLI) runLoop(input, varName, source string, total int, next func() (loopIteration, bool), lo loopOptions, parallel bool) {
+	cp, skip := cli.openCheckpoint(&core.Checkpoint{Kind: "loop", Command: input, Total: total})
+	next, total = skipFinished(next, skip, total)
+
+	if parallel {
+		cli.runParallelLoop(varName, source, total, next, lo, cp)
+	} else {
+		cli.runSequentialLoop(varName, source, total, next, cp)
+	}
+	closeCheckpoint(cp, cli.out())
+}
+
+// runSequentialLoop runs iterations one at a time with their output going straight to the terminal
+func (cli *CLI) runSequentialLoop(varName, source string, total int, next func() (loopIteration, bool), cp *core.Checkpoint) {
+	fmt.Fprintln(cli.out())
+	cli.printInfo(fmt.Sprintf("Loop: %s ∈ %s  (%d items)", varName, source, total))
+	fmt.Fprintln(cli.out())
+
+	// Ctrl+C during an item stops the loop, the items start executions of their own so
+	// moduleExecutor forgets it by the next one
+	if cli.loopDepth.Add(1) == 1 {
+		cli.loopStop.Store(false)
+	}
+	defer cli.loopDepth.Add(-1)
+
+	results := []string{}
+	done := 0
+	for !cli.loopStop.Load() {
+		it, ok := next()
+		if !ok {
+			break
+		}
+
+		code := 0
+		if pipeline := pipedCommand(it.command); pipeline != nil {
+			ctx := cli.startModuleExecution(0)
+			result, err := cli.runPipeline(ctx, pipeline.stages)
+			cli.stopModuleExecution()
+			if err != nil {
+				cli.printError(fmt.Sprintf("Pipe error at %v", err))
+				code = 1
+			} else if result != "" {
+				results = append(results, result)
+			}
+		} else {
+			cli.lastExitCode = 0
+			cli.ExecuteCommand(it.command)
+			code = cli.lastExitCode
+		}
+		if code == 0 || !cli.loopStop.Load() {
+			recordCheckpoint(cp, it, code) // an item failed by Ctrl+C must run again
+		}
+		done++
+	}
+
+	if cli.loopStop.Load() {
+		fmt.Fprintln(cli.out())
+		cli.printWarning(fmt.Sprintf("Loop interrupted, %d of %d items ran", done, total))
+		cli.lastExitCode = 1
+	}
+
+	if len(results) > 0 {
+		fmt.Fprintln(cli.out())
+		cli.printSuccess(fmt.Sprintf("Collected results (%d):", len(results)))
+		for i, res := range results {
+			fmt.Fprintf(cli.out(), "  [%2d] %s\n", i+1, strings.TrimSpace(res))
+		}
+		fmt.Fprintln(cli.out())
+	}
+}
+
+// pipedCommand returns the pipeline of a loop command made of a single |> pipeline
+// without redirections, whose results the loop collects, or nil
+func pipedCommand(command string) *cmdPipeline {
+	list, err := parseCommandLine(command)
+	if err != nil {
+		return nil
+	}
+	if pipeline := list.onlyPipeline(); pipeline != nil && len(pipeline.stages) > 1 && len(pipeline.redirects) == 0 {
+		return pipeline
+	}
+	return nil
+}
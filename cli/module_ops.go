@@ -2,25 +2,80 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"lanmanvan/core"
 )
 
-// RunModule executes a module with provided arguments
-// RunModule executes a module with provided arguments
-func (cli *CLI) RunModule(moduleName string, args []string) bool {
+// moduleRun holds a module's resolved arguments and the control flags stripped from them
+type moduleRun struct {
+	name    string
+	module  *core.ModuleConfig
+	args    map[string]string
+	rawArgs []string        // the arguments as typed, for checkpoints
+	given   map[string]bool // args passed to the run, not picked up from global variables
+	threads int
+	saveLog bool
+	timeout time.Duration
+	ordered bool     // threaded runs print items in input order
+	wrapper []string // command the module runs under, from wrap= or the wrapper command
+
+	// threads= splits the list-valued shardOption across workers
+	shardOption string
+	shardSource string
+	shardIter   Iterator
+	shardFirst  string
+	shardTotal  int
+}
+
+// secretMask replaces the value of secret options wherever arguments are shown or stored
+const secretMask = "********"
+
+// displayArgs returns the args to show and record: those passed to the run and the
+// options the module declares, never global variables it doesn't use, with secrets
+// masked and the sharded option's original list
+func (run *moduleRun) displayArgs() map[string]string {
+	args := make(map[string]string)
+	for name, value := range run.args {
+		if !run.given[name] && !moduleDeclaresOption(run.module, name) && !run.requires(name) {
+			continue
+		}
+		if run.isSecret(name) {
+			value = secretMask
+		}
+		args[name] = value
+	}
+	if run.shardOption != "" {
+		args[run.shardOption] = run.shardSource
+	}
+	return args
+}
+
+// resolveModuleRun merges module variables, CLI args and global env vars, extracts the
+// control flags and runs the module's preflight on the rest: validation, dependencies,
+// then the build, whose output goes to log. Validation problems are returned as
+// *core.ValidationError, unmet dependencies as *core.DependencyError.
+func (cli *CLI) resolveModuleRun(ctx context.Context, moduleName string, args []string, log io.Writer) (*moduleRun, error) {
+	return cli.resolveModuleRunWith(ctx, moduleName, args, nil, log)
+}
+
+// resolveModuleRunWith is resolveModuleRun with extra arguments, such as the input of a
+// pipe stage, that the CLI args override and that override module and global variables
+func (cli *CLI) resolveModuleRunWith(ctx context.Context, moduleName string, args []string, extra map[string]string, log io.Writer) (*moduleRun, error) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("%v", err))
-		return false // module not found → not handled
+		return nil, err
 	}
 
 	// Parse CLI-provided args (e.g., from 'run url=x')
@@ -28,17 +83,24 @@ func (cli *CLI) RunModule(moduleName string, args []string) bool {
 
 	// Start building final module arguments
 	moduleArgs := make(map[string]string)
+	given := make(map[string]bool)
 
 	// 1. Load module-scoped variables (from 'set') — if this is the current module
 	if cli.currentModule == moduleName {
 		for k, v := range cli.moduleVariables {
 			moduleArgs[k] = v
+			given[k] = true
 		}
 	}
 
 	// 2. Override with CLI args (e.g., run url=...)
+	for k, v := range extra {
+		moduleArgs[k] = v
+		given[k] = true
+	}
 	for k, v := range parsedArgs {
 		moduleArgs[k] = v
+		given[k] = true
 	}
 
 	// 3. Finally, fill in global env vars (lowest priority)
@@ -49,174 +111,374 @@ func (cli *CLI) RunModule(moduleName string, args []string) bool {
 	}
 
 	// Extract special control flags
-	threads := 1
-	saveLog := false
+	run := &moduleRun{name: moduleName, module: module, args: moduleArgs, rawArgs: args, given: given, threads: 1, wrapper: cli.wrapper}
 
 	if val, ok := moduleArgs["threads"]; ok {
-		fmt.Sscanf(val, "%d", &threads)
+		fmt.Sscanf(val, "%d", &run.threads)
 		delete(moduleArgs, "threads") // don't pass to module logic
 	}
 	if val, ok := moduleArgs["save"]; ok {
-		saveLog = val == "1" || val == "true" || val == "yes"
+		run.saveLog = val == "1" || val == "true" || val == "yes"
 		delete(moduleArgs, "save")
 	}
+	// timeout= is a control flag unless the module declares its own timeout option
+	if val, ok := moduleArgs["timeout"]; ok && !moduleDeclaresOption(module, "timeout") {
+		d, err := parseTimeout(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout '%s': %v (use e.g. timeout=30s, timeout=5m or timeout=90)", val, err)
+		}
+		run.timeout = d
+		delete(moduleArgs, "timeout")
+	}
+	// wrap= runs this module under sudo, proxychains and the like, wrap=none without the session wrapper
+	if val, ok := moduleArgs["wrap"]; ok && !moduleDeclaresOption(module, "wrap") {
+		wrapper, err := parseWrapper(val)
+		if err != nil {
+			return nil, err
+		}
+		run.wrapper = wrapper
+		delete(moduleArgs, "wrap")
+	}
+	// shard= names the option threads= splits, needed when the module doesn't declare it
+	if val, ok := moduleArgs["shard"]; ok && run.threads > 1 && !moduleDeclaresOption(module, "shard") {
+		run.shardOption = val
+		delete(moduleArgs, "shard")
+	}
+	if val, ok := moduleArgs["ordered"]; ok && run.threads > 1 && !moduleDeclaresOption(module, "ordered") {
+		run.ordered = val == "1" || val == "true" || val == "yes"
+		delete(moduleArgs, "ordered")
+	}
 
-	// Validate required args
-	if module.Metadata != nil && len(module.Metadata.Required) > 0 {
-		missing := []string{}
-		for _, req := range module.Metadata.Required {
-			if _, ok := moduleArgs[req]; !ok {
-				missing = append(missing, req)
-			}
+	// threads= splits a list-valued option (host=@file, host=10.0.0.1..254) across workers
+	if run.threads > 1 {
+		if err := cli.prepareShard(run); err != nil {
+			return nil, err
 		}
+	}
 
-		if len(missing) > 0 {
-			fmt.Println()
-			core.PrintWarning(fmt.Sprintf("Module '%s' requires arguments, skipping...", moduleName))
-			fmt.Println()
-			fmt.Println(core.NmapBox(fmt.Sprintf("MODULE: %s - USAGE", moduleName)))
-			fmt.Printf("   Description: %s\n\n", module.Metadata.Description)
-
-			fmt.Println("   Required Arguments:")
-			for _, opt := range missing {
-				if meta, ok := module.Metadata.Options[opt]; ok {
-					fmt.Printf("      * %s (%s) - %s\n", opt, meta.Type, meta.Description)
-				} else {
-					fmt.Printf("      * %s\n", opt)
-				}
-			}
+	// Once for the whole run, sharded or not: later items only check their own value
+	if err := cli.manager.Preflight(ctx, module, moduleArgs, cli.currentDirectory, log); err != nil {
+		if run.shardIter != nil {
+			run.shardIter.Close()
+		}
+		return nil, err
+	}
 
-			fmt.Printf("\n   Example Usage:\n")
-			fmt.Printf("      %s %s=value\n\n", moduleName, missing[0])
-			return true // handled (with error message), so return true to avoid shell fallback
+	return run, nil
+}
+
+// execOptions returns the core options for running the module
+func (run *moduleRun) execOptions(quiet bool) core.ExecOptions {
+	opts := moduleExecutor.execOptions(quiet)
+	opts.Wrapper = run.wrapper
+	return opts
+}
+
+// checkpointHeader describes a sharded run for its checkpoint. Secret options are left
+// out, resume takes them again.
+func (run *moduleRun) checkpointHeader() *core.Checkpoint {
+	cp := &core.Checkpoint{Kind: "module", Module: run.name, Total: run.shardTotal}
+	for _, arg := range run.rawArgs {
+		if name, _, ok := strings.Cut(arg, "="); ok && run.isSecret(strings.TrimSpace(name)) {
+			cp.Omitted = append(cp.Omitted, strings.TrimSpace(name))
+			continue
+		}
+		cp.Args = append(cp.Args, arg)
+	}
+	return cp
+}
+
+// requires reports whether the module lists name under required:
+func (run *moduleRun) requires(name string) bool {
+	if run.module.Metadata == nil {
+		return false
+	}
+	for _, required := range run.module.Metadata.Required {
+		if required == name {
+			return true
 		}
 	}
+	return false
+}
+
+// isSecret reports whether the module declares option name as a secret
+func (run *moduleRun) isSecret(name string) bool {
+	if run.module.Metadata == nil {
+		return false
+	}
+	opt, ok := run.module.Metadata.Options[name]
+	return ok && opt.IsSecret()
+}
+
+// prepareModuleRun resolves a run and reports problems. ok is false when the module
+// doesn't exist; a nil run with ok true means an error was already reported.
+func (cli *CLI) prepareModuleRun(moduleName string, args []string) (run *moduleRun, ok bool) {
+	// Building a virtualenv or binary can take a while, Ctrl+C cancels it
+	ctx := cli.startModuleExecution(0)
+	run, err := cli.resolveModuleRun(ctx, moduleName, args, cli.out())
+	cli.stopModuleExecution()
+	if err == nil {
+		return run, true
+	}
+
+	var verr *core.ValidationError
+	var derr *core.DependencyError
+	switch {
+	case errors.As(err, &verr):
+		module, _ := cli.manager.GetModule(moduleName)
+		cli.printModuleUsage(moduleName, module, verr)
+		cli.lastExitCode = 2
+		return nil, true // handled (with error message), so return true to avoid shell fallback
+	case errors.As(err, &derr):
+		// Report every missing dependency instead of letting the module fail
+		cli.printError(fmt.Sprintf("Module '%s' has unmet dependencies:", moduleName))
+		printDependencies(cli.out(), derr.Failed, "   ")
+		cli.lastExitCode = 1
+		return nil, true
+	}
+	cli.printError(err.Error())
+	cli.lastExitCode = 1
+	return nil, cli.moduleExists(moduleName) // module not found → not handled
+}
+
+// RunModule executes a module with provided arguments
+func (cli *CLI) RunModule(moduleName string, args []string) bool {
+	run, ok := cli.prepareModuleRun(moduleName, args)
+	if run == nil {
+		return ok
+	}
+	threads, saveLog, timeout := run.threads, run.saveLog, run.timeout
 
 	// Enable logging if requested
 	if saveLog {
 		if err := cli.logger.EnableFileLogging(moduleName); err != nil {
-			core.PrintWarning(fmt.Sprintf("Could not enable file logging: %v", err))
+			cli.printWarning(fmt.Sprintf("Could not enable file logging: %v", err))
 		}
 		defer cli.logger.Close()
 	}
 
 	startTime := time.Now()
 
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 	if threads > 1 {
-		core.PrintInfo(fmt.Sprintf(
-			"Executing module '%s' with %d threads...",
-			core.Color("cyan", moduleName), threads))
+		cli.printInfo(fmt.Sprintf(
+			"Executing module '%s' with %d threads over %d values of %s...",
+			core.Color("cyan", moduleName), threads, run.shardTotal, core.Color("cyan", run.shardOption)))
 	} else {
-		core.PrintInfo(fmt.Sprintf(
+		cli.printInfo(fmt.Sprintf(
 			"Executing module '%s'...",
 			core.Color("cyan", moduleName)))
 	}
+	if timeout > 0 {
+		cli.printInfo(fmt.Sprintf("Timeout: %s", timeout))
+	}
 	if saveLog {
-		core.PrintSuccess(fmt.Sprintf("Output saved to: %s", cli.logger.GetFilePath()))
+		cli.printSuccess(fmt.Sprintf("Output saved to: %s", cli.logger.GetFilePath()))
 	}
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 
-	cli.startModuleExecution()
+	ctx := cli.startModuleExecution(timeout)
 	defer cli.stopModuleExecution()
 
 	var result *core.ExecutionResult
 	var execErr error
 
 	if threads > 1 {
-		result, execErr = cli.runModuleThreaded(moduleName, moduleArgs, threads)
+		cp, skip := cli.openCheckpoint(run.checkpointHeader())
+		result, execErr = cli.runModuleThreaded(ctx, run, shardOptions{
+			exec:       run.execOptions(true),
+			out:        cli.out(),
+			bar:        true,
+			ordered:    run.ordered,
+			stopped:    moduleExecutor.interrupted,
+			checkpoint: cp,
+			skip:       skip,
+		})
 	} else {
-		result, execErr = cli.manager.ExecuteModule(moduleName, moduleArgs)
+		opts := run.execOptions(false)
+		opts.Stdout, opts.Stderr = cli.out(), cli.errOut()
+		result = cli.manager.ExecutePrepared(ctx, run.module, run.args, opts)
+	}
+
+	if result != nil && (moduleExecutor.interrupted() || result.Interrupted) {
+		// A module owning the terminal got Ctrl+C itself, a running script or loop stops all the same
+		if result.Interrupted && cli.scriptDepth.Load() > 0 && !cli.scriptStop.Swap(true) {
+			cli.printWarning("Stopping the script after the current command")
+		}
+		if result.Interrupted && cli.loopDepth.Load() > 0 && !cli.loopStop.Swap(true) {
+			cli.printWarning("Stopping the loop after the current item")
+		}
+		result.Interrupted = true
+		result.Cancelled = true
+		result.Success = false
+		if result.Error == "" {
+			result.Error = "interrupted"
+		}
 	}
 
 	duration := time.Since(startTime)
 
 	if execErr != nil {
-		core.PrintError(fmt.Sprintf("Execution failed: %v", execErr))
-		fmt.Println()
+		cli.lastExitCode = 1
+		cli.printError(fmt.Sprintf("Execution failed: %v", execErr))
+		fmt.Fprintln(cli.out())
 		return true // handled
 	}
 
-	if result.Output != "" {
-		fmt.Println(core.NmapBox("Output"))
-		for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
-			if line != "" {
-				fmt.Println(core.NmapSubBox(line))
-			}
-		}
-		fmt.Println()
+	cli.lastExitCode = result.ExitCode
+	if !result.Success && cli.lastExitCode == 0 {
+		cli.lastExitCode = 1
 	}
+	cli.recordRun(moduleName, run.displayArgs(), result, duration)
 
-	if result.Error != "" {
-		core.PrintError("Error Output:")
+	if saveLog {
+		cli.logger.LogCaptured(result.Output, result.Error)
+	}
+
+	// Output was streamed live (single runs) or printed per item (threaded runs)
+	if result.Error != "" && threads <= 1 && !result.Success {
+		cli.printError("Error Output:")
 		for _, line := range strings.Split(result.Error, "\n") {
 			if line != "" {
-				fmt.Printf("  %s\n", core.Color("red", line))
+				fmt.Fprintf(cli.out(), "  %s\n", core.Color("red", line))
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(cli.out())
 	}
 
-	if result.Success {
-		core.PrintSuccess(fmt.Sprintf("Completed in %s [exit: %d]", duration, result.ExitCode))
+	cli.printStructuredResults(result)
+
+	if result.OutputTruncated {
+		cli.printWarning(fmt.Sprintf("Captured output was truncated to %d bytes per stream", cli.manager.OutputLimit))
+	}
+
+	if result.Interrupted {
+		cli.printWarning(fmt.Sprintf("Interrupted after %s [exit: %d]", duration, result.ExitCode))
+	} else if result.TimedOut {
+		cli.printError(fmt.Sprintf("Timed out after %s [exit: %d]", duration, result.ExitCode))
+	} else if result.Cancelled {
+		cli.printWarning(fmt.Sprintf("Cancelled after %s [exit: %d]", duration, result.ExitCode))
+	} else if result.Success {
+		cli.printSuccess(fmt.Sprintf("Completed in %s [exit: %d]", duration, result.ExitCode))
 	} else {
-		core.PrintError(fmt.Sprintf("Failed in %s [exit: %d]", duration, result.ExitCode))
+		cli.printError(fmt.Sprintf("Failed in %s [exit: %d]", duration, result.ExitCode))
 	}
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 
 	return true // successfully handled (even if module failed)
 }
 
-// runModuleThreaded executes a module with multiple threads
-func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, threads int) (*core.ExecutionResult, error) {
-	_, err := cli.manager.GetModule(moduleName)
-	if err != nil {
-		return nil, err
+// printStructuredResults shows findings, artifacts and outputs reported by the module
+func (cli *CLI) printStructuredResults(result *core.ExecutionResult) {
+	if len(result.Findings) > 0 {
+		fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Findings (%d)", len(result.Findings))))
+		table := core.NewTable([]string{"Host", "Port", "Service", "Severity", "Title"})
+		for _, f := range result.Findings {
+			port := ""
+			if f.Port > 0 {
+				port = strconv.Itoa(f.Port)
+			}
+			table.AddRow(f.Host, port, f.Service, f.Severity, f.Title)
+		}
+		fmt.Fprint(cli.out(), table.Render())
+		fmt.Fprintln(cli.out())
 	}
 
-	var wg sync.WaitGroup
-	results := make(chan *core.ExecutionResult, threads)
-	var outputs []string
-	var mu sync.Mutex
-
-	wg.Add(threads)
-
-	for i := 0; i < threads; i++ {
-		go func(threadID int) {
-			defer wg.Done()
-			result, _ := cli.manager.ExecuteModule(moduleName, args)
-			if result != nil {
-				mu.Lock()
-				outputs = append(outputs, fmt.Sprintf("[Thread : %d] %s", threadID, result.Output))
-				mu.Unlock()
+	if len(result.Artifacts) > 0 {
+		fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Artifacts (%d)", len(result.Artifacts))))
+		for _, a := range result.Artifacts {
+			line := a.Path
+			if a.Description != "" {
+				line += " - " + a.Description
 			}
-			results <- result
-		}(i + 1)
+			fmt.Fprintln(cli.out(), core.NmapSubBox(line))
+		}
+		fmt.Fprintln(cli.out())
 	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	if len(result.Outputs) > 0 {
+		fmt.Fprintln(cli.out(), core.NmapBox("Outputs"))
+		keys := make([]string, 0, len(result.Outputs))
+		for k := range result.Outputs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintln(cli.out(), core.NmapSubBox(fmt.Sprintf("%s = %s", core.Color("cyan", k), result.Outputs[k])))
+		}
+		fmt.Fprintln(cli.out())
+	}
+}
 
-	// Collect all results
-	finalResult := &core.ExecutionResult{
-		Success:   true,
-		Timestamp: time.Now(),
-		ExitCode:  0,
+// printModuleUsage shows the usage box listing missing and invalid arguments
+func (cli *CLI) printModuleUsage(moduleName string, module *core.ModuleConfig, verr *core.ValidationError) {
+	fmt.Fprintln(cli.out())
+	if len(verr.Missing) > 0 {
+		cli.printWarning(fmt.Sprintf("Module '%s' requires arguments, skipping...", moduleName))
+	} else {
+		cli.printWarning(fmt.Sprintf("Module '%s' got invalid arguments, skipping...", moduleName))
+	}
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("MODULE: %s - USAGE", moduleName)))
+	fmt.Fprintf(cli.out(), "   Description: %s\n\n", module.Metadata.Description)
+
+	if len(verr.Missing) > 0 {
+		fmt.Fprintln(cli.out(), "   Required Arguments:")
+		for _, opt := range verr.Missing {
+			if meta, ok := module.Metadata.Options[opt]; ok {
+				fmt.Fprintf(cli.out(), "      * %s (%s) - %s\n", opt, meta.Type, meta.Description)
+			} else {
+				fmt.Fprintf(cli.out(), "      * %s\n", opt)
+			}
+		}
 	}
 
-	for result := range results {
-		if result != nil && !result.Success {
-			finalResult.Success = false
+	if len(verr.Invalid) > 0 {
+		if len(verr.Missing) > 0 {
+			fmt.Fprintln(cli.out())
+		}
+		fmt.Fprintln(cli.out(), "   Invalid Arguments:")
+		for _, inv := range verr.Invalid {
+			meta := module.Metadata.Options[inv.Option]
+			fmt.Fprintf(cli.out(), "      * %s (%s) = %s - %s\n", inv.Option, meta.Type, core.Color("red", inv.Value), inv.Message)
 		}
 	}
 
-	mu.Lock()
-	finalResult.Output = strings.Join(outputs, "\n")
-	mu.Unlock()
+	fmt.Fprintf(cli.out(), "\n   Example Usage:\n")
+	if len(verr.Missing) > 0 {
+		fmt.Fprintf(cli.out(), "      %s %s=value\n\n", moduleName, verr.Missing[0])
+	} else {
+		fmt.Fprintf(cli.out(), "      %s %s=value\n\n", moduleName, verr.Invalid[0].Option)
+	}
+}
+
+// moduleDeclaresOption reports whether a module's metadata defines the named option
+func moduleDeclaresOption(module *core.ModuleConfig, name string) bool {
+	if module.Metadata == nil {
+		return false
+	}
+	_, ok := module.Metadata.Options[name]
+	return ok
+}
 
-	return finalResult, nil
+// parseTimeout parses a timeout value, either a Go duration (30s, 5m, 1h30m)
+// or a plain number of seconds
+func parseTimeout(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	if secs, err := strconv.Atoi(val); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("timeout must not be negative")
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("timeout must not be negative")
+	}
+	return d, nil
 }
 
 // CreateModule creates a new module
@@ -226,27 +488,32 @@ func (cli *CLI) CreateModule(moduleName string, args []string) {
 		moduleType = strings.ToLower(args[0])
 	}
 
-	if moduleType != "python" && moduleType != "bash" && moduleType != "ruby" {
-		core.PrintError("Invalid type. Use 'python', 'bash', or 'ruby', default is 'python'")
+	// The runtime of the type provides the main file
+	var scriptName, scriptContent string
+	if rt := core.LookupRuntime(moduleType); rt != nil {
+		scriptName, scriptContent = rt.Template(moduleName)
+	}
+	if scriptName == "" {
+		cli.printError(fmt.Sprintf("No template for type '%s', use one of: %s, default is 'python'", moduleType, strings.Join(templateTypes(), ", ")))
 		return
 	}
 
 	// Use the first modules directory for creating new modules
 	if len(cli.manager.ModulesDirs) == 0 {
-		core.PrintError("No modules directories configured")
+		cli.printError("No modules directories configured")
 		return
 	}
 	moduleDir := filepath.Join(cli.manager.ModulesDirs[0], moduleName)
 
 	// Check if already exists
 	if _, err := os.Stat(moduleDir); err == nil {
-		core.PrintError(fmt.Sprintf("Module '%s' already exists, skipping...", moduleName))
+		cli.printError(fmt.Sprintf("Module '%s' already exists, skipping...", moduleName))
 		return
 	}
 
 	// Create directory
 	if err := os.MkdirAll(moduleDir, 0755); err != nil {
-		core.PrintError(fmt.Sprintf("Failed to create module directory: %v, skipping...", err))
+		cli.printError(fmt.Sprintf("Failed to create module directory: %v, skipping...", err))
 		return
 	}
 
@@ -269,90 +536,42 @@ required:
 
 	yamlPath := filepath.Join(moduleDir, "module.yaml")
 	if err := ioutil.WriteFile(yamlPath, []byte(yamlContent), 0644); err != nil {
-		core.PrintError(fmt.Sprintf("Failed to create module.yaml: %v", err))
+		cli.printError(fmt.Sprintf("Failed to create module.yaml: %v", err))
 		return
 	}
 
 	// Create main script
-	var scriptContent, scriptName string
-
-	if moduleType == "python" {
-		scriptName = "main.py"
-		scriptContent = `#!/usr/bin/env python3
-"""
-Module: ` + moduleName + `
-Description: Your module description
-"""
-
-import os
-import sys
-
-def main():
-    # Get arguments from environment variables
-    target = os.getenv('ARG_TARGET') or 'localhost'
-    
-    print(f"[*] Module executing on {target}")
-    
-    try:
-        # Your code here
-        print("[+] Module completed successfully!")
-    except Exception as e:
-        print(f"[!] Error: {e}")
-        sys.exit(1)
-
-if __name__ == '__main__':
-    main()
-`
-	} else if moduleType == "ruby" {
-		scriptName = "main.rb"
-		scriptContent = `#!/usr/bin/env ruby
-# Module: ` + moduleName + `
-# Description: Your module description
-
-target = ENV['ARG_TARGET'] || 'localhost'
-
-puts "[*] Module executing on #{target}"
-
-begin
-  # Your code here
-  puts "[+] Module completed successfully!"
-rescue => e
-  puts "[!] Error: #{e.message}"
-  exit 1
-end
-`
-	} else {
-		scriptName = "main.sh"
-		scriptContent = `#!/bin/bash
-# Module: ` + moduleName + `
-# Description: Your module description
-
-TARGET="${ARG_TARGET:-localhost}"
-
-echo "[*] Module executing on $TARGET"
-
-# Your code here
-
-echo "[+] Module completed successfully!"
-`
-	}
-
 	scriptPath := filepath.Join(moduleDir, scriptName)
 	if err := ioutil.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
-		core.PrintError(fmt.Sprintf("Failed to create main script: %v", err))
+		cli.printError(fmt.Sprintf("Failed to create main script: %v", err))
 		return
 	}
 
-	core.PrintSuccess(fmt.Sprintf("Module '%s' created successfully", moduleName))
-	core.PrintInfo(fmt.Sprintf("Location: %s", moduleDir))
-	fmt.Println()
+	cli.printSuccess(fmt.Sprintf("Module '%s' created successfully", moduleName))
+	cli.printInfo(fmt.Sprintf("Location: %s", moduleDir))
+	fmt.Fprintln(cli.out())
+}
+
+// templateTypes lists the module types create can scaffold
+func templateTypes() []string {
+	var types []string
+	for _, rt := range core.Runtimes() {
+		if file, _ := rt.Template(""); file != "" {
+			types = append(types, rt.Name())
+		}
+	}
+	return types
 }
 
 // EditModule allows editing module files
 func (cli *CLI) EditModule(moduleName string) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Module not found: %v, try: 'search %v'", err, moduleName))
+		cli.printError(fmt.Sprintf("Module not found: %v, try: 'search %v'", err, moduleName))
+		return
+	}
+	if module.Native != nil {
+		cli.printError(fmt.Sprintf("Module '%s' is native (compiled into lmv) and can't be edited", moduleName))
 		return
 	}
 
@@ -361,69 +580,73 @@ func (cli *CLI) EditModule(moduleName string) {
 		editor = "nano"
 	}
 
-	core.PrintInfo(fmt.Sprintf("Edit module '%s' (directory: %s), using editor: %s, press Ctrl+X to save", moduleName, module.Path))
-	fmt.Println()
+	cli.printInfo(fmt.Sprintf("Edit module '%s' (directory: %s), using editor: %s, press Ctrl+X to save", moduleName, module.Path, editor))
+	fmt.Fprintln(cli.out())
 
 	files, err := ioutil.ReadDir(module.Path)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Failed to read module directory: %v", err))
+		cli.printError(fmt.Sprintf("Failed to read module directory: %v", err))
 		return
 	}
 
-	fmt.Println("Files in module:")
+	fmt.Fprintln(cli.out(), "Files in module:")
 	for i, file := range files {
 		prefix := "├─ "
 		if i == len(files)-1 {
 			prefix = "└─ "
 		}
 		if file.IsDir() {
-			fmt.Printf("  %s%s/\n", prefix, core.Color("blue", file.Name()))
+			fmt.Fprintf(cli.out(), "  %s%s/\n", prefix, core.Color("blue", file.Name()))
 			subfiles, _ := os.ReadDir(filepath.Join(module.Path, file.Name()))
 			for j, subfile := range subfiles {
 				subprefix := "│  ├─ "
 				if j == len(subfiles)-1 {
 					subprefix = "│  └─ "
 				}
-				fmt.Printf("  %s%s\n", subprefix, core.Color("green", subfile.Name()))
+				fmt.Fprintf(cli.out(), "  %s%s\n", subprefix, core.Color("green", subfile.Name()))
 			}
 		} else {
-			fmt.Printf("  %s%s\n", prefix, core.Color("green", file.Name()))
+			fmt.Fprintf(cli.out(), "  %s%s\n", prefix, core.Color("green", file.Name()))
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(cli.out())
 
-	core.PrintInfo("Tip: Use 'run' command to test your changes")
-	fmt.Println()
+	cli.printInfo("Tip: Use 'run' command to test your changes")
+	fmt.Fprintln(cli.out())
 }
 
 // DeleteModule removes a module
 func (cli *CLI) DeleteModule(moduleName string) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Module not found: %v, try: 'search %v'", err, moduleName))
+		cli.printError(fmt.Sprintf("Module not found: %v, try: 'search %v'", err, moduleName))
+		return
+	}
+	if module.Native != nil {
+		cli.printError(fmt.Sprintf("Module '%s' is native (compiled into lmv) and can't be deleted", moduleName))
 		return
 	}
 
-	fmt.Println()
-	core.PrintWarning(fmt.Sprintf("About to delete module: %s", moduleName))
-	fmt.Printf("Are you sure? (yes/no): ")
+	fmt.Fprintln(cli.out())
+	cli.printWarning(fmt.Sprintf("About to delete module: %s", moduleName))
+	fmt.Fprintf(cli.out(), "Are you sure? (yes/no): ")
 
 	reader := bufio.NewReader(os.Stdin)
 	response, _ := reader.ReadString('\n')
 	response = strings.TrimSpace(response)
 
 	if strings.ToLower(response) != "yes" {
-		core.PrintInfo("Cancelled")
+		cli.printInfo("Cancelled")
 		return
 	}
 
 	if err := os.RemoveAll(module.Path); err != nil {
-		core.PrintError(fmt.Sprintf("Failed to delete module: %v", err))
+		cli.printError(fmt.Sprintf("Failed to delete module: %v", err))
 		return
 	}
 
-	core.PrintSuccess(fmt.Sprintf("Module '%s' deleted successfully", moduleName))
-	fmt.Println()
+	cli.printSuccess(fmt.Sprintf("Module '%s' deleted successfully", moduleName))
+	fmt.Fprintln(cli.out())
 }
 
 // parseArguments parses command-line arguments with support for quoted strings and variable expansion
@@ -463,6 +686,12 @@ func (cli *CLI) parseArguments(args []string) map[string]string {
 							break
 						}
 					}
+				} else if strings.Contains(value, "$(") {
+					// Rejoin a $(builtin args) call that was split on spaces
+					for parenDepth(value) > 0 && i+1 < len(args) {
+						i++
+						value += " " + args[i]
+					}
 				}
 
 				// Expand variables and builtins in the value
@@ -495,18 +724,27 @@ func (cli *CLI) parseArguments(args []string) map[string]string {
 	return result
 }
 
+// parenDepth returns how many parentheses in s are left open
+func parenDepth(s string) int {
+	return strings.Count(s, "(") - strings.Count(s, ")")
+}
+
 // expandValue expands variables and builtin function calls in a value
 // Supports: $varname, $(builtin_func arg1 arg2)
 func (cli *CLI) expandValue(value string) string {
-
-	// Then, handle variable expansion: $variable_name
-	value = cli.expandVariables(value)
-
-	return value
+	expanded, err := cli.expandBuiltins(value)
+	if err != nil {
+		cli.printWarning(fmt.Sprintf("Could not expand '%s': %v", value, err))
+		return cli.expandVariables(value)
+	}
+	return expanded
 }
 
 // expandVariables expands $variable_name references
 func (cli *CLI) expandVariables(value string) string {
+	// $? is the exit code of the previous command
+	value = strings.ReplaceAll(value, "$?", strconv.Itoa(cli.exitStatus))
+
 	// Pattern: $varname (word characters only)
 	variablePattern := regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
 
@@ -0,0 +1,349 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"lanmanvan/core"
+)
+
+// The command language, from the loosest binding to the tightest:
+//
+//	list     := chain ((';' | '&') chain)* [';' | '&']
+//	chain    := pipeline (('&&' | '||') pipeline)*
+//	pipeline := command ('|>' command)* ['|>' 'tee' ['-a'] word] (redirect word)*
+//	redirect := '>' | '>>' | '2>' | '2>>' | '&>' | '&>>'
+//	command  := 'for' ... '->' ... | word+
+
+// cmdList is a parsed command line: chains run one after another
+type cmdList struct {
+	chains []*cmdChain
+}
+
+// cmdChain is pipelines joined by && and ||, run in the background when it ends with &
+type cmdChain struct {
+	pipelines  []*cmdPipeline
+	ops        []string // ops[i] joins pipelines[i] and pipelines[i+1]
+	background bool
+	text       string // source text, without the &
+}
+
+// cmdPipeline is commands joined by |>, with optional output redirections
+type cmdPipeline struct {
+	stages    []*simpleCmd
+	redirects []*redirection
+	text      string // source text of the stages, without the redirections
+}
+
+// simpleCmd is a command with its arguments, or a whole for loop
+type simpleCmd struct {
+	words []string // with quotes removed
+	loop  *forLoop // for ... in ... -> ..., nil for other commands
+	text  string   // source text
+}
+
+// forLoop is a parsed for loop. Its source and body stay source text: the source is
+// parsed by the loop iterators and the body is expanded and parsed per item.
+type forLoop struct {
+	vars   []string // without $
+	source string   // with any trailing loop options
+	body   string
+	text   string // source text of the whole loop
+}
+
+// redirection sends a pipeline's output to a file
+type redirection struct {
+	op     string // >, >>, 2>, 2>>, &>, &>>, or tee / tee -a for a trailing |> tee stage
+	target string
+}
+
+// name returns the command name
+func (c *simpleCmd) name() string {
+	return c.words[0]
+}
+
+// args returns the command arguments
+func (c *simpleCmd) args() []string {
+	return c.words[1:]
+}
+
+// onlyPipeline returns the pipeline of a command line holding a single foreground
+// pipeline, or nil
+func (l *cmdList) onlyPipeline() *cmdPipeline {
+	if len(l.chains) != 1 || len(l.chains[0].pipelines) != 1 || l.chains[0].background {
+		return nil
+	}
+	return l.chains[0].pipelines[0]
+}
+
+// parser builds the AST of a command line from its tokens
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+// parseCommandLine lexes and parses a command line
+func parseCommandLine(input string) (*cmdList, error) {
+	tokens, err := lexCommandLine(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{input: input, tokens: tokens}
+	return p.parseList()
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// errorAt returns a parse error pointing at tok
+func (p *parser) errorAt(tok token, format string, args ...interface{}) error {
+	return &parseError{pos: tok.pos, msg: fmt.Sprintf(format, args...)}
+}
+
+// parseList parses chains separated by ; and &
+func (p *parser) parseList() (*cmdList, error) {
+	list := &cmdList{}
+	for {
+		for p.peek().kind == tokSemi {
+			p.next()
+		}
+		if p.peek().kind == tokEOF {
+			return list, nil
+		}
+
+		chain, err := p.parseChain()
+		if err != nil {
+			return nil, err
+		}
+		list.chains = append(list.chains, chain)
+
+		switch tok := p.next(); tok.kind {
+		case tokEOF:
+			return list, nil
+		case tokSemi:
+		case tokAmp:
+			chain.background = true
+		default:
+			return nil, p.errorAt(tok, "unexpected %s", tok.kind)
+		}
+	}
+}
+
+// parseChain parses pipelines joined by && and ||
+func (p *parser) parseChain() (*cmdChain, error) {
+	start := p.peek()
+	chain := &cmdChain{}
+	for {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		chain.pipelines = append(chain.pipelines, pipeline)
+
+		tok := p.peek()
+		if tok.kind != tokAnd && tok.kind != tokOr {
+			chain.text = p.input[start.pos:p.tokens[p.pos-1].end]
+			return chain, nil
+		}
+		p.next()
+		chain.ops = append(chain.ops, tok.text)
+		if err := p.expectCommandAfter(tok); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parsePipeline parses commands joined by |> and the trailing redirections
+func (p *parser) parsePipeline() (*cmdPipeline, error) {
+	start := p.peek()
+	pipeline := &cmdPipeline{}
+	for {
+		stageStart := p.peek()
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+
+		// A last |> tee [-a] file stage copies the output of the others to a file
+		if len(pipeline.stages) > 0 && cmd.name() == "tee" && cmd.loop == nil && p.peek().kind != tokPipe {
+			redirect, err := teeRedirection(cmd, stageStart.pos)
+			if err != nil {
+				return nil, err
+			}
+			pipeline.redirects = append(pipeline.redirects, redirect)
+			break
+		}
+		pipeline.stages = append(pipeline.stages, cmd)
+		pipeline.text = p.input[start.pos:p.tokens[p.pos-1].end]
+
+		if p.peek().kind != tokPipe {
+			break
+		}
+		if err := p.expectCommandAfter(p.next()); err != nil {
+			return nil, err
+		}
+	}
+
+	for tok := p.peek(); tok.kind == tokRedirect; tok = p.peek() {
+		p.next()
+		target := p.next()
+		if target.kind != tokWord {
+			return nil, p.errorAt(target, "expected a file name after '%s'", tok.text)
+		}
+		pipeline.redirects = append(pipeline.redirects, &redirection{op: tok.text, target: target.text})
+		if next := p.peek(); next.kind == tokPipe || next.kind == tokWord {
+			return nil, p.errorAt(next, "unexpected %s after the redirection to %s", describeToken(next), target.text)
+		}
+	}
+	return pipeline, nil
+}
+
+// teeRedirection turns a tee [-a] <file> stage into a redirection
+func teeRedirection(cmd *simpleCmd, pos int) (*redirection, error) {
+	args := cmd.args()
+	op := "tee"
+	if len(args) > 0 && args[0] == "-a" {
+		op, args = "tee -a", args[1:]
+	}
+	if len(args) != 1 {
+		return nil, &parseError{pos: pos, msg: "expected 'tee [-a] <file>'"}
+	}
+	return &redirection{op: op, target: args[0]}, nil
+}
+
+// parseCommand parses a for loop or a command with its arguments
+func (p *parser) parseCommand() (*simpleCmd, error) {
+	start := p.peek()
+	if start.kind != tokWord {
+		return nil, p.errorAt(start, "expected a command before %s", start.kind)
+	}
+	if start.text == "for" {
+		return p.parseFor()
+	}
+
+	cmd := &simpleCmd{}
+	for tok := p.peek(); tok.kind == tokWord || tok.kind == tokArrow; tok = p.peek() {
+		cmd.words = append(cmd.words, p.next().text)
+	}
+	cmd.text = p.input[start.pos:p.tokens[p.pos-1].end]
+	return cmd, nil
+}
+
+// expectCommandAfter reports a missing command after the operator op
+func (p *parser) expectCommandAfter(op token) error {
+	if tok := p.peek(); tok.kind != tokWord {
+		return p.errorAt(tok, "expected a command after '%s'", op.text)
+	}
+	return nil
+}
+
+// parseFor parses for <vars> in <source> [options] -> <body>. The body runs once per
+// item, so its pipes and redirections belong to it; it ends at ;, &&, || or &.
+func (p *parser) parseFor() (*simpleCmd, error) {
+	start := p.next()
+	var in, arrow *token
+	var vars []string
+	for {
+		tok := p.peek()
+		if tok.kind == tokEOF || tok.kind == tokSemi || tok.kind == tokAnd || tok.kind == tokOr || tok.kind == tokAmp {
+			break
+		}
+		p.next()
+		if tok.kind == tokWord && tok.text == "in" && in == nil && arrow == nil {
+			in = &tok
+		} else if in == nil {
+			vars = append(vars, tok.text)
+		}
+		if tok.kind == tokArrow && arrow == nil {
+			arrow = &tok
+		}
+	}
+
+	last := p.tokens[p.pos-1]
+	switch {
+	case in == nil:
+		return nil, p.errorAt(start, "for loop needs 'in': for <var> in <source> -> <command>")
+	case len(vars) == 0:
+		return nil, p.errorAt(*in, "for loop needs a variable before 'in'")
+	case arrow == nil:
+		return nil, p.errorAt(p.peek(), "for loop needs '-> <command>' after the source")
+	case arrow.end == last.end:
+		return nil, p.errorAt(p.peek(), "for loop has no command after '->'")
+	}
+
+	loop := &forLoop{
+		source: strings.TrimSpace(p.input[in.end:arrow.pos]),
+		body:   strings.TrimSpace(p.input[arrow.end:last.end]),
+		text:   p.input[start.pos:last.end],
+	}
+	// for host,port / for $host, $port: the words are split on commas
+	for _, name := range strings.Split(strings.Join(vars, ","), ",") {
+		if name = strings.TrimPrefix(strings.TrimSpace(name), "$"); name != "" {
+			loop.vars = append(loop.vars, name)
+		}
+	}
+	if len(loop.vars) == 0 {
+		return nil, p.errorAt(*in, "for loop needs a variable before 'in'")
+	}
+	return &simpleCmd{words: []string{"for"}, loop: loop, text: loop.text}, nil
+}
+
+// parseForLoop parses a command line holding a single for loop, e.g. the command of a
+// loop checkpoint
+func parseForLoop(input string) (*forLoop, error) {
+	list, err := parseCommandLine(input)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := list.onlyPipeline()
+	if pipeline == nil || len(pipeline.stages) != 1 || pipeline.stages[0].loop == nil {
+		return nil, fmt.Errorf("not a for loop: %s", input)
+	}
+	return pipeline.stages[0].loop, nil
+}
+
+// describeToken names a token for error messages
+func describeToken(tok token) string {
+	if tok.kind == tokWord {
+		return fmt.Sprintf("'%s'", tok.text)
+	}
+	return tok.kind.String()
+}
+
+// printParseError prints a parse error with a caret under the offending position
+func printParseError(w io.Writer, input string, err error) {
+	perr, ok := err.(*parseError)
+	if !ok {
+		core.FprintError(w, err.Error())
+		return
+	}
+	core.FprintError(w, "Syntax error: "+perr.msg)
+	printCaret(w, input, perr.pos)
+}
+
+// printCaret prints the line of input holding pos with a caret under it
+func printCaret(w io.Writer, input string, pos int) {
+	lineStart := strings.LastIndexByte(input[:pos], '\n') + 1
+	lineEnd := len(input)
+	if i := strings.IndexByte(input[pos:], '\n'); i >= 0 {
+		lineEnd = pos + i
+	}
+	column := utf8.RuneCountInString(input[lineStart:pos])
+
+	fmt.Fprintf(w, "    %s\n", input[lineStart:lineEnd])
+	fmt.Fprintf(w, "    %s%s\n", strings.Repeat(" ", column), core.Color("red", "^"))
+}
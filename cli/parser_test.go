@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// describeList renders a parsed command line compactly: chains separated by " ; ",
+// stages by " |> ", words in brackets, loops as for{vars|source|body}
+func describeList(list *cmdList) string {
+	var chains []string
+	for _, chain := range list.chains {
+		var parts []string
+		for i, pipeline := range chain.pipelines {
+			if i > 0 {
+				parts = append(parts, chain.ops[i-1])
+			}
+			var stages []string
+			for _, stage := range pipeline.stages {
+				if stage.loop != nil {
+					stages = append(stages, "for{"+strings.Join(stage.loop.vars, ",")+"|"+stage.loop.source+"|"+stage.loop.body+"}")
+					continue
+				}
+				stages = append(stages, "["+strings.Join(stage.words, "][")+"]")
+			}
+			text := strings.Join(stages, " |> ")
+			for _, r := range pipeline.redirects {
+				text += " " + r.op + " " + r.target
+			}
+			parts = append(parts, text)
+		}
+		text := strings.Join(parts, " ")
+		if chain.background {
+			text += " &"
+		}
+		chains = append(chains, text)
+	}
+	return strings.Join(chains, " ; ")
+}
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"portscan host=h", "[portscan][host=h]"},
+		{"a; b;; c;", "[a] ; [b] ; [c]"},
+		{"a && b || c", "[a] && [b] || [c]"},
+		{"a & b", "[a] & ; [b]"},
+		{"a |> b |> c > out.txt", "[a] |> [b] |> [c] > out.txt"},
+		{"a 2>> err.log &> all.log", "[a] 2>> err.log &> all.log"},
+		{"a |> tee out.txt", "[a] tee out.txt"},
+		{"a |> tee -a out.txt", "[a] tee -a out.txt"},
+		{"a |> tee x |> b", "[a] |> [tee][x] |> [b]"},
+		{"for x in 1..3 -> echo $x", "for{x|1..3|echo $x}"},
+		{"for $h, $p in @hosts.txt x 22|80 parallel=4 -> scan host=$h port=$p",
+			"for{h,p|@hosts.txt x 22|80 parallel=4|scan host=$h port=$p}"},
+		{"for a,b in zip(1..3, a..c) -> echo $a$b", "for{a,b|zip(1..3, a..c)|echo $a$b}"},
+		{"for x in 1..2 -> a $x |> b > out; echo done", "for{x|1..2|a $x |> b > out} ; [echo][done]"},
+		{"for x in 1..2 -> a && b", "for{x|1..2|a} && [b]"},
+		{`for w in $cat("a;b.txt") -> echo $w`, `for{w|$cat("a;b.txt")|echo $w}`},
+		{"echo sha(a;b); next", "[echo][sha(a;b)] ; [next]"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		list, err := parseCommandLine(tt.input)
+		if err != nil {
+			t.Errorf("parseCommandLine(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got := describeList(list); got != tt.want {
+			t.Errorf("parseCommandLine(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseCommandLineTexts(t *testing.T) {
+	list, err := parseCommandLine(`echo "a b" |> up > out && for x in 1..2 -> echo $x ; last &`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := list.chains[0]
+	if first.text != `echo "a b" |> up > out && for x in 1..2 -> echo $x` {
+		t.Errorf("chain text = %q", first.text)
+	}
+	var texts []string
+	for _, stage := range first.pipelines[0].stages {
+		texts = append(texts, stage.text)
+	}
+	if !reflect.DeepEqual(texts, []string{`echo "a b"`, "up"}) {
+		t.Errorf("stage texts = %q", texts)
+	}
+	if loop := first.pipelines[1].stages[0].loop; loop == nil || loop.text != "for x in 1..2 -> echo $x" {
+		t.Errorf("loop = %+v, want its source text", loop)
+	}
+	if second := list.chains[1]; second.text != "last" || !second.background {
+		t.Errorf("second chain = %q background=%v, want \"last\" in the background", second.text, second.background)
+	}
+}
+
+func TestParseCommandLineErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"&& b", "expected a command before '&&'"},
+		{"a &&", "expected a command after '&&'"},
+		{"a |>", "expected a command after '|>'"},
+		{"a >", "expected a file name after '>'"},
+		{"a > out b", "unexpected 'b' after the redirection to out"},
+		{"a |> tee", "expected 'tee [-a] <file>'"},
+		{"for x 1..3 -> echo", "for loop needs 'in'"},
+		{"for in 1..3 -> echo", "for loop needs a variable before 'in'"},
+		{"for , in 1..3 -> echo", "for loop needs a variable before 'in'"},
+		{"for x in 1..3", "for loop needs '-> <command>'"},
+		{"for x in 1..3 ->", "for loop has no command after '->'"},
+		{`echo "open`, "unterminated \" quote"},
+	}
+	for _, tt := range tests {
+		_, err := parseCommandLine(tt.input)
+		if err == nil {
+			t.Errorf("parseCommandLine(%q) succeeded, want %q", tt.input, tt.msg)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("parseCommandLine(%q) error = %q, want %q", tt.input, err, tt.msg)
+		}
+	}
+}
+
+func TestParseForLoop(t *testing.T) {
+	loop, err := parseForLoop("for host in 10.0.0.0/30 -> ping host=$host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &forLoop{vars: []string{"host"}, source: "10.0.0.0/30", body: "ping host=$host", text: "for host in 10.0.0.0/30 -> ping host=$host"}
+	if !reflect.DeepEqual(loop, want) {
+		t.Errorf("parseForLoop = %+v, want %+v", loop, want)
+	}
+
+	// The pipes belong to the loop body, a second command does not
+	if loop, err := parseForLoop("for x in 1..2 -> a |> b"); err != nil || loop.body != "a |> b" {
+		t.Errorf("parseForLoop with a piped body = %+v, %v", loop, err)
+	}
+	for _, input := range []string{"echo hi", "for x in 1..2 -> a; b", "a |> for x in 1..2 -> b"} {
+		if loop, err := parseForLoop(input); err == nil {
+			t.Errorf("parseForLoop(%q) = %+v, want an error", input, loop)
+		}
+	}
+}
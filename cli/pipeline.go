@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pipeStageError is a failed pipeline stage
+type pipeStageError struct {
+	stage   int
+	command string
+	err     error
+}
+
+// Error implements the error interface
+func (e *pipeStageError) Error() string {
+	return fmt.Sprintf("stage %d (%s): %v", e.stage, e.command, e.err)
+}
+
+// runPipeline runs the stages of a pipeline, each reading the previous stage's output,
+// and returns the output of the last one
+func (cli *CLI) runPipeline(ctx context.Context, stages []*simpleCmd) (string, error) {
+	for i, stage := range stages {
+		if stage.loop != nil {
+			return "", &pipeStageError{stage: i + 1, command: stage.text, err: fmt.Errorf("a for loop can't be a pipeline stage")}
+		}
+	}
+
+	result := ""
+	for i, stage := range stages {
+		if ctx.Err() != nil || moduleExecutor.interrupted() {
+			return "", &pipeStageError{stage: i + 1, command: stage.text, err: fmt.Errorf("interrupted")}
+		}
+		out, err := cli.executePipedCommand(ctx, stage, result, i > 0)
+		if err != nil {
+			return "", &pipeStageError{stage: i + 1, command: stage.text, err: err}
+		}
+		result = out
+	}
+	return result, nil
+}
+
+// executePipedCommands runs a pipeline typed at the prompt and prints its output
+// Example: whoami() |> sha256() or $ cat file.txt |> base64() |> file(out.b64)
+func (cli *CLI) executePipedCommands(stages []*simpleCmd) {
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	result, err := cli.runPipeline(ctx, stages)
+	if err != nil {
+		cli.printError(fmt.Sprintf("Pipe error at %v", err))
+		cli.lastExitCode = 1
+		return
+	}
+	cli.lastExitCode = 0
+
+	// A file() sink handles the output itself
+	if path, _, ok := cli.fileSink(stages[len(stages)-1]); ok {
+		cli.printSuccess(fmt.Sprintf("Pipeline output written to %s", path))
+		return
+	}
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), result)
+	fmt.Fprintln(cli.out())
+}
+
+// executePipedCommand runs one stage of a pipeline. piped is false for the first stage,
+// which has no input. Supports: "literal", file(path), tee [-a] path, builtin(args),
+// $ shell command, module arg=value and run arg=value for the current module.
+func (cli *CLI) executePipedCommand(ctx context.Context, stage *simpleCmd, input string, piped bool) (string, error) {
+	// Handle string literals in pipes: "\n", "\t", "text", etc.
+	if text := stage.text; len(stage.words) == 1 && len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0] {
+		// The lexer removed the quotes, process the escape sequences it leaves
+		literal := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r").Replace(stage.words[0])
+
+		// String literals just pass through, appended to the input
+		return input + literal, nil
+	}
+
+	// file(path) writes the input to a file and passes it on
+	if path, appendMode, ok := cli.fileSink(stage); ok {
+		if !piped {
+			return "", fmt.Errorf("file() needs input, use it after |>")
+		}
+		return input, writePipeFile(path, input, appendMode)
+	}
+
+	// tee [-a] path is file(path) as a last stage, like | tee in a shell
+	if stage.name() == "tee" {
+		redirect, err := teeRedirection(stage, 0)
+		if err != nil {
+			return "", fmt.Errorf("expected 'tee [-a] <file>'")
+		}
+		if !piped {
+			return "", fmt.Errorf("tee needs input, use it after |>")
+		}
+		return input, writePipeFile(cli.outputPath(redirect.target), input, redirect.op == "tee -a")
+	}
+
+	// Builtin stages take the piped input as their last argument
+	if b, argsStr, ok := cli.pipeBuiltin(stage); ok {
+		args, err := cli.parseAdvancedArguments(argsStr, true)
+		if err != nil {
+			return "", err
+		}
+		if piped {
+			args = append(args, input)
+		}
+		result, err := b.fn(cli, args)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", b.name, err)
+		}
+		return result, nil
+	}
+
+	// $ command runs in the shell with the input on stdin; the shell does its own quoting
+	if strings.HasPrefix(stage.text, "$") {
+		return cli.executeShellForPipe(strings.TrimSpace(stage.text[1:]), input, piped)
+	}
+
+	switch {
+	case stage.name() == "run" && cli.currentModule != "":
+		return cli.executeModuleForPipe(ctx, cli.currentModule, cli.currentModuleArgs(stage.args()), input, piped)
+	case cli.moduleExists(stage.name()):
+		return cli.executeModuleForPipe(ctx, stage.name(), stage.args(), input, piped)
+	}
+
+	return "", fmt.Errorf("unknown command '%s', expected a module, builtin(), $ shell command, \"literal\" or file(path)", stage.name())
+}
+
+// pipeBuiltin recognizes a builtin pipe stage, name(args) or $(name args),
+// and returns the builtin with its unparsed arguments
+func (cli *CLI) pipeBuiltin(stage *simpleCmd) (*builtin, string, bool) {
+	if len(stage.words) != 1 {
+		return nil, "", false
+	}
+	cmd := stage.words[0]
+	if !strings.HasSuffix(cmd, ")") {
+		return nil, "", false
+	}
+	if name := cli.builtinCallName(cmd, 0); name != "" && cli.findMatchingParen(cmd, 2) == len(cmd)-1 {
+		inner := strings.TrimSpace(cmd[2 : len(cmd)-1])
+		return lookupBuiltin(name), inner[len(name):], true
+	}
+
+	i := 0
+	name := cli.collectIdentifier(cmd, &i)
+	b := lookupBuiltin(name)
+	if b == nil || i >= len(cmd) || cmd[i] != '(' || cli.findMatchingParen(cmd, i+1) != len(cmd)-1 {
+		return nil, "", false
+	}
+	return b, cmd[i+1 : len(cmd)-1], true
+}
+
+// fileSink recognizes a file(path) or file(path, append) stage and returns the resolved path
+func (cli *CLI) fileSink(stage *simpleCmd) (path string, appendMode bool, ok bool) {
+	if len(stage.words) != 1 {
+		return "", false, false
+	}
+	cmd := stage.words[0]
+	if !strings.HasPrefix(cmd, "file(") || !strings.HasSuffix(cmd, ")") {
+		return "", false, false
+	}
+	args, err := cli.parseAdvancedArguments(cmd[len("file("):len(cmd)-1], true)
+	if err != nil || len(args) == 0 || len(args) > 2 {
+		return "", false, false
+	}
+
+	path = cli.outputPath(args[0])
+	if len(args) == 2 {
+		appendMode = args[1] == "append" || args[1] == "a"
+	}
+	return path, appendMode, true
+}
+
+// writePipeFile writes pipeline output to path as one line-terminated block
+func writePipeFile(path, data string, appendMode bool) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if data != "" && !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// executeShellForPipe runs a shell command with the input on stdin and returns its stdout
+func (cli *CLI) executeShellForPipe(command, input string, piped bool) (string, error) {
+	if command == "" {
+		return "", fmt.Errorf("empty shell command")
+	}
+	cmd, _, _ := cli.shellCommand(command)
+	cmd.Dir = cli.currentDirectory
+	if piped {
+		cmd.Stdin = pipeStdin(input)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	moduleExecutor.track(cmd.Process.Pid)
+	err := cmd.Wait()
+	moduleExecutor.untrack(cmd.Process.Pid)
+
+	if err != nil {
+		return "", stageFailure(exitStatus(err), stderr.String())
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// executeModuleForPipe runs a module quietly and returns its output. The input is written
+// to the module's stdin, and given as its input option when the module declares one.
+func (cli *CLI) executeModuleForPipe(ctx context.Context, moduleName string, args []string, input string, piped bool) (string, error) {
+	module, err := cli.manager.GetModule(moduleName)
+	if err != nil {
+		return "", err
+	}
+
+	var extra map[string]string
+	if piped && moduleDeclaresOption(module, "input") {
+		extra = map[string]string{"input": input}
+	}
+	run, err := cli.resolveModuleRunWith(ctx, moduleName, args, extra, nil)
+	if err != nil {
+		return "", err
+	}
+	if run.threads > 1 {
+		if run.shardIter != nil {
+			run.shardIter.Close()
+		}
+		return "", fmt.Errorf("threads= is not supported in a pipeline")
+	}
+
+	if run.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.timeout)
+		defer cancel()
+	}
+	opts := run.execOptions(true)
+	if piped {
+		opts.Stdin = pipeStdin(input)
+	}
+
+	startTime := time.Now()
+	result := cli.manager.ExecutePrepared(ctx, run.module, run.args, opts)
+	cli.recordRun(moduleName, run.displayArgs(), result, time.Since(startTime))
+	if !result.Success {
+		code := result.ExitCode
+		if code == 0 {
+			code = 1
+		}
+		return "", stageFailure(code, result.Error)
+	}
+
+	return strings.TrimRight(result.Output, "\r\n"), nil
+}
+
+// pipeStdin returns the input of a stage as a newline-terminated stream
+func pipeStdin(input string) io.Reader {
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	return strings.NewReader(input)
+}
+
+// stageFailure describes a stage that exited non-zero, with the last line of its stderr
+func stageFailure(exitCode int, stderr string) error {
+	lines := splitLines(strings.TrimSpace(stderr))
+	if len(lines) == 0 {
+		return fmt.Errorf("exit %d", exitCode)
+	}
+	return fmt.Errorf("exit %d: %s", exitCode, lines[len(lines)-1])
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pipeModules are the modules of the pipeline tests: upcase reads stdin, say prints its msg option
+var pipeModules = map[string]testModule{
+	"upcase": {script: "tr a-z A-Z\n"},
+	"say":    {yaml: "options:\n  msg:\n    type: string\n", script: "echo \"[$ARG_MSG]\"\n"},
+}
+
+func TestRunPipeline(t *testing.T) {
+	cli := newTestCLI(t, pipeModules)
+
+	tests := []struct {
+		input string
+		want  string
+		file  string // file the pipeline writes, relative to the session directory
+		data  string
+	}{
+		{input: `"a b" |> upper()`, want: "A B"},
+		{input: `"x\ty" |> hex()`, want: "780979"},
+		{input: `"a b" |> tee "my file" |> upcase`, want: "A B", file: "my file", data: "a b\n"},
+		{input: `"a;b" |> file("out file.txt")`, want: "a;b", file: "out file.txt", data: "a;b\n"},
+		{input: `$ bash echo "a  b" |> upcase`, want: "A  B"},
+		{input: `say msg="x |> y"`, want: "[x |> y]"},
+		{input: `say msg="a b" |> upcase`, want: "[A B]"},
+	}
+
+	for _, tt := range tests {
+		list, err := parseCommandLine(tt.input)
+		if err != nil {
+			t.Fatalf("parseCommandLine(%q) error: %v", tt.input, err)
+		}
+		got, err := cli.runPipeline(context.Background(), list.onlyPipeline().stages)
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.input, got, tt.want)
+		}
+		if tt.file != "" {
+			data, err := os.ReadFile(filepath.Join(cli.currentDirectory, tt.file))
+			if err != nil || string(data) != tt.data {
+				t.Errorf("%s wrote %q (%v), want %q", tt.input, data, err, tt.data)
+			}
+		}
+	}
+}
+
+func TestRunPipelineErrors(t *testing.T) {
+	cli := newTestCLI(t, pipeModules)
+
+	tests := []struct {
+		input string
+		stage int
+		msg   string
+	}{
+		{input: `upper() |> nosuch x`, stage: 2, msg: "unknown command 'nosuch'"},
+		{input: `file(out.txt) |> upper()`, stage: 1, msg: "file() needs input"},
+		{input: `"a" |> $ bash exit 3`, stage: 2, msg: "exit 3"},
+		{input: `"a" |> for x in 1..2 -> echo $x`, stage: 2, msg: "can't be a pipeline stage"},
+	}
+
+	for _, tt := range tests {
+		list, err := parseCommandLine(tt.input)
+		if err != nil {
+			t.Fatalf("parseCommandLine(%q) error: %v", tt.input, err)
+		}
+		_, err = cli.runPipeline(context.Background(), list.onlyPipeline().stages)
+		perr, ok := err.(*pipeStageError)
+		if !ok {
+			t.Errorf("%s: error = %v, want a *pipeStageError", tt.input, err)
+			continue
+		}
+		if perr.stage != tt.stage || !strings.Contains(perr.err.Error(), tt.msg) {
+			t.Errorf("%s: error = %v, want stage %d with %q", tt.input, err, tt.stage, tt.msg)
+		}
+	}
+}
+
+func TestRunLoopIterationWords(t *testing.T) {
+	cli := newTestCLI(t, pipeModules)
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: `say msg="a b"`, want: "[a b]\n"},
+		{command: `"a b" |> upcase`, want: "A B\n"},
+		{command: `echo "a  b"`, want: "a  b\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := cli.runLoopIteration(ctx, tt.command, &out); code != 0 {
+			t.Errorf("%s exited %d: %s", tt.command, code, out.String())
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s printed %q, want %q", tt.command, out.String(), tt.want)
+		}
+	}
+}
+
+func TestPipeModuleInput(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{
+		"count": {yaml: "options:\n  input:\n    type: string\n", script: "echo \"$ARG_INPUT\" | wc -l | tr -d ' '\n"},
+		"fail":  {script: "echo boom >&2\nexit 4\n"},
+	})
+
+	if got, err := cli.runPipeline(context.Background(), mustStages(t, `"a\nb\nc" |> count`)); err != nil || got != "3" {
+		t.Errorf("count of the piped input = %q (%v), want 3", got, err)
+	}
+
+	cli.ExecuteCommand(`"a" |> fail |> upper()`)
+	if cli.lastExitCode != 1 {
+		t.Errorf("exit code after a failed stage = %d, want 1", cli.lastExitCode)
+	}
+	_, err := cli.runPipeline(context.Background(), mustStages(t, `"a" |> fail`))
+	if err == nil || !strings.Contains(err.Error(), "stage 2 (fail): exit 4: boom") {
+		t.Errorf("error = %v, want stage 2 with the exit code and last stderr line", err)
+	}
+}
+
+// mustStages parses a single pipeline
+func mustStages(t *testing.T, input string) []*simpleCmd {
+	t.Helper()
+	list, err := parseCommandLine(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.onlyPipeline().stages
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputRedirect holds the files of one command's redirections. While it runs the
+// CLI's writers point at them, so our own messages and the output of the modules and
+// shell commands it starts go to the files, and to the screen in tee mode.
+type outputRedirect struct {
+	stdout, stderr io.Writer // the writers to restore
+	files          []*os.File
+	mu             sync.Mutex
+	err            error // first write error
+}
+
+// runRedirected runs a pipeline with its output redirected
+func (cli *CLI) runRedirected(pipeline *cmdPipeline) {
+	redirect, err := cli.openRedirect(pipeline.redirects)
+	if err != nil {
+		cli.printError(fmt.Sprintf("Redirection failed: %v", err))
+		cli.lastExitCode = 1
+		return
+	}
+
+	func() {
+		defer redirect.restore(cli)
+		if len(pipeline.stages) > 1 {
+			cli.executePipedCommands(pipeline.stages)
+		} else {
+			cli.runCommand(pipeline.stages[0])
+		}
+	}()
+
+	if err := redirect.err; err != nil {
+		cli.printError(fmt.Sprintf("Writing redirected output failed: %v", err))
+		cli.lastExitCode = 1
+	}
+}
+
+// openRedirect opens the redirection targets and points the CLI's writers at them
+func (cli *CLI) openRedirect(redirects []*redirection) (*outputRedirect, error) {
+	cli.outMu.Lock()
+	r := &outputRedirect{stdout: cli.stdout, stderr: cli.stderr}
+	cli.outMu.Unlock()
+	stdout, stderr := r.stdout, r.stderr
+
+	// Destinations of each stream; &> sends both to the same file
+	var toStdout, toStderr []io.Writer
+	opened := make(map[string]io.Writer)
+	for _, redirect := range redirects {
+		path := cli.outputPath(redirect.target)
+		w, ok := opened[path]
+		if !ok {
+			flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+			if strings.HasSuffix(redirect.op, ">>") || redirect.op == "tee -a" {
+				flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			}
+			f, err := os.OpenFile(path, flags, 0644)
+			if err != nil {
+				r.closeFiles()
+				return nil, err
+			}
+			r.files = append(r.files, f)
+			w = &ansiStripper{w: f}
+			opened[path] = w
+		}
+
+		switch redirect.op {
+		case "2>", "2>>":
+			toStderr = append(toStderr, w)
+		case "&>", "&>>":
+			toStdout = append(toStdout, w)
+			toStderr = append(toStderr, w)
+		case "tee", "tee -a":
+			toStdout = append(toStdout, w, cli.out())
+		default:
+			toStdout = append(toStdout, w)
+		}
+	}
+
+	if len(toStdout) > 0 {
+		stdout = &redirectWriter{r: r, w: io.MultiWriter(toStdout...)}
+	}
+	if len(toStderr) > 0 {
+		stderr = &redirectWriter{r: r, w: io.MultiWriter(toStderr...)}
+	}
+	cli.setOutput(stdout, stderr)
+	return r, nil
+}
+
+// restore puts the CLI's writers back and closes the files
+func (r *outputRedirect) restore(cli *CLI) {
+	cli.setOutput(r.stdout, r.stderr)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeFiles()
+}
+
+// closeFiles closes the redirection targets
+func (r *outputRedirect) closeFiles() {
+	for _, f := range r.files {
+		if err := f.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	r.files = nil
+}
+
+// redirectWriter writes one stream of a redirection. Writes are serialized, as a
+// file shared by both streams may be written from two copies at once, and after the
+// first error the rest of the output is dropped so the command runs on.
+type redirectWriter struct {
+	r *outputRedirect
+	w io.Writer
+}
+
+// Write implements io.Writer
+func (rw *redirectWriter) Write(p []byte) (int, error) {
+	rw.r.mu.Lock()
+	defer rw.r.mu.Unlock()
+	if rw.r.err == nil {
+		if _, err := rw.w.Write(p); err != nil {
+			rw.r.err = err
+		}
+	}
+	return len(p), nil
+}
+
+// outputPath resolves a file name given at the prompt: ~ is expanded and relative
+// paths are relative to the current directory
+func (cli *CLI) outputPath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(cli.currentDirectory, path)
+	}
+	return path
+}
+
+// ansiStripper drops ANSI escape sequences, so colored output reads well in a file.
+// It keeps its state between writes, as a sequence can be split across them.
+type ansiStripper struct {
+	w     io.Writer
+	state int // 0: text, 1: after ESC, 2: inside ESC [ ...
+}
+
+// Write implements io.Writer
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	for _, c := range p {
+		switch s.state {
+		case 0:
+			if c == 0x1b {
+				s.state = 1
+			} else {
+				out = append(out, c)
+			}
+		case 1:
+			// ESC [ starts a CSI sequence, ESC plus any other byte is a two-byte sequence
+			if c == '[' {
+				s.state = 2
+			} else {
+				s.state = 0
+			}
+		case 2:
+			// A CSI sequence ends with a byte in @..~
+			if c >= 0x40 && c <= 0x7e {
+				s.state = 0
+			}
+		}
+	}
+	if _, err := s.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
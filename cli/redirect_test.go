@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// redirectModules are the modules of the redirection tests
+var redirectModules = map[string]testModule{
+	"noisy": {script: "echo to-out\necho to-err >&2\n"},
+	"slow":  {script: "sleep 0.3\necho from-job\n"},
+}
+
+// termBuffer stands in for the terminal, which a command's two streams write at once
+type termBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *termBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *termBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *termBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func TestRedirectOutput(t *testing.T) {
+	cli := newTestCLI(t, redirectModules)
+	term := &termBuffer{}
+	cli.stdout, cli.stderr = term, term
+
+	tests := []struct {
+		input     string
+		file      string
+		inFile    []string // text the file must hold
+		notFile   []string
+		onScreen  []string // text the terminal must show
+		offScreen []string
+	}{
+		{input: `echo hi > out.txt`, file: "out.txt", inFile: []string{"hi\n"}, offScreen: []string{"hi"}},
+		{input: `echo again >> out.txt`, file: "out.txt", inFile: []string{"hi\nagain\n"}},
+		{input: `noisy > out.log`, file: "out.log", inFile: []string{"to-out"}, notFile: []string{"to-err"}, onScreen: []string{"to-err"}, offScreen: []string{"to-out"}},
+		{input: `noisy 2> err.log`, file: "err.log", inFile: []string{"to-err"}, notFile: []string{"to-out"}, onScreen: []string{"to-out"}, offScreen: []string{"to-err"}},
+		{input: `noisy &> all.log`, file: "all.log", inFile: []string{"to-out", "to-err"}, offScreen: []string{"to-out", "to-err"}},
+		{input: `$ bash echo shell |> tee tee.txt`, file: "tee.txt", inFile: []string{"shell"}, onScreen: []string{"shell"}},
+	}
+
+	for _, tt := range tests {
+		term.Reset()
+		cli.ExecuteCommand(tt.input)
+		if cli.stdout != term || cli.stderr != term {
+			t.Fatalf("%s: the CLI's writers were not restored", tt.input)
+		}
+
+		data, err := os.ReadFile(filepath.Join(cli.currentDirectory, tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.input, err)
+			continue
+		}
+		for _, s := range tt.inFile {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: %s = %q, want %q in it", tt.input, tt.file, data, s)
+			}
+		}
+		for _, s := range tt.notFile {
+			if strings.Contains(string(data), s) {
+				t.Errorf("%s: %s = %q, want no %q in it", tt.input, tt.file, data, s)
+			}
+		}
+		for _, s := range tt.onScreen {
+			if !strings.Contains(term.String(), s) {
+				t.Errorf("%s: terminal shows %q, want %q", tt.input, term.String(), s)
+			}
+		}
+		for _, s := range tt.offScreen {
+			if strings.Contains(term.String(), s) {
+				t.Errorf("%s: terminal shows %q, want no %q", tt.input, term.String(), s)
+			}
+		}
+	}
+}
+
+func TestRedirectLeavesJobsAlone(t *testing.T) {
+	cli := newTestCLI(t, redirectModules)
+	term := &termBuffer{}
+	cli.stdout, cli.stderr = term, term
+
+	if !cli.StartJob("slow", nil) {
+		t.Fatal("job did not start")
+	}
+	job := cli.jobs.running()[0]
+	cli.ExecuteCommand(`echo hi > out.txt`)
+	<-job.done
+
+	data, err := os.ReadFile(filepath.Join(cli.currentDirectory, "out.txt"))
+	if err != nil || string(data) != "hi\n" {
+		t.Errorf("out.txt = %q (%v), want only the redirected command's output", data, err)
+	}
+	if !strings.Contains(job.output.String(), "from-job") {
+		t.Errorf("job output = %q, want the module's output", job.output.String())
+	}
+}
+
+func TestAnsiStripper(t *testing.T) {
+	var buf bytes.Buffer
+	s := &ansiStripper{w: &buf}
+	// A sequence split across writes is still dropped
+	for _, p := range []string{"\x1b[31mred", "\x1b[", "0m plain\x1b", "c!"} {
+		if n, err := s.Write([]byte(p)); err != nil || n != len(p) {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	if got := buf.String(); got != "red plain!" {
+		t.Errorf("stripped = %q, want %q", got, "red plain!")
+	}
+}
@@ -0,0 +1,636 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// stmtKind is the kind of a script statement
+type stmtKind int
+
+const (
+	stmtCommand  stmtKind = iota // a command line
+	stmtIf                       // if cond { ... } else { ... }
+	stmtWhile                    // while cond { ... }
+	stmtFunc                     // func name(params) { ... }
+	stmtReturn                   // return [code]
+	stmtBreak                    // break
+	stmtContinue                 // continue
+	stmtInclude                  // include other.lmv
+	stmtErrexit                  // set -e / set +e
+)
+
+// scriptStmt is one statement of a .lmv script
+type scriptStmt struct {
+	kind     stmtKind
+	file     string
+	line     int
+	text     string // command, condition, return code or include path
+	body     []*scriptStmt
+	elseBody []*scriptStmt // an else if is an if statement alone in here
+	name     string        // function name
+	params   []string      // function parameters
+	errexit  bool          // set -e rather than set +e
+}
+
+// scriptFunc is a function defined by a script, callable like a command
+type scriptFunc struct {
+	name   string
+	params []string
+	body   []*scriptStmt
+	runner *scriptRunner
+}
+
+// scriptError is an error at a line of a script
+type scriptError struct {
+	file string
+	line int
+	src  string // the line, for syntax errors
+	err  error
+}
+
+// Error implements the error interface
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.file, e.line, e.err)
+}
+
+// maxCallDepth bounds function recursion
+const maxCallDepth = 100
+
+var (
+	ifPattern    = regexp.MustCompile(`^if\s+(.+?)\s*\{$`)
+	elsePattern  = regexp.MustCompile(`^\}\s*else\s*\{$`)
+	elifPattern  = regexp.MustCompile(`^\}\s*else\s+if\s+(.+?)\s*\{$`)
+	whilePattern = regexp.MustCompile(`^while\s+(.+?)\s*\{$`)
+	funcPattern  = regexp.MustCompile(`^func\s+([A-Za-z_][A-Za-z0-9_]*)\s*(?:\(([^)]*)\))?\s*\{$`)
+	paramPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// scriptParser turns the lines of a script into statements
+type scriptParser struct {
+	file  string
+	lines []string
+	pos   int // index of the next line
+}
+
+// parseScript parses a script. Every command line is syntax-checked up front,
+// so a typo on line 40 is reported before line 1 runs.
+func parseScript(file, src string) ([]*scriptStmt, error) {
+	p := &scriptParser{file: file, lines: strings.Split(src, "\n")}
+	stmts, closer, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	if closer != "" {
+		return nil, p.errorf(p.pos, "unexpected '%s' without an open block", closer)
+	}
+	return stmts, nil
+}
+
+// errorf returns an error at line n (1-based)
+func (p *scriptParser) errorf(n int, format string, args ...interface{}) error {
+	return &scriptError{file: p.file, line: n, err: fmt.Errorf(format, args...)}
+}
+
+// parseBlock parses statements up to a closing line - }, } else { or } else if ... { -
+// which it returns, or to the end of the script when closer is empty
+func (p *scriptParser) parseBlock(inLoop bool) (stmts []*scriptStmt, closer string, err error) {
+	for p.pos < len(p.lines) {
+		line := strings.TrimSpace(p.lines[p.pos])
+		p.pos++
+		n := p.pos
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "}") {
+			return stmts, line, nil
+		}
+
+		stmt := &scriptStmt{file: p.file, line: n}
+		word := strings.Fields(line)[0]
+		switch {
+		case word == "if":
+			stmt, err = p.parseIf(line, n, inLoop)
+			if err != nil {
+				return nil, "", err
+			}
+
+		case word == "while":
+			m := whilePattern.FindStringSubmatch(line)
+			if m == nil {
+				return nil, "", p.errorf(n, "expected 'while <condition> {'")
+			}
+			stmt.kind, stmt.text = stmtWhile, m[1]
+			if stmt.body, err = p.parseBody(n, true); err != nil {
+				return nil, "", err
+			}
+
+		case word == "func":
+			m := funcPattern.FindStringSubmatch(line)
+			if m == nil {
+				return nil, "", p.errorf(n, "expected 'func name(arg, ...) {'")
+			}
+			stmt.kind, stmt.name = stmtFunc, m[1]
+			if reservedFuncName(stmt.name) {
+				return nil, "", p.errorf(n, "'%s' is a command, a function can't take its name", stmt.name)
+			}
+			for _, param := range strings.Split(m[2], ",") {
+				if param = strings.TrimSpace(param); param == "" {
+					continue
+				}
+				if !paramPattern.MatchString(param) {
+					return nil, "", p.errorf(n, "invalid parameter name '%s'", param)
+				}
+				stmt.params = append(stmt.params, param)
+			}
+			if stmt.body, err = p.parseBody(n, false); err != nil {
+				return nil, "", err
+			}
+
+		case word == "return":
+			stmt.kind, stmt.text = stmtReturn, strings.TrimSpace(line[len("return"):])
+
+		case line == "break" || line == "continue":
+			if !inLoop {
+				return nil, "", p.errorf(n, "'%s' outside a while loop", line)
+			}
+			stmt.kind = stmtBreak
+			if line == "continue" {
+				stmt.kind = stmtContinue
+			}
+
+		case word == "include":
+			stmt.kind, stmt.text = stmtInclude, strings.TrimSpace(line[len("include"):])
+			if stmt.text == "" {
+				return nil, "", p.errorf(n, "expected 'include <file>'")
+			}
+
+		case line == "set -e" || line == "set +e":
+			stmt.kind, stmt.errexit = stmtErrexit, line == "set -e"
+
+		case word == "else":
+			return nil, "", p.errorf(n, "'else' must follow '}' on the same line: } else {")
+
+		default:
+			if _, err := parseCommandLine(line); err != nil {
+				return nil, "", &scriptError{file: p.file, line: n, src: line, err: err}
+			}
+			stmt.kind, stmt.text = stmtCommand, line
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, "", nil
+}
+
+// parseBody parses the body of a block opened on line n, which must end with }
+func (p *scriptParser) parseBody(n int, inLoop bool) ([]*scriptStmt, error) {
+	body, closer, err := p.parseBlock(inLoop)
+	if err != nil {
+		return nil, err
+	}
+	if closer == "" {
+		return nil, p.errorf(n, "'{' is never closed")
+	}
+	if closer != "}" {
+		return nil, p.errorf(p.pos, "unexpected '%s', else only follows an if block", closer)
+	}
+	return body, nil
+}
+
+// parseIf parses an if statement with its else if and else branches
+func (p *scriptParser) parseIf(line string, n int, inLoop bool) (*scriptStmt, error) {
+	m := ifPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, p.errorf(n, "expected 'if <condition> {'")
+	}
+	stmt := &scriptStmt{kind: stmtIf, file: p.file, line: n, text: m[1]}
+
+	body, closer, err := p.parseBlock(inLoop)
+	if err != nil {
+		return nil, err
+	}
+	if closer == "" {
+		return nil, p.errorf(n, "'{' is never closed")
+	}
+	stmt.body = body
+
+	switch {
+	case closer == "}":
+	case elsePattern.MatchString(closer):
+		if stmt.elseBody, err = p.parseBody(p.pos, inLoop); err != nil {
+			return nil, err
+		}
+	case elifPattern.MatchString(closer):
+		// } else if cond { ... is an if statement inside the else branch
+		elif, err := p.parseIf(strings.TrimSpace(strings.TrimPrefix(closer, "}"))[len("else "):], p.pos, inLoop)
+		if err != nil {
+			return nil, err
+		}
+		stmt.elseBody = []*scriptStmt{elif}
+	default:
+		return nil, p.errorf(p.pos, "expected '}', '} else {' or '} else if <condition> {'")
+	}
+	return stmt, nil
+}
+
+// flow tells the enclosing blocks how a statement ended
+type flow int
+
+const (
+	flowNext     flow = iota // carry on with the next statement
+	flowBreak                // leave the enclosing while loop
+	flowContinue             // start the next iteration of the enclosing while loop
+	flowReturn               // leave the function, or the script at the top level
+	flowExit                 // stop the whole script
+)
+
+// scriptRunner is the state of one script run, shared with the functions it defines
+type scriptRunner struct {
+	errexit   bool                   // set -e: stop at the first failing command
+	includes  []string               // absolute paths of the files being run, to catch include cycles
+	depth     int                    // function call depth
+	functions map[string]*scriptFunc // defined by the script and the files it includes
+}
+
+// reservedFuncName reports whether name is a REPL command or script keyword, which a
+// function must not shadow
+func reservedFuncName(name string) bool {
+	switch name {
+	case "echo", "print", "exit", "quit", "q", "if", "else", "while", "func", "return",
+		"break", "continue", "include":
+		return true
+	}
+	return isReplCommand(name)
+}
+
+// ScriptStart runs a .lmv script, like the -r resource file, and waits for its jobs
+func (cli *CLI) ScriptStart(banner__ bool, path string) error {
+	if err := cli.manager.DiscoverModules(); err != nil {
+		return err
+	}
+	if banner__ {
+		cli.PrintBanner()
+	}
+	cli.setupSignalHandler()
+	defer cli.closeWorkspace()
+	defer removeStdinSpool()
+
+	err := cli.RunScript(path)
+
+	// Like a shell script, the script's background jobs finish before it does
+	if len(cli.jobs.running()) > 0 {
+		cli.jobs.wait()
+	}
+	cli.jobs.AnnounceFinished()
+	return err
+}
+
+// RunScript runs a .lmv script file. Errors, including a failure under set -e,
+// are printed and returned.
+func (cli *CLI) RunScript(path string) error {
+	cli.enterScript()
+	defer cli.scriptDepth.Add(-1)
+
+	// Functions are only callable from the script defining them
+	r := &scriptRunner{functions: make(map[string]*scriptFunc)}
+	outer := cli.script
+	cli.script = r
+	defer func() { cli.script = outer }()
+
+	_, err := cli.runScriptFile(r, path)
+	if err != nil {
+		printScriptError(cli.out(), err)
+		if cli.lastExitCode == 0 {
+			cli.lastExitCode = 1
+		}
+	}
+	return err
+}
+
+// enterScript counts a script or function starting; the outermost one clears a previous Ctrl+C
+func (cli *CLI) enterScript() {
+	if cli.scriptDepth.Add(1) == 1 {
+		cli.scriptStop.Store(false)
+	}
+}
+
+// runScriptFile parses and runs one script file
+func (cli *CLI) runScriptFile(r *scriptRunner, path string) (flow, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return flowExit, err
+	}
+	for i, running := range r.includes {
+		if running == abs {
+			chain := append(append([]string{}, r.includes[i:]...), abs)
+			for j := range chain {
+				chain[j] = filepath.Base(chain[j])
+			}
+			return flowExit, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return flowExit, err
+	}
+	stmts, err := parseScript(path, string(src))
+	if err != nil {
+		return flowExit, err
+	}
+
+	r.includes = append(r.includes, abs)
+	defer func() { r.includes = r.includes[:len(r.includes)-1] }()
+
+	f, err := cli.runBlock(r, stmts)
+	if f == flowReturn {
+		f = flowNext // return at the top level ends this file only
+	}
+	return f, err
+}
+
+// runBlock runs statements until one of them changes the flow
+func (cli *CLI) runBlock(r *scriptRunner, stmts []*scriptStmt) (flow, error) {
+	for _, stmt := range stmts {
+		if cli.scriptStop.Load() {
+			return flowExit, &scriptError{file: stmt.file, line: stmt.line, err: fmt.Errorf("interrupted")}
+		}
+		if !cli.running {
+			return flowExit, nil
+		}
+
+		f, err := cli.runStmt(r, stmt)
+		if err != nil || f != flowNext {
+			return f, err
+		}
+	}
+	return flowNext, nil
+}
+
+// runStmt runs one statement. Variables, function arguments included, are expanded
+// by the commands themselves, after parsing, so their values can't add commands.
+func (cli *CLI) runStmt(r *scriptRunner, stmt *scriptStmt) (flow, error) {
+	fail := func(err error) (flow, error) {
+		return flowExit, &scriptError{file: stmt.file, line: stmt.line, err: err}
+	}
+
+	switch stmt.kind {
+	case stmtCommand:
+		cli.ExecuteCommand(stmt.text)
+		if r.errexit && cli.lastExitCode != 0 && cli.running {
+			return fail(fmt.Errorf("'%s' failed with exit code %d (set -e)", stmt.text, cli.lastExitCode))
+		}
+
+	case stmtIf:
+		ok, err := cli.evalCondition(stmt.text)
+		if err != nil {
+			return fail(err)
+		}
+		if ok {
+			return cli.runBlock(r, stmt.body)
+		}
+		return cli.runBlock(r, stmt.elseBody)
+
+	case stmtWhile:
+		for {
+			if cli.scriptStop.Load() {
+				return fail(fmt.Errorf("interrupted"))
+			}
+			ok, err := cli.evalCondition(stmt.text)
+			if err != nil {
+				return fail(err)
+			}
+			if !ok {
+				break
+			}
+			f, err := cli.runBlock(r, stmt.body)
+			if err != nil || f == flowReturn || f == flowExit {
+				return f, err
+			}
+			if f == flowBreak {
+				break
+			}
+		}
+
+	case stmtFunc:
+		if cli.moduleExists(stmt.name) {
+			return fail(fmt.Errorf("'%s' is a module, a function can't take its name", stmt.name))
+		}
+		r.functions[stmt.name] = &scriptFunc{name: stmt.name, params: stmt.params, body: stmt.body, runner: r}
+
+	case stmtReturn:
+		if stmt.text != "" {
+			code, err := strconv.Atoi(cli.expandCondition(stmt.text))
+			if err != nil {
+				return fail(fmt.Errorf("return needs a numeric exit code, got '%s'", stmt.text))
+			}
+			cli.lastExitCode = code
+		}
+		return flowReturn, nil
+
+	case stmtBreak:
+		return flowBreak, nil
+
+	case stmtContinue:
+		return flowContinue, nil
+
+	case stmtInclude:
+		path := cli.expandCondition(stmt.text)
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(stmt.file), path)
+		}
+		f, err := cli.runScriptFile(r, path)
+		if err != nil {
+			if _, isScriptErr := err.(*scriptError); !isScriptErr {
+				return fail(err)
+			}
+		}
+		return f, err
+
+	case stmtErrexit:
+		r.errexit = stmt.errexit
+	}
+	return flowNext, nil
+}
+
+// scriptFunction returns the function of the running script named name
+func (cli *CLI) scriptFunction(name string) (*scriptFunc, bool) {
+	if cli.script == nil {
+		return nil, false
+	}
+	fn, ok := cli.script.functions[name]
+	return fn, ok
+}
+
+// callFunction runs a script function with args bound to its parameters as variables.
+// Its exit code is the one given to return, or that of its last command.
+func (cli *CLI) callFunction(fn *scriptFunc, args []string) {
+	if len(args) > len(fn.params) {
+		cli.printError(fmt.Sprintf("%s takes %d argument(s) (%s), got %d", fn.name, len(fn.params), strings.Join(fn.params, ", "), len(args)))
+		cli.lastExitCode = 2
+		return
+	}
+	r := fn.runner
+	if r.depth >= maxCallDepth {
+		cli.printError(fmt.Sprintf("%s: maximum call depth of %d exceeded", fn.name, maxCallDepth))
+		cli.lastExitCode = 1
+		return
+	}
+
+	// Arguments are variables of the call, missing ones are empty
+	vars := make(map[string]string, len(fn.params))
+	for i, param := range fn.params {
+		vars[param] = ""
+		if i < len(args) {
+			vars[param] = args[i]
+		}
+	}
+
+	r.depth++
+	cli.enterScript()
+	cli.envMgr.PushLocals(vars)
+	defer func() {
+		cli.envMgr.PopLocals()
+		r.depth--
+		cli.scriptDepth.Add(-1)
+	}()
+
+	cli.lastExitCode = 0
+	if _, err := cli.runBlock(r, fn.body); err != nil {
+		printScriptError(cli.out(), err)
+		if cli.lastExitCode == 0 {
+			cli.lastExitCode = 1
+		}
+	}
+}
+
+// evalCondition evaluates an if or while condition: a single value, true unless empty,
+// 0, false or no; or a comparison with ==, !=, <, <=, >, >= (numeric when both sides
+// are numbers) or =~ (regular expression). ! negates. $? is the last exit code.
+func (cli *CLI) evalCondition(cond string) (bool, error) {
+	var words []string
+	for i := 0; i < len(cond); {
+		if isSpace(cond[i]) {
+			i++
+			continue
+		}
+		tok, err := lexWord(cond, i)
+		if err != nil {
+			return false, err
+		}
+		words = append(words, tok.text)
+		i = tok.end
+	}
+
+	negate := len(words) > 0 && words[0] == "!"
+	if negate {
+		words = words[1:]
+	}
+	for i := range words {
+		words[i] = cli.expandCondition(words[i])
+	}
+
+	var result bool
+	switch len(words) {
+	case 1:
+		v := strings.ToLower(words[0])
+		result = v != "" && v != "0" && v != "false" && v != "no"
+	case 3:
+		var err error
+		if result, err = compareValues(words[0], words[1], words[2]); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("invalid condition '%s', expected <value> or <value> <op> <value>", cond)
+	}
+	return result != negate, nil
+}
+
+// expandCondition expands a condition operand. Unlike in arguments, unset variables
+// expand to nothing, so if $target == "" tests for an unset target.
+func (cli *CLI) expandCondition(s string) string {
+	s = strings.ReplaceAll(s, "$?", strconv.Itoa(cli.lastExitCode))
+	s = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`).ReplaceAllStringFunc(s, func(match string) string {
+		name := strings.Trim(match, "${}")
+		if val, ok := cli.envMgr.Get(name); ok {
+			return val
+		}
+		if val, ok := os.LookupEnv(name); ok {
+			return val
+		}
+		return ""
+	})
+	expanded, err := cli.expandBuiltins(s)
+	if err != nil {
+		cli.printWarning(fmt.Sprintf("Could not expand '%s': %v", s, err))
+		return s
+	}
+	return expanded
+}
+
+// compareValues compares two condition operands
+func compareValues(a, op, b string) (bool, error) {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	numeric := errA == nil && errB == nil
+
+	cmp := strings.Compare(a, b)
+	if numeric {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "=~":
+		re, err := regexp.Compile(b)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern '%s': %v", b, err)
+		}
+		return re.MatchString(a), nil
+	}
+	return false, fmt.Errorf("unknown operator '%s', use ==, !=, <, <=, >, >= or =~", op)
+}
+
+// printScriptError prints a script error, with a caret for syntax errors
+func printScriptError(w io.Writer, err error) {
+	serr, ok := err.(*scriptError)
+	if !ok {
+		core.FprintError(w, err.Error())
+		return
+	}
+	if perr, isParseErr := serr.err.(*parseError); isParseErr && serr.src != "" {
+		core.FprintError(w, fmt.Sprintf("%s:%d: syntax error: %s", serr.file, serr.line, perr.msg))
+		printCaret(w, serr.src, perr.pos)
+		return
+	}
+	core.FprintError(w, serr.Error())
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runTestScript writes src to a script in the session directory and runs it
+func runTestScript(t *testing.T, cli *CLI, src string) error {
+	t.Helper()
+	path := filepath.Join(cli.currentDirectory, "test.lmv")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cli.RunScript(path)
+}
+
+func TestScriptFunctionArguments(t *testing.T) {
+	cli := newTestCLI(t, nil)
+
+	// Arguments are variables, a ; or |> in one doesn't add a command
+	err := runTestScript(t, cli, `
+func keep(v, missing) {
+    out=$v
+    if $missing == "" {
+        empty=yes
+    }
+    $ bash [ "$v" = "x; injected=1 |> upper()" ]
+}
+keep "x; injected=1 |> upper()"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cli.envMgr.Get("out"); got != "x; injected=1 |> upper()" {
+		t.Errorf("out = %q, want the whole argument", got)
+	}
+	if _, ok := cli.envMgr.Get("injected"); ok {
+		t.Error("an argument holding ; ran a second command")
+	}
+	if got, _ := cli.envMgr.Get("empty"); got != "yes" {
+		t.Errorf("missing argument was not empty, empty = %q", got)
+	}
+	if cli.lastExitCode != 0 {
+		t.Errorf("shell command saw $v as %d, want the argument in its environment", cli.lastExitCode)
+	}
+
+	// Arguments only live during the call and are never saved
+	if _, ok := cli.envMgr.Get("v"); ok {
+		t.Error("argument v is still set after the call")
+	}
+	saved, _ := os.ReadFile(cli.envMgr.filePath)
+	if strings.Contains(string(saved), `"v"`) {
+		t.Errorf("argument v was saved: %s", saved)
+	}
+}
+
+func TestScriptFunctionNames(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{"scan": {script: "echo scanned\n"}})
+
+	for _, name := range []string{"run", "set", "echo", "use", "while"} {
+		if _, err := parseScript("test.lmv", "func "+name+"() {\n}\n"); err == nil {
+			t.Errorf("function named %s was accepted", name)
+		}
+	}
+	if err := runTestScript(t, cli, "func scan() {\n}\n"); err == nil || !strings.Contains(err.Error(), "is a module") {
+		t.Errorf("function named like a module: error = %v", err)
+	}
+}
+
+func TestScriptFunctionScope(t *testing.T) {
+	cli := newTestCLI(t, nil)
+
+	if err := runTestScript(t, cli, "func f() {\n    called=yes\n}\nf\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cli.envMgr.Get("called"); got != "yes" {
+		t.Fatalf("function was not called in its script, called = %q", got)
+	}
+	if _, ok := cli.scriptFunction("f"); ok {
+		t.Error("function outlived the script defining it")
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"os/exec"
 	"strings"
 	"time"
-
-	"lanmanvan/core"
 )
 
 // ExecuteShellCommand executes a shell command
@@ -16,39 +14,24 @@ func (cli *CLI) ExecuteShellCommand(input string) {
 	input = strings.TrimSpace(input)
 
 	if input == "" {
-		core.PrintWarning("Empty command")
+		cli.printWarning("Empty command")
 		return
 	}
 
-	var shell string
-	var cmd *exec.Cmd
-
-	// Determine which shell to use
-	if strings.HasPrefix(input, "bash ") {
-		shell = "bash"
-		input = strings.TrimPrefix(input, "bash ")
-		cmd = exec.Command("bash", "-c", input)
-	} else if strings.HasPrefix(input, "zsh ") {
-		shell = "zsh"
-		input = strings.TrimPrefix(input, "zsh ")
-		cmd = exec.Command("zsh", "-c", input)
-	} else {
-		// Default to zsh
-		shell = "zsh"
-		cmd = exec.Command("zsh", "-c", input)
-	}
+	cmd, shell, input := cli.shellCommand(input)
 
 	startTime := time.Now()
-	fmt.Println()
-	//core.PrintInfo(fmt.Sprintf("Executing in %s", core.Color("cyan", shell)))
+	fmt.Fprintln(cli.out())
+	//cli.printInfo(fmt.Sprintf("Executing in %s", core.Color("cyan", shell)))
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = cli.out()
+	cmd.Stderr = cli.errOut()
 	cmd.Stdin = os.Stdin
 	cmd.Dir = cli.currentDirectory // Set working directory
 
 	err := cmd.Run()
 	duration := time.Since(startTime)
+	cli.lastExitCode = exitStatus(err)
 
 	// Update current directory if cd command
 	if strings.HasPrefix(strings.TrimSpace(input), "cd ") {
@@ -70,11 +53,40 @@ func (cli *CLI) ExecuteShellCommand(input string) {
 		}
 	}
 
-	//fmt.Println()
+	//fmt.Fprintln(cli.out())
 	if err == nil {
-		//core.PrintSuccess(fmt.Sprintf("Command completed in %s", duration.String()))
+		//cli.printSuccess(fmt.Sprintf("Command completed in %s", duration.String()))
 	} else {
-		core.PrintError(fmt.Sprintf("Command failed: %v (%s)", err, duration.String()))
+		cli.printError(fmt.Sprintf("Command failed: %v (%s)", err, duration.String()))
+	}
+	fmt.Fprintln(cli.out())
+}
+
+// shellCommand builds the command for a shell line, a leading "bash " or "zsh " picks
+// the shell (zsh by default). It also returns the shell name and the line it runs.
+// Inside a script function, the function's arguments are in the shell's environment.
+func (cli *CLI) shellCommand(input string) (*exec.Cmd, string, string) {
+	shell := "zsh"
+	if strings.HasPrefix(input, "bash ") {
+		shell = "bash"
+		input = strings.TrimPrefix(input, "bash ")
+	} else if strings.HasPrefix(input, "zsh ") {
+		input = strings.TrimPrefix(input, "zsh ")
+	}
+	cmd := exec.Command(shell, "-c", input)
+	if env := cli.envMgr.LocalEnv(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd, shell, input
+}
+
+// exitStatus returns the exit code of a finished command, 127 if it couldn't start
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
 	}
-	fmt.Println()
+	return 127
 }
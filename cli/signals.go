@@ -1,53 +1,200 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
+
+	"lanmanvan/core"
 )
 
-// ModuleExecutor tracks the currently running module process
+// ModuleExecutor tracks the currently running module processes
 type ModuleExecutor struct {
-	running bool
-	pid     int
+	mu         sync.Mutex
+	running    bool
+	pids       map[int]bool // process group leaders started by core
+	interrupts int          // Ctrl+C presses since the execution started
+	cancel     context.CancelFunc
 }
 
 // moduleExecutor is a global instance tracking module execution
-var moduleExecutor = &ModuleExecutor{running: false, pid: 0}
+var moduleExecutor = &ModuleExecutor{running: false, pids: make(map[int]bool)}
+
+// interruptSignals is the Ctrl+C escalation ladder: first INT, then TERM, then KILL
+var interruptSignals = []syscall.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL}
 
-// startModuleExecution marks the start of module execution
-func (cli *CLI) startModuleExecution() {
+// startModuleExecution marks the start of module execution and returns the
+// context the module must run under. A timeout of 0 means no deadline.
+func (cli *CLI) startModuleExecution(timeout time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+
+	moduleExecutor.mu.Lock()
 	moduleExecutor.running = true
+	moduleExecutor.interrupts = 0
+	moduleExecutor.pids = make(map[int]bool)
+	moduleExecutor.cancel = cancel
+	moduleExecutor.mu.Unlock()
+
+	return ctx
 }
 
 // stopModuleExecution marks the end of module execution
 func (cli *CLI) stopModuleExecution() {
+	moduleExecutor.mu.Lock()
+	defer moduleExecutor.mu.Unlock()
+
+	if moduleExecutor.cancel != nil {
+		moduleExecutor.cancel()
+	}
 	moduleExecutor.running = false
-	moduleExecutor.pid = 0
+	moduleExecutor.pids = make(map[int]bool)
+	moduleExecutor.cancel = nil
+}
+
+// execOptions returns core options that register every started child with the executor
+func (me *ModuleExecutor) execOptions(quiet bool) core.ExecOptions {
+	return core.ExecOptions{
+		Quiet:   quiet,
+		Started: me.track,
+		Exited:  me.untrack,
+	}
+}
+
+// track records the PID of a child started by core
+func (me *ModuleExecutor) track(pid int) {
+	me.mu.Lock()
+	me.pids[pid] = true
+	interrupts := me.interrupts
+	me.mu.Unlock()
+
+	// A child started after Ctrl+C (e.g. a late thread) gets the same treatment
+	if interrupts > 0 {
+		syscall.Kill(-pid, interruptSignal(interrupts))
+	}
+}
+
+// untrack forgets a reaped child
+func (me *ModuleExecutor) untrack(pid int) {
+	me.mu.Lock()
+	delete(me.pids, pid)
+	me.mu.Unlock()
 }
 
+// interrupted reports whether Ctrl+C was pressed during the current execution
+func (me *ModuleExecutor) interrupted() bool {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.interrupts > 0
+}
+
+// interrupt escalates one step and signals every tracked process group. Without any,
+// the module runs in-process (native) and its context is cancelled instead.
+func (me *ModuleExecutor) interrupt() (syscall.Signal, int) {
+	me.mu.Lock()
+	me.interrupts++
+	sig := interruptSignal(me.interrupts)
+	pids := make([]int, 0, len(me.pids))
+	for pid := range me.pids {
+		pids = append(pids, pid)
+	}
+	cancel := me.cancel
+	me.mu.Unlock()
+
+	if len(pids) == 0 && cancel != nil {
+		cancel()
+	}
+
+	for _, pid := range pids {
+		syscall.Kill(-pid, sig)
+	}
+	return sig, len(pids)
+}
+
+// interruptSignal maps the number of Ctrl+C presses to the signal to send
+func interruptSignal(presses int) syscall.Signal {
+	if presses > len(interruptSignals) {
+		presses = len(interruptSignals)
+	}
+	return interruptSignals[presses-1]
+}
+
+// signalHandlerOnce guards against installing the handler once per IdleStart call
+var signalHandlerOnce sync.Once
+
 // setupSignalHandler sets up Ctrl+C handling
 func (cli *CLI) setupSignalHandler() {
+	signalHandlerOnce.Do(cli.installSignalHandler)
+}
+
+// installSignalHandler starts the goroutine that reacts to Ctrl+C
+func (cli *CLI) installSignalHandler() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT)
 
 	go func() {
 		for range sigChan {
-			if moduleExecutor.running {
-				// Module is running - just mark it as interrupted
-				// The module process will handle its own cleanup
-				fmt.Println()
-				fmt.Println()
-				// Return to prompt without exiting the CLI
-				continue
-			} else {
-				// CLI is idle - ask user if they want to exit
-				fmt.Println()
-				fmt.Println()
-				// Just continue, readline will handle the interrupt
-				continue
-			}
+			cli.handleInterrupt()
 		}
 	}()
 }
+
+// handleInterrupt reacts to one Ctrl+C
+func (cli *CLI) handleInterrupt() {
+	// Attached to a background job with 'fg' - detach, the job keeps running
+	if cli.jobs.DetachForeground() {
+		return
+	}
+
+	moduleExecutor.mu.Lock()
+	running := moduleExecutor.running
+	moduleExecutor.mu.Unlock()
+
+	// A running script stops after the current command
+	if cli.scriptDepth.Load() > 0 && !cli.scriptStop.Swap(true) {
+		fmt.Println()
+		core.PrintWarning("Stopping the script after the current command")
+	}
+	// So does a sequential loop, whose items each start their own execution
+	if cli.loopDepth.Load() > 0 && !cli.loopStop.Swap(true) {
+		fmt.Println()
+		core.PrintWarning("Stopping the loop after the current item")
+	}
+
+	if running {
+		// Module is running - escalate INT -> TERM -> KILL on its process groups
+		sig, count := moduleExecutor.interrupt()
+		fmt.Println()
+		if count == 0 {
+			core.PrintWarning("Cancelling module...")
+		} else if sig == syscall.SIGKILL {
+			core.PrintWarning(fmt.Sprintf("Killing module (%d process group(s))...", count))
+		} else {
+			core.PrintWarning(fmt.Sprintf("Sent %s to module (%d process group(s)), press Ctrl+C again to escalate", signalName(sig), count))
+		}
+	} else {
+		// CLI is idle - readline will handle the interrupt
+		fmt.Println()
+		fmt.Println()
+	}
+}
+
+// signalName returns the short conventional name of a signal
+func signalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGINT:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	case syscall.SIGKILL:
+		return "SIGKILL"
+	default:
+		return sig.String()
+	}
+}
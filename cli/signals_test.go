@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// waitTracked waits until the executor tracks a running module process
+func waitTracked(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		moduleExecutor.mu.Lock()
+		n := len(moduleExecutor.pids)
+		moduleExecutor.mu.Unlock()
+		if n > 0 {
+			time.Sleep(100 * time.Millisecond) // let the module install its traps
+			return
+		}
+	}
+	t.Fatal("module never started")
+}
+
+func TestInterruptEscalatesPastTrappedSIGINT(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{
+		"stubborn": {script: "trap '' INT\nwhile :; do sleep 0.1; done\n"},
+	})
+
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	done := make(chan *core.ExecutionResult, 1)
+	go func() {
+		result, err := cli.manager.ExecuteModuleWithOptions(ctx, "stubborn", nil, moduleExecutor.execOptions(true))
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+	waitTracked(t)
+
+	if sig, count := moduleExecutor.interrupt(); sig != syscall.SIGINT || count != 1 {
+		t.Fatalf("first Ctrl+C sent %v to %d group(s), want SIGINT to 1", sig, count)
+	}
+	select {
+	case <-done:
+		t.Fatal("module trapping SIGINT exited on SIGINT")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	if sig, _ := moduleExecutor.interrupt(); sig != syscall.SIGTERM {
+		t.Fatalf("second Ctrl+C sent %v, want SIGTERM", sig)
+	}
+	select {
+	case result := <-done:
+		if result == nil || result.Success || result.ExitCode != 128+int(syscall.SIGTERM) {
+			t.Errorf("result = %+v, want exit %d", result, 128+int(syscall.SIGTERM))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("module survived SIGTERM")
+	}
+}
+
+func TestInterruptStopsSequentialLoop(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{
+		"item": {yaml: "options:\n  n:\n    type: string\n", script: "echo \"$ARG_N\" >> \"$HOME/ran.txt\"\nsleep 5\n"},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cli.ExecuteCommand("for x in 1..4 -> item n=$x")
+	}()
+	waitTracked(t)
+	cli.handleInterrupt()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("loop did not stop")
+	}
+	data, _ := os.ReadFile(filepath.Join(os.Getenv("HOME"), "ran.txt"))
+	if string(data) != "1\n" {
+		t.Errorf("items run = %q, want only the first", data)
+	}
+	if cli.lastExitCode == 0 {
+		t.Error("an interrupted loop exited 0")
+	}
+
+	// The interrupted item is left for resume
+	checkpoints, err := core.ListCheckpoints()
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("checkpoints = %v (%v), want the loop's", checkpoints, err)
+	}
+	if items := checkpoints[0].Items; len(items) != 0 {
+		t.Errorf("checkpoint recorded %v, want the interrupted item left to run", items)
+	}
+}
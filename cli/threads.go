@@ -0,0 +1,481 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// shardOptions controls how a sharded run reports per-item results
+type shardOptions struct {
+	exec    core.ExecOptions      // options for every item's execution, should be Quiet
+	out     io.Writer             // where per-item results and the summary are written
+	bar     bool                  // redraw a live progress bar on out
+	ordered bool                  // print items in input order instead of as they finish
+	stopped func() bool           // reports an interrupt, no new items are started once true
+	onItem  func(done, total int) // called after every finished item
+
+	checkpoint *core.Checkpoint // records finished items, may be nil
+	skip       map[int]bool     // items a resumed run already finished
+}
+
+// shardItem is one value of the sharded option
+type shardItem struct {
+	index int
+	value string
+}
+
+// shardOutcome is the result of running the module for one item
+type shardOutcome struct {
+	item   shardItem
+	result *core.ExecutionResult
+	err    error
+}
+
+// succeeded reports whether the item ran successfully
+func (o shardOutcome) succeeded() bool {
+	return o.err == nil && o.result != nil && o.result.Success
+}
+
+// exitCode returns the item's exit code, 1 for failures that didn't set one
+func (o shardOutcome) exitCode() int {
+	switch {
+	case o.err != nil || o.result == nil:
+		return 1
+	case !o.result.Success && o.result.ExitCode == 0:
+		return 1
+	}
+	return o.result.ExitCode
+}
+
+// shardSource returns an iterator when value is list-valued: @file (one item per
+// line, streamed, relative to dir) or a range such as 192.168.1.1..254 or 10.0.0.0/24.
+// ok is false for plain values.
+func shardSource(value, dir string) (iter Iterator, ok bool, err error) {
+	if strings.HasPrefix(value, "@") && len(value) > 1 {
+		path := value[1:]
+		if path != "-" && !strings.HasPrefix(path, "~/") && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		it, err := newLineFileIterator(path, false)
+		if err != nil {
+			return nil, true, err
+		}
+		return it, true, nil
+	}
+	// Anything that doesn't parse as a range (e.g. ../path or a URL) is a plain value
+	if isRangeExpr(value) {
+		if it, err := parseRangeSource(value); err == nil {
+			return it, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// prepareShard finds the list-valued option threads= should distribute: the one named
+// by shard=, or else the only list-valued option the module declares. Global variables
+// the module doesn't declare are never split. The first item is put in the args so the
+// run validates like a normal one.
+func (cli *CLI) prepareShard(run *moduleRun) error {
+	if run.shardOption != "" {
+		value, given := run.args[run.shardOption]
+		iter, ok, err := shardSource(value, cli.currentDirectory)
+		switch {
+		case !given:
+			return fmt.Errorf("shard=%s: the module got no %s= argument", run.shardOption, run.shardOption)
+		case !ok:
+			return fmt.Errorf("shard=%s: %s=%s is not list-valued, use e.g. %s=@targets.txt or %s=10.0.0.1..254",
+				run.shardOption, run.shardOption, value, run.shardOption, run.shardOption)
+		case err != nil:
+			return fmt.Errorf("%s: %v", run.shardOption, err)
+		}
+		run.shardSource, run.shardIter = value, iter
+	} else {
+		var names []string
+		if run.module.Metadata != nil {
+			for name := range run.module.Metadata.Options {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value, given := run.args[name]
+			if !given {
+				continue
+			}
+			iter, ok, err := shardSource(value, cli.currentDirectory)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if run.shardOption != "" {
+				iter.Close()
+				run.shardIter.Close()
+				return fmt.Errorf("options '%s' and '%s' are both list-valued, pick the one to split with shard=<option>", run.shardOption, name)
+			}
+			run.shardOption, run.shardSource, run.shardIter = name, value, iter
+		}
+	}
+
+	if run.shardOption == "" {
+		cli.printWarning("threads= needs a list-valued option to split, e.g. host=@targets.txt or host=10.0.0.1..254 (shard=<option> for undeclared ones) - running once")
+		run.threads = 1
+		return nil
+	}
+
+	run.shardTotal = run.shardIter.Len()
+	first, ok := run.shardIter.Next()
+	if !ok {
+		run.shardIter.Close()
+		return fmt.Errorf("%s=%s has no items", run.shardOption, run.shardSource)
+	}
+	run.shardFirst = first
+	run.args[run.shardOption] = first
+	return nil
+}
+
+// runModuleThreaded runs the module once per item of the sharded option on a pool of run.threads workers
+func (cli *CLI) runModuleThreaded(ctx context.Context, run *moduleRun, so shardOptions) (*core.ExecutionResult, error) {
+	defer run.shardIter.Close()
+
+	started := time.Now()
+	items := make(chan shardItem)
+	outcomes := make(chan shardOutcome)
+
+	total := run.shardTotal
+	for index := range so.skip {
+		if index >= 0 && index < run.shardTotal {
+			total--
+		}
+	}
+
+	// Feed items until the source is exhausted or the run is stopped
+	go func() {
+		defer close(items)
+		item := shardItem{index: 0, value: run.shardFirst}
+		for {
+			if ctx.Err() != nil || (so.stopped != nil && so.stopped()) {
+				return
+			}
+			if !so.skip[item.index] {
+				select {
+				case items <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+			value, ok := run.shardIter.Next()
+			if !ok {
+				return
+			}
+			item = shardItem{index: item.index + 1, value: value}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < run.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				if ctx.Err() != nil || (so.stopped != nil && so.stopped()) {
+					continue // drain, the item is counted as skipped
+				}
+				outcomes <- cli.runShardItem(ctx, run, item, so.exec)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	limit := so.exec.OutputLimit
+	if limit <= 0 {
+		limit = cli.manager.OutputLimit
+	}
+	agg := newShardAggregate(limit)
+	rep := &shardReporter{out: so.out, bar: so.bar, ordered: so.ordered, option: run.shardOption, total: total,
+		skip: so.skip, pending: make(map[int]shardOutcome), printed: agg.add}
+	rep.drawBar()
+
+	secret := run.isSecret(run.shardOption)
+	for outcome := range outcomes {
+		if so.checkpoint != nil && (outcome.succeeded() || !stoppedEarly(ctx, so)) {
+			value := outcome.item.value
+			if secret {
+				value = secretMask
+			}
+			so.checkpoint.Record(outcome.item.index, value, outcome.exitCode()) // a failure caused by the stop must run again
+		}
+		rep.report(outcome)
+		if so.onItem != nil {
+			so.onItem(rep.done, total)
+		}
+	}
+	rep.flush()
+	rep.clearBar()
+
+	final := agg.result()
+	final.Timestamp = started
+	rep.summary(agg, total)
+	closeCheckpoint(so.checkpoint, so.out)
+	return final, nil
+}
+
+// stoppedEarly reports whether a sharded run was interrupted, killed or timed out
+func stoppedEarly(ctx context.Context, so shardOptions) bool {
+	return ctx.Err() != nil || (so.stopped != nil && so.stopped())
+}
+
+// runShardItem runs the module for a single item. The run passed its preflight, only
+// the item's value is left to check.
+func (cli *CLI) runShardItem(ctx context.Context, run *moduleRun, item shardItem, opts core.ExecOptions) shardOutcome {
+	value, err := core.ValidateOption(run.module.Metadata, run.shardOption, item.value, cli.currentDirectory)
+	if err != nil {
+		return shardOutcome{item: item, err: err}
+	}
+	args := make(map[string]string, len(run.args))
+	for k, v := range run.args {
+		args[k] = v
+	}
+	args[run.shardOption] = value
+
+	return shardOutcome{item: item, result: cli.manager.ExecutePrepared(ctx, run.module, args, opts)}
+}
+
+// maxFailedShown is how many failed values the summary lists
+const maxFailedShown = 20
+
+// shardAggregate merges per-item results into the run's result as items are printed,
+// so each item's output can be dropped right after: a run over a million values keeps
+// only the capped output lines and the structured results
+type shardAggregate struct {
+	final    *core.ExecutionResult
+	output   *cappedLines
+	errors   *cappedLines
+	finished int
+	failed   []string // the first maxFailedShown failed values
+	failures int
+}
+
+// newShardAggregate creates an aggregate keeping at most limit bytes of output and of errors
+func newShardAggregate(limit int) *shardAggregate {
+	return &shardAggregate{
+		final:  &core.ExecutionResult{Success: true, Timestamp: time.Now()},
+		output: &cappedLines{limit: limit},
+		errors: &cappedLines{limit: limit},
+	}
+}
+
+// add merges one item, its lines prefixed with the item's value
+func (a *shardAggregate) add(o shardOutcome) {
+	final := a.final
+	a.finished++
+	if !o.succeeded() {
+		final.Success = false
+		a.failures++
+		if len(a.failed) < maxFailedShown {
+			a.failed = append(a.failed, o.item.value)
+		}
+	}
+	if o.err != nil {
+		a.errors.add(fmt.Sprintf("[%s] %v", o.item.value, o.err))
+		if final.ExitCode == 0 {
+			final.ExitCode = 1
+		}
+		return
+	}
+
+	r := o.result
+	if !r.Success && final.ExitCode == 0 {
+		final.ExitCode = r.ExitCode
+	}
+	for _, line := range splitLines(r.Output) {
+		a.output.add(fmt.Sprintf("[%s] %s", o.item.value, line))
+	}
+	for _, line := range splitLines(r.Error) {
+		a.errors.add(fmt.Sprintf("[%s] %s", o.item.value, line))
+	}
+	final.Findings = append(final.Findings, r.Findings...)
+	final.Artifacts = append(final.Artifacts, r.Artifacts...)
+	for k, v := range r.Outputs {
+		if final.Outputs == nil {
+			final.Outputs = make(map[string]string)
+		}
+		final.Outputs[o.item.value+"."+k] = v
+	}
+	final.OutputTruncated = final.OutputTruncated || r.OutputTruncated
+	if r.Cancelled {
+		final.Cancelled = true
+		final.TimedOut = final.TimedOut || r.TimedOut
+	}
+}
+
+// result returns the merged result
+func (a *shardAggregate) result() *core.ExecutionResult {
+	a.final.Output = a.output.String()
+	a.final.Error = a.errors.String()
+	a.final.OutputTruncated = a.final.OutputTruncated || a.output.truncated || a.errors.truncated
+	return a.final
+}
+
+// cappedLines joins lines until they reach limit bytes, and drops the rest
+type cappedLines struct {
+	buf       strings.Builder
+	limit     int
+	truncated bool
+}
+
+// add appends a line unless the limit is reached
+func (c *cappedLines) add(line string) {
+	if c.truncated || c.buf.Len()+len(line)+1 > c.limit {
+		c.truncated = true
+		return
+	}
+	if c.buf.Len() > 0 {
+		c.buf.WriteByte('\n')
+	}
+	c.buf.WriteString(line)
+}
+
+// String returns the lines kept
+func (c *cappedLines) String() string {
+	return c.buf.String()
+}
+
+// splitLines returns the non-empty lines of s
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// shardReporter prints per-item results and the live progress bar
+type shardReporter struct {
+	out     io.Writer
+	bar     bool
+	ordered bool
+	option  string
+	total   int
+	done    int
+	next    int                  // next index to print in ordered mode
+	skip    map[int]bool         // indexes a resumed run doesn't run again, next passes them
+	pending map[int]shardOutcome // finished out of order, waiting for earlier items
+	printed func(shardOutcome)   // called with every item once it is printed
+}
+
+// report records a finished item and prints it, or holds it back in ordered mode
+func (r *shardReporter) report(o shardOutcome) {
+	r.done++
+	if !r.ordered {
+		r.print(o)
+		r.drawBar()
+		return
+	}
+	r.pending[o.item.index] = o
+	for {
+		for r.skip[r.next] {
+			r.next++
+		}
+		next, ok := r.pending[r.next]
+		if !ok {
+			break
+		}
+		delete(r.pending, r.next)
+		r.next++
+		r.print(next)
+	}
+	r.drawBar()
+}
+
+// flush prints whatever ordered mode still holds (items after a gap left by an interrupt)
+func (r *shardReporter) flush() {
+	indexes := make([]int, 0, len(r.pending))
+	for index := range r.pending {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		r.print(r.pending[index])
+	}
+	r.pending = make(map[int]shardOutcome)
+}
+
+// print writes one item's block
+func (r *shardReporter) print(o shardOutcome) {
+	r.clearBar()
+	if r.printed != nil {
+		defer r.printed(o)
+	}
+
+	label := fmt.Sprintf("%s=%s", r.option, o.item.value)
+	switch {
+	case o.err != nil:
+		fmt.Fprintln(r.out, core.NmapBox(fmt.Sprintf("%s %s", core.Color("red", "[-]"), label)))
+		fmt.Fprintln(r.out, core.NmapSubBox(core.Color("red", o.err.Error())))
+	case o.result.Success:
+		fmt.Fprintln(r.out, core.NmapBox(fmt.Sprintf("%s %s [exit: %d]", core.Color("green", "[+]"), label, o.result.ExitCode)))
+	default:
+		fmt.Fprintln(r.out, core.NmapBox(fmt.Sprintf("%s %s [exit: %d]", core.Color("red", "[-]"), label, o.result.ExitCode)))
+	}
+	if o.result != nil {
+		for _, line := range splitLines(o.result.Output) {
+			fmt.Fprintln(r.out, core.NmapSubBox(line))
+		}
+		if !o.result.Success {
+			for _, line := range splitLines(o.result.Error) {
+				fmt.Fprintln(r.out, core.NmapSubBox(core.Color("red", line)))
+			}
+		}
+	}
+}
+
+// drawBar redraws the progress bar on the current line
+func (r *shardReporter) drawBar() {
+	if r.bar {
+		fmt.Fprintf(r.out, "\r\033[K%s %d/%d", core.ProgressBar(r.done, r.total, 30), r.done, r.total)
+	}
+}
+
+// clearBar erases the progress bar line
+func (r *shardReporter) clearBar() {
+	if r.bar {
+		fmt.Fprint(r.out, "\r\033[K")
+	}
+}
+
+// summary prints the aggregated success/failure counts
+func (r *shardReporter) summary(agg *shardAggregate, total int) {
+	succeeded := agg.finished - agg.failures
+
+	fmt.Fprintln(r.out)
+	fmt.Fprintln(r.out, core.NmapBox("Summary"))
+	fmt.Fprintln(r.out, core.NmapSubBox(fmt.Sprintf("Items:     %d", total)))
+	fmt.Fprintln(r.out, core.NmapSubBox(fmt.Sprintf("Succeeded: %s", core.Color("green", fmt.Sprint(succeeded)))))
+	if agg.failures > 0 {
+		shown := agg.failed
+		if agg.failures > len(shown) {
+			shown = append(shown[:len(shown):len(shown)], fmt.Sprintf("... %d more", agg.failures-len(shown)))
+		}
+		fmt.Fprintln(r.out, core.NmapSubBox(fmt.Sprintf("Failed:    %s (%s)", core.Color("red", fmt.Sprint(agg.failures)), strings.Join(shown, ", "))))
+	}
+	if skipped := total - agg.finished; skipped > 0 {
+		fmt.Fprintln(r.out, core.NmapSubBox(fmt.Sprintf("Skipped:   %s", core.Color("yellow", fmt.Sprint(skipped)))))
+	}
+	fmt.Fprintln(r.out)
+}
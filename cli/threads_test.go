@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lanmanvan/core"
+)
+
+// shardModules are the modules of the threads= tests: echo declares host, raw declares nothing
+var shardModules = map[string]testModule{
+	"echo": {
+		yaml:   "options:\n  host:\n    type: string\n  port:\n    type: string\n",
+		script: "[ \"$ARG_HOST\" = 7 ] && { echo \"no $ARG_HOST\" >&2; exit 3; }\necho \"hi $ARG_HOST\"\n",
+	},
+	"raw": {script: "echo \"$ARG_TARGET\"\n"},
+}
+
+func TestPrepareShard(t *testing.T) {
+	cli := newTestCLI(t, shardModules)
+	cli.envMgr.Set("ports", "1..3") // list-valued, but not an option of any module
+
+	if err := os.WriteFile(filepath.Join(cli.currentDirectory, "hosts.txt"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		module  string
+		args    []string
+		option  string // "" for a run that isn't split
+		total   int
+		wantErr bool
+	}{
+		{module: "echo", args: []string{"host=10.0.0.1..4", "threads=2"}, option: "host", total: 4},
+		{module: "echo", args: []string{"host=@hosts.txt", "threads=2"}, option: "host", total: 2},
+		{module: "echo", args: []string{"host=h", "threads=2"}},
+		{module: "echo", args: []string{"host=1..2", "port=80..81", "threads=2"}, wantErr: true},
+		{module: "echo", args: []string{"host=1..2", "port=80..82", "shard=port", "threads=2"}, option: "port", total: 3},
+		{module: "raw", args: []string{"target=1..5", "threads=2"}},
+		{module: "raw", args: []string{"target=1..5", "shard=target", "threads=2"}, option: "target", total: 5},
+		{module: "raw", args: []string{"target=x", "shard=target", "threads=2"}, wantErr: true},
+		{module: "raw", args: []string{"shard=target", "threads=2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		name := tt.module + " " + strings.Join(tt.args, " ")
+		run, err := cli.resolveModuleRun(context.Background(), tt.module, tt.args, nil)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: resolved with shard option %q, want an error", name, run.shardOption)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if run.shardOption != tt.option || run.shardTotal != tt.total {
+			t.Errorf("%s: split %q over %d items, want %q over %d", name, run.shardOption, run.shardTotal, tt.option, tt.total)
+		}
+		if _, leaked := run.args["shard"]; leaked {
+			t.Errorf("%s: shard= reached the module", name)
+		}
+		if run.shardIter != nil {
+			run.shardIter.Close()
+		}
+	}
+}
+
+func TestRunModuleThreaded(t *testing.T) {
+	cli := newTestCLI(t, shardModules)
+
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	run, err := cli.resolveModuleRun(ctx, "echo", []string{"host=1..12", "threads=4", "ordered=1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	result, err := cli.runModuleThreaded(ctx, run, shardOptions{
+		exec:    run.execOptions(true),
+		out:     &out,
+		ordered: run.ordered,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := 1; i <= 12; i++ {
+		if i != 7 {
+			want = append(want, fmt.Sprintf("[%d] hi %d", i, i))
+		}
+	}
+	if got := strings.Split(result.Output, "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if result.Success || result.ExitCode != 3 || result.Error != "[7] no 7" {
+		t.Errorf("result = success %v, exit %d, error %q; want the failure of item 7", result.Success, result.ExitCode, result.Error)
+	}
+	if summary := out.String(); !strings.Contains(summary, "Failed:") || !strings.Contains(summary, "(7)") {
+		t.Errorf("summary doesn't list the failed item:\n%s", summary)
+	}
+	// Ordered mode prints every item in input order
+	if i, j := strings.Index(out.String(), "host=2 "), strings.Index(out.String(), "host=11 "); i < 0 || j < i {
+		t.Errorf("items printed out of order:\n%s", out.String())
+	}
+}
+
+func TestShardAggregate(t *testing.T) {
+	agg := newShardAggregate(32)
+	agg.add(shardOutcome{item: shardItem{0, "a"}, result: &core.ExecutionResult{
+		Success: true, Output: "one\n\ntwo\n",
+		Findings: []core.Finding{{Host: "a"}}, Outputs: map[string]string{"k": "1"},
+	}})
+	agg.add(shardOutcome{item: shardItem{1, "b"}, result: &core.ExecutionResult{ExitCode: 2, Output: "three", Error: "bad"}})
+	agg.add(shardOutcome{item: shardItem{2, "c"}, err: fmt.Errorf("invalid")})
+	agg.add(shardOutcome{item: shardItem{3, "d"}, result: &core.ExecutionResult{Success: true, Output: strings.Repeat("x", 64)}})
+
+	result := agg.result()
+	if result.Success || result.ExitCode != 2 {
+		t.Errorf("success %v, exit %d, want the first failure's exit 2", result.Success, result.ExitCode)
+	}
+	if want := "[a] one\n[a] two\n[b] three"; result.Output != want {
+		t.Errorf("output = %q, want %q", result.Output, want)
+	}
+	if want := "[b] bad\n[c] invalid"; result.Error != want {
+		t.Errorf("error = %q, want %q", result.Error, want)
+	}
+	if !result.OutputTruncated {
+		t.Error("output past the limit was not reported as truncated")
+	}
+	if len(result.Findings) != 1 || result.Outputs["a.k"] != "1" {
+		t.Errorf("findings %v, outputs %v", result.Findings, result.Outputs)
+	}
+	if agg.finished != 4 || agg.failures != 2 || !reflect.DeepEqual(agg.failed, []string{"b", "c"}) {
+		t.Errorf("finished %d, failed %d %v", agg.finished, agg.failures, agg.failed)
+	}
+}
+
+func TestCheckpointSecrets(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{
+		"login": {
+			yaml:   "options:\n  user:\n    type: string\n  pass:\n    type: secret\n",
+			script: "[ \"$ARG_PASS\" = hunter2 ] || exit 2\n[ \"$ARG_USER\" = 2 ] && [ ! -f \"$HOME/fixed\" ] && exit 1\necho ok\n",
+		},
+		"crack": {
+			yaml:   "options:\n  word:\n    type: secret\n",
+			script: "[ \"$ARG_WORD\" = bravo ] && exit 1\necho ok\n",
+		},
+	})
+	cli.stdout, cli.stderr = &termBuffer{}, &termBuffer{}
+	home := os.Getenv("HOME")
+
+	// onlyCheckpoint returns the one checkpoint left and its file
+	onlyCheckpoint := func() (*core.Checkpoint, string) {
+		t.Helper()
+		checkpoints, err := core.ListCheckpoints()
+		if err != nil || len(checkpoints) != 1 {
+			t.Fatalf("checkpoints = %v (%v), want one", checkpoints, err)
+		}
+		dir, _ := core.CheckpointsDir()
+		data, err := os.ReadFile(filepath.Join(dir, checkpoints[0].ID+".jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return checkpoints[0], string(data)
+	}
+
+	// A secret argument is left out and given again on resume
+	cli.RunModule("login", []string{"user=1..3", "pass=hunter2", "threads=2"})
+	cp, data := onlyCheckpoint()
+	if strings.Contains(data, "hunter2") {
+		t.Errorf("checkpoint stores the secret: %s", data)
+	}
+	if !reflect.DeepEqual(cp.Omitted, []string{"pass"}) || !reflect.DeepEqual(cp.Args, []string{"user=1..3", "threads=2"}) {
+		t.Errorf("args = %v omitted = %v, want pass left out", cp.Args, cp.Omitted)
+	}
+	if err := os.WriteFile(filepath.Join(home, "fixed"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cli.HandleResume([]string{cp.ID, "--failed", "pass=hunter2"})
+	if checkpoints, _ := core.ListCheckpoints(); len(checkpoints) != 0 {
+		t.Fatalf("resume with the secret left %d checkpoint(s), want the run finished", len(checkpoints))
+	}
+
+	// The items of a secret sharded option are masked
+	if err := os.WriteFile(filepath.Join(cli.currentDirectory, "words.txt"), []byte("alpha\nbravo\ncharlie\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cli.RunModule("crack", []string{"word=@words.txt", "threads=2"})
+	cp, data = onlyCheckpoint()
+	for _, word := range []string{"alpha", "bravo", "charlie"} {
+		if strings.Contains(data, word) {
+			t.Errorf("checkpoint stores the item %q: %s", word, data)
+		}
+	}
+	for _, item := range cp.Items {
+		if item.Value != secretMask {
+			t.Errorf("item %d = %q, want it masked", item.Index, item.Value)
+		}
+	}
+}
+
+func TestShardReporterSkipsFinished(t *testing.T) {
+	// A resumed run where items 0 and 2 already finished
+	var printed []int
+	rep := &shardReporter{out: &bytes.Buffer{}, ordered: true, option: "host", total: 3,
+		skip: map[int]bool{0: true, 2: true}, pending: make(map[int]shardOutcome),
+		printed: func(o shardOutcome) { printed = append(printed, o.item.index) }}
+
+	ok := &core.ExecutionResult{Success: true}
+	rep.report(shardOutcome{item: shardItem{1, "b"}, result: ok})
+	if !reflect.DeepEqual(printed, []int{1}) {
+		t.Fatalf("printed %v, want item 1 right away", printed)
+	}
+	rep.report(shardOutcome{item: shardItem{4, "e"}, result: ok})
+	rep.report(shardOutcome{item: shardItem{3, "d"}, result: ok})
+	if !reflect.DeepEqual(printed, []int{1, 3, 4}) || len(rep.pending) != 0 {
+		t.Errorf("printed %v with %d pending, want items 1, 3 and 4 in order", printed, len(rep.pending))
+	}
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+
+	"lanmanvan/core"
+)
+
+// handleModuleCommand handles module <subcommand> ...
+func (cli *CLI) handleModuleCommand(args []string) {
+	if len(args) < 3 || args[0] != "deps" {
+		cli.printError("Usage: module deps <install|rebuild|clean> <module>")
+		cli.lastExitCode = 2
+		return
+	}
+	action, name := args[1], args[2]
+
+	module, err := cli.manager.GetModule(name)
+	if err != nil {
+		cli.printError(err.Error())
+		cli.lastExitCode = 1
+		return
+	}
+	if !core.HasPythonRequirements(module) {
+		cli.printInfo(fmt.Sprintf("Module '%s' has no requirements.txt or python.requirements, nothing to do", name))
+		return
+	}
+
+	switch action {
+	case "install":
+		cli.buildVenv(module, false)
+	case "rebuild":
+		cli.buildVenv(module, true)
+	case "clean":
+		removed := cli.manager.CleanVenvs(module)
+		cli.printSuccess(fmt.Sprintf("Removed %d virtualenv(s) of '%s'", removed, name))
+	default:
+		cli.printError(fmt.Sprintf("Unknown action '%s', expected install, rebuild or clean", action))
+		cli.lastExitCode = 2
+	}
+}
+
+// buildVenv installs a module's requirements into its virtualenv, showing pip's output
+func (cli *CLI) buildVenv(module *core.ModuleConfig, rebuild bool) bool {
+	path, err := core.VenvPath(module)
+	if err != nil {
+		cli.printError(err.Error())
+		cli.lastExitCode = 1
+		return false
+	}
+	if !rebuild && core.VenvReady(path) {
+		cli.printSuccess(fmt.Sprintf("Virtualenv of '%s' is up to date: %s", module.Name, path))
+		return true
+	}
+
+	ctx := cli.startModuleExecution(0)
+	defer cli.stopModuleExecution()
+
+	build := cli.manager.EnsureVenv
+	if rebuild {
+		build = cli.manager.RebuildVenv
+	}
+	if _, err := build(ctx, module, cli.out()); err != nil {
+		cli.printError(err.Error())
+		cli.lastExitCode = 1
+		return false
+	}
+	cli.printSuccess(fmt.Sprintf("Virtualenv of '%s' is ready", module.Name))
+	return true
+}
+
+// venvStatus describes a module's virtualenv for info, "" when it has none
+func venvStatus(module *core.ModuleConfig) string {
+	if !core.HasPythonRequirements(module) {
+		return ""
+	}
+	path, err := core.VenvPath(module)
+	if err != nil {
+		return err.Error()
+	}
+	if core.VenvReady(path) {
+		return path
+	}
+	return path + core.Color("yellow", " (not built, installed on first run)")
+}
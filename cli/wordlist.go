@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Streaming wordlists   @rockyou.txt   @list.txt.gz   @-   $cat("words.txt")
+// ────────────────────────────────────────────────────────────────────────────────
+
+// lineFileIterator streams one item per line, skipping blank lines and # comments,
+// without loading the file into memory. Gzip files are decompressed on the fly.
+type lineFileIterator struct {
+	path     string
+	dedup    bool
+	file     *os.File
+	reader   *bufio.Reader
+	line     int            // physical lines read so far
+	first    map[uint64]int // with dedup, the line each item first appears on, filled by count
+	total    int            // items in the file, -1 until counted
+	produced int
+}
+
+// newLineFileIterator opens path ("-" for stdin) at its first line
+func newLineFileIterator(path string, dedup bool) (*lineFileIterator, error) {
+	path, err := wordlistPath(path)
+	if err != nil {
+		return nil, err
+	}
+	it := &lineFileIterator{path: path, dedup: dedup, total: -1}
+	it.file, it.reader, err = openWordlist(path)
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// wordlistPath expands ~ and spools stdin ("-") to a temporary file
+func wordlistPath(path string) (string, error) {
+	if path == "-" {
+		return spoolStdin()
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	return path, nil
+}
+
+// openWordlist opens a plain or gzip-compressed file
+func openWordlist(path string) (*os.File, *bufio.Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read list file: %v", err)
+	}
+
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	var r io.Reader = f
+	if n == 2 && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("cannot read %s: %v", path, err)
+		}
+		r = gz
+	}
+	return f, bufio.NewReaderSize(r, 64*1024), nil
+}
+
+// wordlistItem returns the item on a line, or false for blank lines and comments
+func wordlistItem(line []byte) ([]byte, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return nil, false
+	}
+	return line, true
+}
+
+// lineHash is the dedup key of an item, 8 bytes per unique line instead of the line itself
+func lineHash(item []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(item)
+	return h.Sum64()
+}
+
+func (it *lineFileIterator) Next() (string, bool) {
+	if it.reader == nil {
+		return "", false
+	}
+	if it.dedup && it.first == nil {
+		it.Len() // the counting pass finds where each item first appears
+	}
+	for {
+		line, err := it.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			it.line++
+			if item, ok := wordlistItem(line); ok {
+				if it.dedup && it.first[lineHash(item)] != it.line {
+					continue
+				}
+				it.produced++
+				return string(item), true
+			}
+		}
+		if err != nil {
+			it.Close()
+			return "", false
+		}
+	}
+}
+
+// Len counts the remaining items with one quick pass over the file on first use
+func (it *lineFileIterator) Len() int {
+	if it.total < 0 {
+		it.total = it.count()
+	}
+	if n := it.total - it.produced; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// count returns the number of items in the file, or 0 if it can't be read.
+// With dedup it also records the line each item first appears on, for Next.
+func (it *lineFileIterator) count() int {
+	if it.dedup {
+		it.first = make(map[uint64]int)
+	}
+	f, r, err := openWordlist(it.path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	n, line := 0, 0
+	for {
+		text, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Overlong line: ReadSlice reuses its buffer, so collect a copy
+			text = append([]byte(nil), text...)
+			for err == bufio.ErrBufferFull {
+				var more []byte
+				more, err = r.ReadSlice('\n')
+				text = append(text, more...)
+			}
+		}
+		if len(text) > 0 {
+			line++
+		}
+		if item, ok := wordlistItem(text); ok {
+			if it.dedup {
+				key := lineHash(item)
+				if _, dup := it.first[key]; dup {
+					continue
+				}
+				it.first[key] = line
+			}
+			n++
+		}
+		if err != nil {
+			return n
+		}
+	}
+}
+
+func (it *lineFileIterator) Close() error {
+	if it.file == nil {
+		return nil
+	}
+	err := it.file.Close()
+	it.file, it.reader = nil, nil
+	return err
+}
+
+// stdinSpool holds stdin copied to disk, so it can be counted, re-read by products and resumed
+var stdinSpool struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// spoolStdin copies stdin to a temporary file the first time it is used
+func spoolStdin() (string, error) {
+	stdinSpool.once.Do(func() {
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			stdinSpool.err = fmt.Errorf("stdin is a terminal, pipe a wordlist in to use @-")
+			return
+		}
+		f, err := os.CreateTemp("", "lanmanvan-stdin-*")
+		if err != nil {
+			stdinSpool.err = err
+			return
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, os.Stdin); err != nil {
+			os.Remove(f.Name())
+			stdinSpool.err = fmt.Errorf("cannot read stdin: %v", err)
+			return
+		}
+		stdinSpool.path = f.Name()
+	})
+	return stdinSpool.path, stdinSpool.err
+}
+
+// removeStdinSpool deletes the spooled copy of stdin, if any
+func removeStdinSpool() {
+	if stdinSpool.path != "" {
+		os.Remove(stdinSpool.path)
+	}
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// skip= / limit= windows over any source
+// ────────────────────────────────────────────────────────────────────────────────
+
+// sourceOptions select part of a loop source: for w in @rockyou.txt skip=1000 limit=500 dedup=yes
+type sourceOptions struct {
+	skip  int
+	limit int // -1 for no limit
+	dedup bool
+}
+
+// windowCount returns how many of the remaining n items a window still lets through
+func windowCount(n, skip, limit int) int {
+	n -= skip
+	if n < 0 {
+		n = 0
+	}
+	if limit >= 0 && n > limit {
+		n = limit
+	}
+	return n
+}
+
+// windowIterator drops the first skip items and stops after limit more
+type windowIterator struct {
+	inner Iterator
+	skip  int
+	limit int
+}
+
+// newWindowIterator wraps inner unless the window is the whole source
+func newWindowIterator(inner Iterator, so sourceOptions) Iterator {
+	if so.skip == 0 && so.limit < 0 {
+		return inner
+	}
+	return &windowIterator{inner: inner, skip: so.skip, limit: so.limit}
+}
+
+func (it *windowIterator) Next() (string, bool) {
+	for it.skip > 0 {
+		if _, ok := it.inner.Next(); !ok {
+			return "", false
+		}
+		it.skip--
+	}
+	if it.limit == 0 {
+		return "", false
+	}
+	v, ok := it.inner.Next()
+	if ok && it.limit > 0 {
+		it.limit--
+	}
+	return v, ok
+}
+
+func (it *windowIterator) Len() int     { return windowCount(it.inner.Len(), it.skip, it.limit) }
+func (it *windowIterator) Close() error { return it.inner.Close() }
+
+// windowTupleIterator is windowIterator for multi-variable loops
+type windowTupleIterator struct {
+	inner TupleIterator
+	skip  int
+	limit int
+}
+
+// newWindowTupleIterator wraps inner unless the window is the whole source
+func newWindowTupleIterator(inner TupleIterator, so sourceOptions) TupleIterator {
+	if so.skip == 0 && so.limit < 0 {
+		return inner
+	}
+	return &windowTupleIterator{inner: inner, skip: so.skip, limit: so.limit}
+}
+
+func (it *windowTupleIterator) Next() ([]string, bool) {
+	for it.skip > 0 {
+		if _, ok := it.inner.Next(); !ok {
+			return nil, false
+		}
+		it.skip--
+	}
+	if it.limit == 0 {
+		return nil, false
+	}
+	v, ok := it.inner.Next()
+	if ok && it.limit > 0 {
+		it.limit--
+	}
+	return v, ok
+}
+
+func (it *windowTupleIterator) Len() int     { return windowCount(it.inner.Len(), it.skip, it.limit) }
+func (it *windowTupleIterator) Close() error { return it.inner.Close() }
+
+// windowData applies skip= and limit= to loaded structured data
+func windowData(data []interface{}, so sourceOptions) []interface{} {
+	n := windowCount(len(data), so.skip, so.limit)
+	if n == 0 {
+		return nil
+	}
+	return data[so.skip : so.skip+n]
+}
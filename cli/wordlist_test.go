@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLineFileIterator(t *testing.T) {
+	dir := t.TempDir()
+	content := "admin\n\n# comment\n  root  \nadmin\npa$1word\nlast"
+
+	plain := filepath.Join(dir, "words.txt")
+	if err := os.WriteFile(plain, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compressed := filepath.Join(dir, "words.txt.gz")
+	f, err := os.Create(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(content))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	all := []string{"admin", "root", "admin", "pa$1word", "last"}
+	unique := []string{"admin", "root", "pa$1word", "last"}
+
+	for _, path := range []string{plain, compressed} {
+		for _, dedup := range []bool{false, true} {
+			want := all
+			if dedup {
+				want = unique
+			}
+			factory, err := loopSourceFactory("@"+path, dedup)
+			if err != nil {
+				t.Fatalf("loopSourceFactory(@%s) error: %v", path, err)
+			}
+			it, err := factory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := drain(t, it); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (dedup=%v) = %q, want %q", filepath.Base(path), dedup, got, want)
+			}
+		}
+
+		// Len counts what is left, duplicates once with dedup
+		for _, dedup := range []bool{false, true} {
+			want := len(all)
+			if dedup {
+				want = len(unique)
+			}
+			it, err := newLineFileIterator(path, dedup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := it.Len(); n != want {
+				t.Errorf("%s (dedup=%v) Len() = %d, want %d", filepath.Base(path), dedup, n, want)
+			}
+			it.Next()
+			if n := it.Len(); n != want-1 {
+				t.Errorf("%s (dedup=%v) Len() after one item = %d, want %d", filepath.Base(path), dedup, n, want-1)
+			}
+			it.Close()
+		}
+	}
+
+	if _, err := loopSourceFactory("@"+filepath.Join(dir, "missing.txt"), false); err == nil {
+		t.Error("loopSourceFactory of a missing file succeeded")
+	}
+}
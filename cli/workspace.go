@@ -0,0 +1,461 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// defaultWorkspace is used until the user creates or selects another one
+const defaultWorkspace = "default"
+
+// currentWorkspaceFile persists the selected workspace between sessions
+func currentWorkspaceFile() string {
+	return filepath.Join(filepath.Dir(core.WorkspacesDir()), "workspace")
+}
+
+// workspaceName returns the selected workspace, falling back to the default
+func (cli *CLI) workspaceName() string {
+	cli.workspaceMu.Lock()
+	defer cli.workspaceMu.Unlock()
+	return cli.selectedWorkspace()
+}
+
+// selectedWorkspace returns the workspace name, the caller holds workspaceMu
+func (cli *CLI) selectedWorkspace() string {
+	if cli.workspace != nil {
+		return cli.workspace.Name
+	}
+	if data, err := os.ReadFile(currentWorkspaceFile()); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	return defaultWorkspace
+}
+
+// openWorkspace returns the session's workspace, opening it on first use
+func (cli *CLI) openWorkspace() (*core.Workspace, error) {
+	cli.workspaceMu.Lock()
+	defer cli.workspaceMu.Unlock()
+
+	if cli.workspace != nil {
+		return cli.workspace, nil
+	}
+	ws, err := core.OpenWorkspace(cli.selectedWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	cli.workspace = ws
+	return ws, nil
+}
+
+// closeWorkspace releases the workspace database
+func (cli *CLI) closeWorkspace() {
+	cli.workspaceMu.Lock()
+	defer cli.workspaceMu.Unlock()
+
+	if cli.workspace != nil {
+		cli.workspace.Close()
+		cli.workspace = nil
+	}
+}
+
+// recordRun stores a finished module execution in the current workspace
+func (cli *CLI) recordRun(moduleName string, args map[string]string, result *core.ExecutionResult, duration time.Duration) {
+	if result == nil {
+		return
+	}
+	ws, err := cli.openWorkspace()
+	if err != nil {
+		cli.printWarning(fmt.Sprintf("Run not recorded: %v", err))
+		return
+	}
+	if _, err := ws.RecordRun(moduleName, args, result, duration); err != nil {
+		cli.printWarning(fmt.Sprintf("Run not recorded: %v", err))
+	}
+}
+
+// HandleWorkspace implements the 'workspace' command
+func (cli *CLI) HandleWorkspace(args []string) {
+	if len(args) == 0 {
+		cli.printInfo(fmt.Sprintf("Current workspace: %s", core.Color("cyan", cli.workspaceName())))
+		return
+	}
+
+	sub := args[0]
+	switch sub {
+	case "list", "ls":
+		names, err := core.ListWorkspaces()
+		if err != nil {
+			cli.printError(fmt.Sprintf("Failed to list workspaces: %v", err))
+			return
+		}
+		current := cli.workspaceName()
+		fmt.Fprintln(cli.out())
+		fmt.Fprintln(cli.out(), core.NmapBox("Workspaces"))
+		if len(names) == 0 {
+			fmt.Fprintln(cli.out(), core.NmapSubBox("(none yet)"))
+		}
+		for _, name := range names {
+			if name == current {
+				fmt.Fprintln(cli.out(), core.NmapSubBox(core.Color("green", "* "+name)))
+			} else {
+				fmt.Fprintln(cli.out(), core.NmapSubBox("  "+name))
+			}
+		}
+		fmt.Fprintln(cli.out())
+
+	case "create", "new", "use", "switch":
+		if len(args) < 2 {
+			cli.printError(fmt.Sprintf("Usage: workspace %s <name>", sub))
+			return
+		}
+		name := args[1]
+		exists := core.WorkspaceExists(name)
+		if (sub == "create" || sub == "new") && exists {
+			cli.printError(fmt.Sprintf("Workspace '%s' already exists, use 'workspace use %s'", name, name))
+			return
+		}
+		if (sub == "use" || sub == "switch") && !exists && name != defaultWorkspace {
+			cli.printError(fmt.Sprintf("Workspace '%s' does not exist, use 'workspace create %s'", name, name))
+			return
+		}
+		cli.switchWorkspace(name, !exists)
+
+	case "delete", "rm", "remove":
+		if len(args) < 2 {
+			cli.printError("Usage: workspace delete <name>")
+			return
+		}
+		name := args[1]
+		if name == cli.workspaceName() {
+			cli.printError("Cannot delete the current workspace, switch to another one first")
+			return
+		}
+		if err := core.DeleteWorkspace(name); err != nil {
+			cli.printError(err.Error())
+			return
+		}
+		cli.printSuccess(fmt.Sprintf("Workspace '%s' deleted", name))
+
+	default:
+		cli.printError("Usage: workspace [list|create <name>|use <name>|delete <name>]")
+	}
+}
+
+// switchWorkspace opens the named workspace and makes it current
+func (cli *CLI) switchWorkspace(name string, created bool) {
+	ws, err := core.OpenWorkspace(name)
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+	cli.closeWorkspace()
+	cli.workspaceMu.Lock()
+	cli.workspace = ws
+	cli.workspaceMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(currentWorkspaceFile()), 0755); err == nil {
+		os.WriteFile(currentWorkspaceFile(), []byte(name+"\n"), 0644)
+	}
+
+	if created {
+		cli.printSuccess(fmt.Sprintf("Workspace '%s' created and selected", name))
+	} else {
+		cli.printSuccess(fmt.Sprintf("Using workspace: %s", core.Color("cyan", name)))
+	}
+}
+
+// workspaceQuery holds the filters and export target of a query command
+type workspaceQuery struct {
+	filters map[string]string
+	output  string
+}
+
+// parseWorkspaceQuery parses "key=value" filters and "-o file" from the command args
+func parseWorkspaceQuery(args []string) (*workspaceQuery, error) {
+	q := &workspaceQuery{filters: make(map[string]string)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "--output":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s needs a file name", arg)
+			}
+			q.output = args[i+1]
+			i++
+		case strings.Contains(arg, "="):
+			parts := strings.SplitN(arg, "=", 2)
+			q.filters[strings.ToLower(parts[0])] = strings.ToLower(parts[1])
+		default:
+			return nil, fmt.Errorf("unexpected argument '%s', use key=value filters or -o <file.json|file.csv>", arg)
+		}
+	}
+	return q, nil
+}
+
+// match reports whether a row satisfies every filter (case-insensitive substring match)
+func (q *workspaceQuery) match(row map[string]string) bool {
+	for key, want := range q.filters {
+		got, ok := row[key]
+		if !ok || !strings.Contains(strings.ToLower(got), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkColumns rejects filters on columns the table doesn't have
+func (q *workspaceQuery) checkColumns(columns []string) error {
+	for key := range q.filters {
+		found := false
+		for _, col := range columns {
+			if col == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown filter '%s', available: %s", key, strings.Join(columns, ", "))
+		}
+	}
+	return nil
+}
+
+// HandleWorkspaceQuery implements the 'hosts', 'services', 'findings' and 'runs' commands
+func (cli *CLI) HandleWorkspaceQuery(kind string, args []string) {
+	q, err := parseWorkspaceQuery(args)
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	ws, err := cli.openWorkspace()
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	var columns []string
+	var rows []map[string]string
+	var records []interface{}
+
+	switch kind {
+	case "hosts":
+		columns = []string{"address", "findings", "modules", "first_seen", "last_seen"}
+		hosts, err := ws.Hosts()
+		if err != nil {
+			cli.printError(fmt.Sprintf("Failed to read hosts: %v", err))
+			return
+		}
+		sort.SliceStable(hosts, func(i, j int) bool { return compareAddresses(hosts[i].Address, hosts[j].Address) })
+		for _, h := range hosts {
+			if row := h.Row(); q.match(row) {
+				rows = append(rows, row)
+				records = append(records, h)
+			}
+		}
+	case "services":
+		columns = []string{"host", "port", "protocol", "service", "last_seen"}
+		services, err := ws.Services()
+		if err != nil {
+			cli.printError(fmt.Sprintf("Failed to read services: %v", err))
+			return
+		}
+		for _, s := range services {
+			if row := s.Row(); q.match(row) {
+				rows = append(rows, row)
+				records = append(records, s)
+			}
+		}
+	case "findings":
+		columns = []string{"id", "run", "module", "host", "port", "protocol", "service", "severity", "title", "detail"}
+		findings, err := ws.Findings()
+		if err != nil {
+			cli.printError(fmt.Sprintf("Failed to read findings: %v", err))
+			return
+		}
+		for _, f := range findings {
+			if row := f.Row(); q.match(row) {
+				rows = append(rows, row)
+				records = append(records, f)
+			}
+		}
+	case "runs":
+		columns = []string{"id", "module", "started", "duration", "exit", "status", "args"}
+		runs, err := ws.Runs()
+		if err != nil {
+			cli.printError(fmt.Sprintf("Failed to read runs: %v", err))
+			return
+		}
+		for _, r := range runs {
+			if row := r.Row(); q.match(row) {
+				rows = append(rows, row)
+				records = append(records, r)
+			}
+		}
+	}
+
+	if err := q.checkColumns(columns); err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	if q.output != "" {
+		if err := exportRecords(q.output, columns, rows, records); err != nil {
+			cli.printError(fmt.Sprintf("Export failed: %v", err))
+			return
+		}
+		cli.printSuccess(fmt.Sprintf("Exported %d %s to %s", len(rows), kind, q.output))
+		return
+	}
+
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("%s (%d) - workspace %s", columnHeader(kind), len(rows), ws.Name)))
+	if len(rows) == 0 {
+		fmt.Fprintln(cli.out(), core.NmapSubBox("Nothing recorded yet"))
+		fmt.Fprintln(cli.out())
+		return
+	}
+
+	// The detail column is long and only useful in exports
+	if kind == "findings" {
+		columns = columns[:len(columns)-1]
+	}
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = columnHeader(col)
+	}
+	table := core.NewTable(headers)
+	for _, row := range rows {
+		cols := make([]string, len(columns))
+		for i, col := range columns {
+			cols[i] = row[col]
+		}
+		table.AddRow(cols...)
+	}
+	fmt.Fprint(cli.out(), table.Render())
+	fmt.Fprintln(cli.out())
+}
+
+// ShowRun prints a recorded run in full, including its captured output
+func (cli *CLI) ShowRun(idArg string) {
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil {
+		cli.printError("Usage: runs show <id>")
+		return
+	}
+	ws, err := cli.openWorkspace()
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+	run, err := ws.Run(id)
+	if err != nil {
+		cli.printError(err.Error())
+		return
+	}
+
+	row := run.Row()
+	fmt.Fprintln(cli.out())
+	fmt.Fprintln(cli.out(), core.NmapBox(fmt.Sprintf("Run #%d - %s", run.ID, run.Module)))
+	fmt.Fprintln(cli.out(), core.NmapSubBox(fmt.Sprintf("Started:  %s", row["started"])))
+	fmt.Fprintln(cli.out(), core.NmapSubBox(fmt.Sprintf("Duration: %s", row["duration"])))
+	fmt.Fprintln(cli.out(), core.NmapSubBox(fmt.Sprintf("Status:   %s [exit: %d]", row["status"], run.ExitCode)))
+	if row["args"] != "" {
+		fmt.Fprintln(cli.out(), core.NmapSubBox(fmt.Sprintf("Args:     %s", row["args"])))
+	}
+	fmt.Fprintln(cli.out())
+	if strings.TrimSpace(run.Output) != "" {
+		fmt.Fprintln(cli.out(), core.NmapBox("Output"))
+		fmt.Fprintln(cli.out(), strings.TrimRight(run.Output, "\n"))
+		fmt.Fprintln(cli.out())
+	}
+	if strings.TrimSpace(run.Error) != "" {
+		cli.printError("Error Output:")
+		for _, line := range strings.Split(strings.TrimRight(run.Error, "\n"), "\n") {
+			fmt.Fprintf(cli.out(), "  %s\n", core.Color("red", line))
+		}
+		fmt.Fprintln(cli.out())
+	}
+}
+
+// columnHeader turns a column name like "last_seen" into "Last seen"
+func columnHeader(col string) string {
+	if col == "" {
+		return col
+	}
+	col = strings.ReplaceAll(col, "_", " ")
+	return strings.ToUpper(col[:1]) + col[1:]
+}
+
+// exportRecords writes rows as CSV or records as JSON, chosen by the file extension
+func exportRecords(path string, columns []string, rows []map[string]string, records []interface{}) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if records == nil {
+			records = []interface{}{}
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(data, '\n'), 0644)
+
+	case ".csv":
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := csv.NewWriter(f)
+		w.Write(columns)
+		for _, row := range rows {
+			record := make([]string, len(columns))
+			for i, col := range columns {
+				record[i] = row[col]
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		return fmt.Errorf("unsupported export format '%s', use .json or .csv", filepath.Ext(path))
+	}
+}
+
+// compareAddresses orders IP addresses numerically and everything else alphabetically
+func compareAddresses(a, b string) bool {
+	ka, kb := addressKey(a), addressKey(b)
+	if ka != kb {
+		return ka < kb
+	}
+	return a < b
+}
+
+// addressKey returns a sortable key for an IPv4 address, or the address itself
+func addressKey(addr string) string {
+	parts := strings.Split(addr, ".")
+	if len(parts) != 4 {
+		return "~" + addr
+	}
+	key := ""
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 255 {
+			return "~" + addr
+		}
+		key += fmt.Sprintf("%03d", n)
+	}
+	return key
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordedRunArgs(t *testing.T) {
+	cli := newTestCLI(t, map[string]testModule{
+		"login": {
+			yaml:   "options:\n  host:\n    type: string\n  password:\n    type: secret\n",
+			script: "echo \"$ARG_HOST\"\n",
+		},
+		"raw": {script: "echo \"$ARG_TARGET\"\n"},
+	})
+	cli.envMgr.Set("api_key", "global-secret")
+	cli.envMgr.Set("host", "10.0.0.1")
+
+	if !cli.RunModule("login", []string{"password=hunter2", "note=retry"}) {
+		t.Fatal("RunModule did not handle the module")
+	}
+
+	ws, err := cli.openWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := ws.Runs()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs = %v, %v", runs, err)
+	}
+	// Passed args are kept even when undeclared, global variables only when declared
+	want := map[string]string{"host": "10.0.0.1", "password": secretMask, "note": "retry"}
+	if !reflect.DeepEqual(runs[0].Args, want) {
+		t.Errorf("recorded args = %v, want %v", runs[0].Args, want)
+	}
+	if runs[0].Output != "10.0.0.1\n" {
+		t.Errorf("recorded output = %q", runs[0].Output)
+	}
+
+	// A module declaring nothing keeps what it was given
+	cli.RunModule("raw", []string{"target=x"})
+	runs, err = ws.Runs()
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("runs = %v, %v", runs, err)
+	}
+	for _, run := range runs {
+		if run.Module == "raw" && !reflect.DeepEqual(run.Args, map[string]string{"target": "x"}) {
+			t.Errorf("recorded args of raw = %v, want only target", run.Args)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// wrapperPresets are the short names accepted by wrap= and the wrapper command
+var wrapperPresets = map[string]string{
+	"sudo":        "sudo -E",
+	"proxychains": "proxychains4 -q",
+	"tor":         "torsocks",
+	"torsocks":    "torsocks",
+	"nice":        "nice -n 10",
+}
+
+// parseWrapper turns a wrap= value or wrapper argument into a command prefix.
+// A preset name expands to its command, none and off mean no wrapper.
+func parseWrapper(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "", "none", "off":
+		return nil, nil
+	}
+	if preset, ok := wrapperPresets[value]; ok {
+		value = preset
+	}
+
+	wrapper := strings.Fields(value)
+	if _, err := exec.LookPath(wrapper[0]); err != nil {
+		return nil, fmt.Errorf("wrapper '%s' not found in PATH", wrapper[0])
+	}
+	return wrapper, nil
+}
+
+// handleWrapperCommand shows, sets or clears the session-wide wrapper
+func (cli *CLI) handleWrapperCommand(args []string) {
+	if len(args) == 0 {
+		if len(cli.wrapper) == 0 {
+			cli.printInfo("No wrapper set, modules run directly")
+		} else {
+			cli.printInfo(fmt.Sprintf("Modules run under: %s", core.Color("cyan", strings.Join(cli.wrapper, " "))))
+		}
+		return
+	}
+
+	wrapper, err := parseWrapper(strings.Join(args, " "))
+	if err != nil {
+		cli.printError(err.Error())
+		cli.lastExitCode = 1
+		return
+	}
+	cli.wrapper = wrapper
+	if len(wrapper) == 0 {
+		cli.printSuccess("Wrapper cleared, modules run directly")
+		return
+	}
+	cli.printSuccess(fmt.Sprintf("Modules now run under: %s (wrap=none skips it for one run)", core.Color("cyan", strings.Join(wrapper, " "))))
+}
+
+// runWrapped runs one command under a wrapper preset: #sudo portscan host=... runs
+// the module with sudo -E, as wrap=sudo would
+func (cli *CLI) runWrapped(preset string, cmd *simpleCmd) {
+	if len(cmd.words) < 2 {
+		cli.printError(fmt.Sprintf("Missing command after %s", cmd.name()))
+		cli.lastExitCode = 2
+		return
+	}
+	wrapper, err := parseWrapper(preset)
+	if err != nil {
+		cli.printError(err.Error())
+		cli.lastExitCode = 1
+		return
+	}
+
+	saved := cli.wrapper
+	cli.wrapper = wrapper
+	defer func() { cli.wrapper = saved }()
+
+	text := strings.TrimSpace(strings.TrimPrefix(cmd.text, cmd.name()))
+	cli.runCommand(&simpleCmd{words: cmd.words[1:], text: text})
+}
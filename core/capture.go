@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultOutputLimit caps how many bytes of each output stream are kept in an ExecutionResult
+const DefaultOutputLimit = 1 << 20 // 1 MiB
+
+// ExecOptions controls where a module's output goes during a single execution
+type ExecOptions struct {
+	Stdout      io.Writer // live stdout stream, defaults to os.Stdout
+	Stderr      io.Writer // live stderr stream, defaults to os.Stderr
+	Stdin       io.Reader // defaults to os.Stdin unless Quiet is set, the terminal only reaches Interactive modules
+	Interactive bool      // give the module the terminal, set from ModuleMetadata.Interactive
+	Quiet       bool      // capture only, nothing is streamed to the terminal
+	OutputLimit int       // bytes kept per stream, 0 uses the manager's limit
+	Wrapper     []string  // command the module runs under, e.g. sudo -E or proxychains4 -q
+	Dir         string    // directory relative file options are resolved against, the process's when empty
+
+	Started  func(pid int)                 // called once the module process is running
+	Exited   func(pid int)                 // called after the module process has been reaped
+	Progress func(pct int, message string) // called for every structured progress record
+}
+
+// cappedBuffer records writes up to a fixed number of bytes and silently
+// drops the rest, so a chatty module can't exhaust memory
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// newCappedBuffer creates a buffer that keeps at most limit bytes
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+// Write implements io.Writer, it always reports the full length as written
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	room := b.limit - b.buf.Len()
+	if room <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+// String returns the captured data
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Truncated reports whether data was dropped because of the limit
+func (b *cappedBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.truncated
+}
+
+// outputCapture tees a module's stdout and stderr to the live streams and to capped buffers
+type outputCapture struct {
+	stdout *cappedBuffer
+	stderr *cappedBuffer
+}
+
+// streams returns the writers and reader a command should use according to opts
+func (oc *outputCapture) streams(opts ExecOptions) (stdout io.Writer, stderr io.Writer, stdin io.Reader) {
+	if opts.Quiet {
+		return oc.stdout, oc.stderr, opts.Stdin
+	}
+
+	liveOut, liveErr := opts.Stdout, opts.Stderr
+	if liveOut == nil {
+		liveOut = os.Stdout
+	}
+	if liveErr == nil {
+		liveErr = os.Stderr
+	}
+	stdin = opts.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	return io.MultiWriter(liveOut, oc.stdout), io.MultiWriter(liveErr, oc.stderr), stdin
+}
+
+// newOutputCapture creates a capture keeping at most limit bytes per stream
+func newOutputCapture(limit int) *outputCapture {
+	if limit <= 0 {
+		limit = DefaultOutputLimit
+	}
+	return &outputCapture{
+		stdout: newCappedBuffer(limit),
+		stderr: newCappedBuffer(limit),
+	}
+}
+
+// fill copies the captured streams into result; stderr replaces the generic
+// wait error ("exit status 1") but never hides a cancellation or timeout message
+func (oc *outputCapture) fill(result *ExecutionResult) {
+	result.Output = oc.stdout.String()
+	result.OutputTruncated = oc.stdout.Truncated() || oc.stderr.Truncated()
+
+	stderr := oc.stderr.String()
+	if stderr == "" {
+		return
+	}
+	if result.Cancelled {
+		result.Error = result.Error + "\n" + stderr
+		return
+	}
+	result.Error = stderr
+}
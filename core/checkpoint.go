@@ -0,0 +1,280 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoint records which items of a loop or sharded module run have finished,
+// so an interrupted run can continue with only the rest. It is stored as JSON lines:
+// a header followed by one line per finished item, appended as items complete.
+type Checkpoint struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`              // "loop" or "module"
+	Command string    `json:"command,omitempty"` // the loop, for kind "loop"
+	Module  string    `json:"module,omitempty"`  // for kind "module"
+	Args    []string  `json:"args,omitempty"`    // module arguments as typed, without secrets
+	Omitted []string  `json:"omitted,omitempty"` // secret options left out of Args
+	Total   int       `json:"total"`
+	Created time.Time `json:"created"`
+
+	Items   map[int]CheckpointItem `json:"-"` // finished items by index
+	Updated time.Time              `json:"-"`
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// CheckpointItem is one finished item and its exit code
+type CheckpointItem struct {
+	Index    int    `json:"i"`
+	Value    string `json:"v"`
+	ExitCode int    `json:"exit"`
+}
+
+// CheckpointsDir returns ~/.lanmanvan/checkpoints
+func CheckpointsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "checkpoints"), nil
+}
+
+// checkpointPath returns the file of checkpoint id
+func checkpointPath(id string) (string, error) {
+	if !validWorkspaceName.MatchString(id) {
+		return "", fmt.Errorf("invalid checkpoint id '%s'", id)
+	}
+	dir, err := CheckpointsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".jsonl"), nil
+}
+
+// NewCheckpoint creates a checkpoint file and writes its header
+func NewCheckpoint(cp *Checkpoint) (*Checkpoint, error) {
+	dir, err := CheckpointsDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	cp.Created = time.Now()
+	cp.Updated = cp.Created
+	cp.Items = make(map[int]CheckpointItem)
+
+	// IDs are timestamps, with a suffix when several runs start in the same second
+	base := cp.Created.Format("20060102-150405")
+	for n := 1; ; n++ {
+		cp.ID = base
+		if n > 1 {
+			cp.ID = fmt.Sprintf("%s-%d", base, n)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, cp.ID+".jsonl"), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cp.file = f
+		break
+	}
+
+	if err := cp.writeLine(cp); err != nil {
+		cp.file.Close()
+		return nil, err
+	}
+	return cp, nil
+}
+
+// LoadCheckpoint reads a checkpoint. A torn last line from a crash is ignored.
+func LoadCheckpoint(id string) (*Checkpoint, error) {
+	path, err := checkpointPath(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("checkpoint '%s' not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("checkpoint '%s' is empty", id)
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(scanner.Bytes(), cp); err != nil {
+		return nil, fmt.Errorf("checkpoint '%s' is corrupt: %v", id, err)
+	}
+	cp.ID = id
+	cp.Items = make(map[int]CheckpointItem)
+	for scanner.Scan() {
+		var item CheckpointItem
+		if json.Unmarshal(scanner.Bytes(), &item) == nil {
+			cp.Items[item.Index] = item
+		}
+	}
+
+	cp.Updated = cp.Created
+	if info, err := f.Stat(); err == nil {
+		cp.Updated = info.ModTime()
+	}
+	return cp, nil
+}
+
+// ListCheckpoints returns all checkpoints, oldest first
+func ListCheckpoints() ([]*Checkpoint, error) {
+	dir, err := CheckpointsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []*Checkpoint
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if cp, err := LoadCheckpoint(id); err == nil {
+			checkpoints = append(checkpoints, cp)
+		}
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Created.Before(checkpoints[j].Created) })
+	return checkpoints, nil
+}
+
+// DeleteCheckpoint removes a checkpoint file
+func DeleteCheckpoint(id string) error {
+	path, err := checkpointPath(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("checkpoint '%s' not found", id)
+	}
+	return err
+}
+
+// Reopen opens a loaded checkpoint for appending, to record a resumed run
+func (cp *Checkpoint) Reopen() error {
+	path, err := checkpointPath(cp.ID)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	cp.file = f
+	return nil
+}
+
+// Record appends a finished item
+func (cp *Checkpoint) Record(index int, value string, exitCode int) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	item := CheckpointItem{Index: index, Value: value, ExitCode: exitCode}
+	cp.Items[index] = item
+	cp.Updated = time.Now()
+	return cp.writeLine(item)
+}
+
+// writeLine appends v as one JSON line
+func (cp *Checkpoint) writeLine(v interface{}) error {
+	if cp.file == nil {
+		return fmt.Errorf("checkpoint '%s' is not open", cp.ID)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = cp.file.Write(append(data, '\n'))
+	return err
+}
+
+// Done returns the number of finished items
+func (cp *Checkpoint) Done() int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return len(cp.Items)
+}
+
+// Failed returns the finished items with a non-zero exit code, in index order
+func (cp *Checkpoint) Failed() []CheckpointItem {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	var failed []CheckpointItem
+	for _, item := range cp.Items {
+		if item.ExitCode != 0 {
+			failed = append(failed, item)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+	return failed
+}
+
+// Skip returns the indexes a resumed run should not run again: every finished item,
+// or only the successful ones when failures are retried
+func (cp *Checkpoint) Skip(retryFailed bool) map[int]bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	skip := make(map[int]bool, len(cp.Items))
+	for index, item := range cp.Items {
+		if item.ExitCode == 0 || !retryFailed {
+			skip[index] = true
+		}
+	}
+	return skip
+}
+
+// Succeeded reports whether every item finished with exit code 0
+func (cp *Checkpoint) Succeeded() bool {
+	return cp.Done() >= cp.Total && len(cp.Failed()) == 0
+}
+
+// Close closes the checkpoint file, removing it when the run has fully succeeded.
+// kept reports whether the checkpoint is still there to resume from.
+func (cp *Checkpoint) Close() (kept bool, err error) {
+	cp.mu.Lock()
+	if cp.file != nil {
+		err = cp.file.Close()
+		cp.file = nil
+	}
+	cp.mu.Unlock()
+
+	if cp.Succeeded() {
+		if rmErr := DeleteCheckpoint(cp.ID); rmErr != nil && err == nil {
+			err = rmErr
+		}
+		return false, err
+	}
+	return true, err
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cp, err := NewCheckpoint(&Checkpoint{Kind: "loop", Command: "for x in 1..4 -> echo $x", Total: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []CheckpointItem{{0, "1", 0}, {2, "3", 1}, {1, "2", 0}} {
+		if err := cp.Record(item.Index, item.Value, item.ExitCode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kept, err := cp.Close(); err != nil || !kept {
+		t.Fatalf("Close() = %v, %v, want the unfinished checkpoint kept", kept, err)
+	}
+
+	loaded, err := LoadCheckpoint(cp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Kind != "loop" || loaded.Command != cp.Command || loaded.Total != 4 || !loaded.Created.Equal(cp.Created) {
+		t.Errorf("header = %+v, want that of %+v", loaded, cp)
+	}
+	if loaded.Done() != 3 {
+		t.Errorf("Done() = %d, want 3", loaded.Done())
+	}
+	if want := []CheckpointItem{{2, "3", 1}}; !reflect.DeepEqual(loaded.Failed(), want) {
+		t.Errorf("Failed() = %v, want %v", loaded.Failed(), want)
+	}
+	if want := map[int]bool{0: true, 1: true, 2: true}; !reflect.DeepEqual(loaded.Skip(false), want) {
+		t.Errorf("Skip(false) = %v, want %v", loaded.Skip(false), want)
+	}
+	if want := map[int]bool{0: true, 1: true}; !reflect.DeepEqual(loaded.Skip(true), want) {
+		t.Errorf("Skip(true) = %v, want %v", loaded.Skip(true), want)
+	}
+
+	// Resume: retry the failure and run the last item, then the checkpoint is done
+	if err := loaded.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Record(2, "3", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Record(3, "4", 0); err != nil {
+		t.Fatal(err)
+	}
+	if kept, err := loaded.Close(); err != nil || kept {
+		t.Fatalf("Close() = %v, %v, want the finished checkpoint removed", kept, err)
+	}
+	if _, err := LoadCheckpoint(cp.ID); err == nil {
+		t.Error("checkpoint still loads after a successful resume")
+	}
+}
+
+func TestLoadCheckpointIgnoresTornLine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cp, err := NewCheckpoint(&Checkpoint{Kind: "module", Module: "portscan", Args: []string{"host=h"}, Total: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Record(0, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	// A crash mid-write leaves half a line behind
+	if _, err := cp.file.WriteString(`{"i":1,"v":"b`); err != nil {
+		t.Fatal(err)
+	}
+	cp.file.Close()
+
+	loaded, err := LoadCheckpoint(cp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Done() != 1 || loaded.Module != "portscan" || !reflect.DeepEqual(loaded.Args, []string{"host=h"}) {
+		t.Errorf("loaded %+v with %d items, want the module header and 1 item", loaded, loaded.Done())
+	}
+}
+
+func TestLoadCheckpointErrors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".lanmanvan", "checkpoints")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.jsonl"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.jsonl"), []byte("not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"missing", "empty", "corrupt", "../escape"} {
+		if _, err := LoadCheckpoint(id); err == nil {
+			t.Errorf("LoadCheckpoint(%q) succeeded, want an error", id)
+		}
+	}
+}
+
+func TestCheckpointPermissions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cp, err := NewCheckpoint(&Checkpoint{Kind: "loop", Command: "for x in 1..2 -> echo $x", Total: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+
+	dir, _ := CheckpointsDir()
+	for path, want := range map[string]os.FileMode{dir: 0700, filepath.Join(dir, cp.ID+".jsonl"): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %o, want %o", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the framework version, checked against requires.lmv
+const Version = "2.0"
+
+// ProbeTimeout bounds each command run to find a dependency's version
+var ProbeTimeout = 5 * time.Second
+
+// Requirements lists what a module needs, from the requires: section of module.yaml.
+// Every entry is a name with an optional version constraint: "python3>=3.8",
+// "requests>=2.28,<3", "nmap".
+type Requirements struct {
+	LMV          string   `yaml:"lmv"`          // constraint on the framework version, e.g. ">=2.0"
+	Interpreters []string `yaml:"interpreters"` // python3, ruby, node ...
+	Binaries     []string `yaml:"binaries"`     // tools that must be on PATH
+	Python       []string `yaml:"python"`       // pip packages, by distribution name
+	Gems         []string `yaml:"gems"`         // Ruby gems
+}
+
+// DependencyCheck is the outcome of checking one requirement
+type DependencyCheck struct {
+	Kind       string // framework, interpreter, binary, python or gem
+	Name       string
+	Constraint string // "" accepts any version
+	Found      string // version found, "" when missing or unknown
+	OK         bool
+	Problem    string // why the check failed
+}
+
+// String describes the requirement, e.g. "python3 >=3.8"
+func (d DependencyCheck) String() string {
+	if d.Constraint == "" {
+		return d.Name
+	}
+	return d.Name + " " + d.Constraint
+}
+
+// DependencyError is returned when a module is run with unmet requirements
+type DependencyError struct {
+	Module string
+	Failed []DependencyCheck
+}
+
+// Error implements the error interface
+func (e *DependencyError) Error() string {
+	problems := make([]string, len(e.Failed))
+	for i, d := range e.Failed {
+		problems[i] = fmt.Sprintf("%s (%s)", d.String(), d.Problem)
+	}
+	return fmt.Sprintf("module '%s' has unmet dependencies: %s, run 'doctor %s' for details",
+		e.Module, strings.Join(problems, ", "), e.Module)
+}
+
+// versionArgs are the arguments printing an interpreter's version, --version by default
+var versionArgs = map[string][]string{
+	"go": {"version"},
+}
+
+// versionPattern finds a dotted version number in a --version output
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// probeResult is a cached version probe
+type probeResult struct {
+	version string
+	err     error
+}
+
+// CheckDependencies checks the module's requirements and the interpreter it runs with
+// (the go toolchain for Go modules).
+// Probes are cached until the next DiscoverModules, so checking before each run is cheap.
+func (mm *ModuleManager) CheckDependencies(module *ModuleConfig) []DependencyCheck {
+	return append(mm.checkTools(module), mm.checkPythonPackages(module)...)
+}
+
+// requirements returns the requires: section of a module, empty when it has none
+func requirements(module *ModuleConfig) Requirements {
+	if module.Metadata != nil && module.Metadata.Requires != nil {
+		return *module.Metadata.Requires
+	}
+	return Requirements{}
+}
+
+// checkTools checks everything but Python packages: the framework version, interpreters,
+// binaries and gems
+func (mm *ModuleManager) checkTools(module *ModuleConfig) []DependencyCheck {
+	req := requirements(module)
+
+	var checks []DependencyCheck
+	if req.LMV != "" {
+		checks = append(checks, checkVersion("framework", "lmv", req.LMV, Version, nil))
+	}
+
+	interpreters := req.Interpreters
+	implicit := ""
+	if module.Type == "go" {
+		implicit = "go"
+	} else if interpreter := mm.interpreterFor(module); len(interpreter) > 0 {
+		implicit = interpreter[0]
+	}
+	if implicit != "" && !declares(interpreters, implicit) {
+		interpreters = append([]string{implicit}, interpreters...)
+	}
+	for _, entry := range interpreters {
+		name, constraint := splitRequirement(entry)
+		version, err := mm.probe("interpreter "+name+" "+constraint, func() (string, error) {
+			if _, err := exec.LookPath(name); err != nil {
+				return "", fmt.Errorf("not found in PATH")
+			}
+			if constraint == "" {
+				return "", nil // not every interpreter has --version, e.g. dash
+			}
+			return commandVersion(name)
+		})
+		checks = append(checks, checkVersion("interpreter", name, constraint, version, err))
+	}
+
+	for _, entry := range req.Binaries {
+		name, constraint := splitRequirement(entry)
+		version, err := mm.probe("binary "+name+" "+constraint, func() (string, error) {
+			if _, err := exec.LookPath(name); err != nil {
+				return "", fmt.Errorf("not found in PATH")
+			}
+			if constraint == "" {
+				return "", nil // present is enough, don't run it
+			}
+			return commandVersion(name)
+		})
+		checks = append(checks, checkVersion("binary", name, constraint, version, err))
+	}
+
+	for _, entry := range req.Gems {
+		name, constraint := splitRequirement(entry)
+		version, err := mm.probe("gem "+name, func() (string, error) {
+			script := fmt.Sprintf("print Gem::Specification.find_by_name(%q).version", name)
+			return runProbe("ruby", "-e", script)
+		})
+		checks = append(checks, checkVersion("gem", name, constraint, version, err))
+	}
+
+	return checks
+}
+
+// checkPythonPackages checks requires.python where the module will import the packages
+// from: its virtualenv, if any
+func (mm *ModuleManager) checkPythonPackages(module *ModuleConfig) []DependencyCheck {
+	var checks []DependencyCheck
+	python := mm.pythonInterpreter(module)
+	for _, entry := range requirements(module).Python {
+		name, constraint := splitRequirement(entry)
+		version, err := mm.probe("python "+strings.Join(python, " ")+" "+name, func() (string, error) {
+			script := fmt.Sprintf("import importlib.metadata as m; print(m.version(%q))", name)
+			return runProbe(python[0], append(python[1:], "-c", script)...)
+		})
+		checks = append(checks, checkVersion("python", name, constraint, version, err))
+	}
+	return checks
+}
+
+// FailedDependencies returns the checks that did not pass
+func FailedDependencies(checks []DependencyCheck) []DependencyCheck {
+	var failed []DependencyCheck
+	for _, d := range checks {
+		if !d.OK {
+			failed = append(failed, d)
+		}
+	}
+	return failed
+}
+
+// probe runs fn once per key and caches its result
+func (mm *ModuleManager) probe(key string, fn func() (string, error)) (string, error) {
+	mm.probeMu.Lock()
+	defer mm.probeMu.Unlock()
+
+	if mm.probes == nil {
+		mm.probes = make(map[string]probeResult)
+	}
+	if r, ok := mm.probes[key]; ok {
+		return r.version, r.err
+	}
+	version, err := fn()
+	mm.probes[key] = probeResult{version: version, err: err}
+	return version, err
+}
+
+// commandVersion runs a command's version option and extracts the version number.
+// The command is on PATH, so a probe that fails or prints no version means the
+// version is unknown, not that the command is missing.
+func commandVersion(name string) (string, error) {
+	args := versionArgs[name]
+	if args == nil {
+		args = []string{"--version"}
+	}
+	out, _ := runProbe(name, args...)
+	if version := versionPattern.FindString(out); version != "" {
+		return version, nil
+	}
+	return "", fmt.Errorf("version unknown")
+}
+
+// runProbe runs a short command and returns its trimmed output
+func runProbe(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if _, lookErr := exec.LookPath(name); lookErr != nil {
+			return "", fmt.Errorf("%s not found in PATH", name)
+		}
+		return output, fmt.Errorf("not installed")
+	}
+	return output, nil
+}
+
+// checkVersion builds the check of a found version against a constraint
+func checkVersion(kind, name, constraint, found string, err error) DependencyCheck {
+	d := DependencyCheck{Kind: kind, Name: name, Constraint: constraint, Found: found}
+	switch {
+	case err != nil:
+		d.Problem = err.Error()
+	case constraint == "":
+		d.OK = true
+	case found == "":
+		d.Problem = "version unknown"
+	default:
+		ok, cerr := satisfies(found, constraint)
+		switch {
+		case cerr != nil:
+			d.Problem = cerr.Error()
+		case !ok:
+			d.Problem = fmt.Sprintf("found %s", found)
+		default:
+			d.OK = true
+		}
+	}
+	return d
+}
+
+// splitRequirement splits "requests>=2.28" into its name and constraint
+func splitRequirement(entry string) (name, constraint string) {
+	entry = strings.TrimSpace(entry)
+	if i := strings.IndexAny(entry, "<>=!"); i > 0 {
+		return strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i:])
+	}
+	return entry, ""
+}
+
+// declares reports whether the requirement list names name
+func declares(entries []string, name string) bool {
+	for _, entry := range entries {
+		if n, _ := splitRequirement(entry); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfies reports whether version meets every comma-separated clause of the
+// constraint. Clauses are >=, >, <=, <, ==, = or != followed by a version; a bare
+// version means at least that version.
+func satisfies(version, constraint string) (bool, error) {
+	for _, clause := range strings.Split(constraint, ",") {
+		clause = strings.TrimSpace(clause)
+		rest := strings.TrimLeft(clause, "<>=!")
+		op, want := clause[:len(clause)-len(rest)], strings.TrimSpace(rest)
+		if want == "" || want[0] < '0' || want[0] > '9' {
+			return false, fmt.Errorf("invalid constraint '%s'", constraint)
+		}
+
+		cmp := compareVersions(version, want)
+		var ok bool
+		switch op {
+		case ">=", "":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "==", "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("invalid constraint '%s'", constraint)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareVersions compares dotted versions numerically: 3.10 > 3.9, 2.0 == 2
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := versionPart(as, i), versionPart(bs, i)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionPart returns the numeric prefix of the i-th part of a version, 0 if absent
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := parts[i]
+	for j, c := range digits {
+		if c < '0' || c > '9' {
+			digits = digits[:j]
+			break
+		}
+	}
+	n, _ := strconv.Atoi(digits)
+	return n
+}
@@ -0,0 +1,77 @@
+package core
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"2", "2.0", 0},
+		{"2.0.0", "2", 0},
+		{"3.10", "3.9", 1},
+		{"3.9", "3.10", -1},
+		{"1.2.3", "1.2.4", -1},
+		{"5.2.15", "4", 1},
+		{"1.2rc1", "1.2", 0},
+		{"0.9", "1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		want                bool
+		wantErr             bool
+	}{
+		{"3.11.7", ">=3.8", true, false},
+		{"3.7", ">=3.8", false, false},
+		{"3.8", "3.8", true, false},
+		{"3.7", "3.8", false, false},
+		{"2.0", ">2", false, false},
+		{"2.0.1", ">2", true, false},
+		{"1.9", "<2", true, false},
+		{"2.0", "<=2", true, false},
+		{"2.0", "==2", true, false},
+		{"2.0", "=2.0.0", true, false},
+		{"2.1", "!=2.1", false, false},
+		{"3.11", ">=3.6,<4", true, false},
+		{"4.0", ">=3.6, <4", false, false},
+		{"1.0", ">=", false, true},
+		{"1.0", "=>1", false, true},
+		{"1.0", "~1", false, true},
+	}
+	for _, tt := range tests {
+		got, err := satisfies(tt.version, tt.constraint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("satisfies(%q, %q) error = %v, want error %v", tt.version, tt.constraint, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("satisfies(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRequirement(t *testing.T) {
+	tests := []struct {
+		entry, name, constraint string
+	}{
+		{"nmap", "nmap", ""},
+		{"python3>=3.8", "python3", ">=3.8"},
+		{" requests >=2.28,<3 ", "requests", ">=2.28,<3"},
+		{"bash==5", "bash", "==5"},
+	}
+	for _, tt := range tests {
+		name, constraint := splitRequirement(tt.entry)
+		if name != tt.name || constraint != tt.constraint {
+			t.Errorf("splitRequirement(%q) = %q, %q, want %q, %q", tt.entry, name, constraint, tt.name, tt.constraint)
+		}
+	}
+}
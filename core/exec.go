@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TerminateGracePeriod is how long a cancelled module gets between SIGTERM and SIGKILL
+var TerminateGracePeriod = 3 * time.Second
+
+// OutputDrainTimeout is how long to keep reading output after a module has exited
+var OutputDrainTimeout = time.Second
+
+// moduleEnv builds the child environment, exposing every argument as ARG_<NAME>
+func moduleEnv(args map[string]string) []string {
+	env := os.Environ()
+	for key, value := range args {
+		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	}
+	return env
+}
+
+// runModuleCommand starts cmd in its own process group and waits for it.
+// Output is streamed according to opts and captured into result.
+// When ctx is cancelled or times out, the whole group gets SIGTERM and,
+// after TerminateGracePeriod, SIGKILL. The outcome is recorded in result.
+func runModuleCommand(ctx context.Context, cmd *exec.Cmd, result *ExecutionResult, opts ExecOptions) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	capture := newOutputCapture(opts.OutputLimit)
+	cmd.Stdout, cmd.Stderr, cmd.Stdin = capture.streams(opts)
+	defer capture.fill(result)
+
+	// A module reading the terminal from its own process group would be stopped by
+	// SIGTTIN. An interactive one gets the terminal as the foreground group, back after,
+	// and Ctrl+C then reaches it directly as in a shell. Others read nothing, so lmv
+	// keeps the terminal and Ctrl+C escalates through INT, TERM and KILL.
+	var foreground bool
+	if _, isTerminal := terminalFd(cmd.Stdin); isTerminal {
+		if opts.Interactive {
+			var restore func()
+			restore, foreground = foregroundTerminal(cmd)
+			if foreground {
+				defer restore()
+			}
+		} else {
+			cmd.Stdin = nil // the null device
+		}
+	}
+
+	// Don't hang on background children that inherited the output pipes
+	cmd.WaitDelay = OutputDrainTimeout
+
+	// Structured results: fd 3 (first extra file) and a temp file, both announced via env
+	results, resultsErr := newResultCollector(opts.Progress)
+	if resultsErr == nil {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, results.env()...)
+		cmd.ExtraFiles = append([]*os.File{results.pipeW}, cmd.ExtraFiles...)
+	}
+
+	if len(opts.Wrapper) > 0 {
+		if err := wrapCommand(cmd, opts.Wrapper); err != nil {
+			if results != nil {
+				results.abort()
+			}
+			result.Success = false
+			result.ExitCode = 1
+			result.Error = err.Error()
+			return
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		if results != nil {
+			results.abort()
+		}
+		result.Success = false
+		result.ExitCode = 1
+		result.Error = err.Error()
+		return
+	}
+	if results != nil {
+		results.started()
+		defer results.finish(result, OutputDrainTimeout)
+	}
+
+	pid := cmd.Process.Pid
+	if opts.Started != nil {
+		opts.Started(pid)
+	}
+	if opts.Exited != nil {
+		defer opts.Exited(pid)
+	}
+
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			terminateProcessGroup(pid, done)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	<-watched // no part of the run outlives it
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Success = false
+		result.Cancelled = true
+		result.TimedOut = errors.Is(ctxErr, context.DeadlineExceeded)
+		result.ExitCode = exitCodeOf(err)
+		if result.TimedOut {
+			result.Error = "module timed out"
+		} else {
+			result.Error = "module execution cancelled"
+		}
+		return
+	}
+
+	if err != nil {
+		result.Success = false
+		result.ExitCode = exitCodeOf(err)
+		result.Error = err.Error()
+		// Ctrl+C went straight to the interactive module owning the terminal, lmv never saw it
+		result.Interrupted = foreground && result.ExitCode == 128+int(syscall.SIGINT)
+	} else {
+		result.Success = true
+		result.ExitCode = 0
+	}
+}
+
+// wrapCommand makes cmd run under a wrapper command such as sudo -E, proxychains4 -q or
+// timeout 60. The interpreter is given by its full path, as sudo may not search our PATH;
+// the environment, directory and streams of cmd are left untouched.
+func wrapCommand(cmd *exec.Cmd, wrapper []string) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	path, err := exec.LookPath(wrapper[0])
+	if err != nil {
+		return fmt.Errorf("wrapper '%s' not found: %v", wrapper[0], err)
+	}
+
+	args := append(append([]string{}, wrapper...), cmd.Path)
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = path
+	return nil
+}
+
+// terminalFd returns the descriptor of r when it is our controlling terminal
+func terminalFd(r io.Reader) (int, bool) {
+	f, ok := r.(*os.File)
+	if !ok || f == nil {
+		return 0, false
+	}
+	fd := int(f.Fd())
+	if _, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP); err != nil {
+		return 0, false
+	}
+	return fd, true
+}
+
+// foregroundTerminal makes cmd start as the foreground process group when its stdin
+// is our controlling terminal. It returns the function giving the terminal back.
+func foregroundTerminal(cmd *exec.Cmd) (func(), bool) {
+	fd, ok := terminalFd(cmd.Stdin)
+	if !ok {
+		return nil, false
+	}
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		return nil, false
+	}
+
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = fd
+	return func() {
+		// We are a background group until this succeeds, which would stop us with SIGTTOU
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, pgrp)
+	}, true
+}
+
+// terminateProcessGroup sends SIGTERM to the process group led by pid and
+// escalates to SIGKILL if the group leader has not exited after the grace period
+func terminateProcessGroup(pid int, done <-chan struct{}) {
+	syscall.Kill(-pid, syscall.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(TerminateGracePeriod):
+		syscall.Kill(-pid, syscall.SIGKILL)
+	}
+}
+
+// exitCodeOf extracts the exit code from a Wait error
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		// Killed by a signal: report it the way shells do
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+	}
+	return 1
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunModuleCommandKillsModuleTrappingSignals(t *testing.T) {
+	defer func(grace time.Duration) { TerminateGracePeriod = grace }(TerminateGracePeriod)
+	TerminateGracePeriod = 200 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan int, 1)
+	cmd := exec.Command("bash", "-c", "trap '' INT TERM; echo ready; while :; do sleep 0.1; done")
+
+	result := &ExecutionResult{}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		runModuleCommand(ctx, cmd, result, ExecOptions{Quiet: true, Started: func(pid int) { started <- pid }})
+	}()
+
+	<-started
+	time.Sleep(100 * time.Millisecond) // let bash install its traps
+	cancel()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("module ignoring SIGINT and SIGTERM was not killed")
+	}
+	if !result.Cancelled || result.Success {
+		t.Errorf("result = %+v, want a cancelled run", result)
+	}
+	if result.ExitCode != 137 {
+		t.Errorf("ExitCode = %d, want 137 (SIGKILL)", result.ExitCode)
+	}
+}
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"lanmanvan/sdk"
+)
+
+// sdkImport is the import path of the Go SDK
+const sdkImport = "lanmanvan/sdk"
+
+// goBuildLocks serializes the builds of each module, keyed by cache name, so
+// concurrent runs (threads=, background jobs) build it once
+var goBuildLocks sync.Map
+
+// goBuildCacheDir returns the directory holding compiled Go module binaries
+func goBuildCacheDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "gobuild")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "gobuild")
+}
+
+// goSourceFiles returns the buildable .go files of a module directory (tests excluded)
+func goSourceFiles(moduleDir string) []string {
+	entries, _ := os.ReadDir(moduleDir)
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// hashGoSources hashes the module sources together with go.mod and go.sum,
+// so any change to the code or its dependencies produces a new key
+func hashGoSources(moduleDir string, sources []string) (string, error) {
+	h := sha256.New()
+	files := append([]string{}, sources...)
+	for _, extra := range []string{"go.mod", "go.sum"} {
+		if _, err := os.Stat(filepath.Join(moduleDir, extra)); err == nil {
+			files = append(files, extra)
+		}
+	}
+
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(moduleDir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00", name)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The SDK is compiled in too, a new lmv version rebuilds the modules using it
+	if importsSDK(moduleDir, sources) {
+		fs.WalkDir(sdk.Source, ".", func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				data, _ := sdk.Source.ReadFile(path)
+				fmt.Fprintf(h, "sdk/%s\x00", path)
+				h.Write(data)
+			}
+			return nil
+		})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// importsSDK reports whether any of the module sources imports lanmanvan/sdk
+func importsSDK(moduleDir string, sources []string) bool {
+	for _, name := range sources {
+		data, err := os.ReadFile(filepath.Join(moduleDir, name))
+		if err == nil && bytes.Contains(data, []byte(`"`+sdkImport+`"`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SDKDir returns the directory holding the lanmanvan Go module with the sdk package,
+// the target of the replace directive of Go modules that have their own go.mod
+func SDKDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "sdk")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "sdk")
+}
+
+// writeSDK writes the sdk package of this lmv build under SDKDir, with a go.mod making
+// it the lanmanvan module. Unchanged files are left alone, others are replaced atomically.
+func writeSDK() error {
+	files := map[string][]byte{
+		"go.mod": []byte("module lanmanvan\n\ngo 1.18\n"),
+	}
+	err := fs.WalkDir(sdk.Source, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := sdk.Source.ReadFile(path)
+		files[filepath.Join("sdk", path)] = data
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, data := range files {
+		path := filepath.Join(SDKDir(), name)
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(path), ".sdk-*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(data)
+		tmp.Close()
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// sdkBuildDir prepares the directory a plain module importing the SDK is built in:
+// a copy of its sources with a go.mod requiring lanmanvan from SDKDir
+func sdkBuildDir(module *ModuleConfig, sources []string) (string, error) {
+	dir := filepath.Join(goBuildCacheDir(), goCacheName(module)+".src")
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	goMod := fmt.Sprintf("module lmvmodule\n\ngo 1.18\n\nrequire lanmanvan v0.0.0\n\nreplace lanmanvan => %s\n", SDKDir())
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		return "", err
+	}
+	for _, name := range sources {
+		data, err := os.ReadFile(filepath.Join(module.Path, name))
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// goBinaryPath returns the cache path of a Go module's binary for its current sources,
+// whether or not it has been built yet
+func goBinaryPath(module *ModuleConfig) (string, error) {
+	sources := goSourceFiles(module.Path)
+	if len(sources) == 0 {
+		return "", fmt.Errorf("no Go source found in module, expected .go file, e.g., main.go")
+	}
+
+	hash, err := hashGoSources(module.Path, sources)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash Go sources: %v", err)
+	}
+	return filepath.Join(goBuildCacheDir(), goCacheName(module)+"-"+hash), nil
+}
+
+// goCacheName is the binary name prefix of a module in the build cache
+func goCacheName(module *ModuleConfig) string {
+	return strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(module.Name)
+}
+
+// buildGoModule compiles a Go module on first run and caches the binary.
+// The binary is rebuilt only when the sources hash changes; stale builds of
+// the same module are removed. Build output is returned as the error message.
+func buildGoModule(ctx context.Context, module *ModuleConfig) (string, error) {
+	cacheName := goCacheName(module)
+	lock, _ := goBuildLocks.LoadOrStore(cacheName, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	binPath, err := goBinaryPath(module)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(binPath); err == nil && !info.IsDir() {
+		return binPath, nil
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", fmt.Errorf("go toolchain not found in PATH, required to build Go modules")
+	}
+
+	if err := os.MkdirAll(goBuildCacheDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create build cache: %v", err)
+	}
+
+	// A unique temp file per build; its name can't match the stale-binary glob below
+	tmp, err := os.CreateTemp(goBuildCacheDir(), cacheName+".build-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build cache: %v", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	// The SDK is always written out: modules with their own go.mod point their
+	// replace directive at it
+	if err := writeSDK(); err != nil {
+		return "", fmt.Errorf("failed to write the Go SDK to %s: %v", SDKDir(), err)
+	}
+
+	// Modules with their own go.mod build as a package, plain modules build from
+	// the file list so they don't need a go.mod at all - unless they import the
+	// SDK, then they build from a copy with a generated go.mod
+	sources := goSourceFiles(module.Path)
+	buildDir := module.Path
+	buildArgs := []string{"build", "-o", tmpPath}
+	if _, err := os.Stat(filepath.Join(module.Path, "go.mod")); err == nil {
+		buildArgs = append(buildArgs, ".")
+	} else if importsSDK(module.Path, sources) {
+		if buildDir, err = sdkBuildDir(module, sources); err != nil {
+			return "", fmt.Errorf("failed to prepare the build of '%s': %v", module.Name, err)
+		}
+		defer os.RemoveAll(buildDir)
+		buildArgs = append(buildArgs, ".")
+	} else {
+		buildArgs = append(buildArgs, sources...)
+	}
+
+	cmd := exec.CommandContext(ctx, "go", buildArgs...)
+	cmd.Dir = buildDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go build failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		// Another lmv process may have cached the same build meanwhile
+		if info, statErr := os.Stat(binPath); statErr != nil || info.IsDir() {
+			return "", fmt.Errorf("failed to cache Go binary: %v", err)
+		}
+	}
+
+	// Drop binaries built from older sources
+	stale, _ := filepath.Glob(filepath.Join(goBuildCacheDir(), cacheName+"-"+strings.Repeat("?", 16)))
+	for _, path := range stale {
+		if path != binPath {
+			os.Remove(path)
+		}
+	}
+
+	return binPath, nil
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the global settings of ~/.lanmanvan/config.yaml
+type Config struct {
+	// Interpreters overrides the interpreter of a module type, e.g. python: pypy3
+	Interpreters map[string]string `yaml:"interpreters"`
+}
+
+// ConfigPath returns ~/.lanmanvan/config.yaml
+func ConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "config.yaml")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "config.yaml")
+}
+
+// LoadConfig reads the global config file; a missing file is an empty config
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(ConfigPath())
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ConfigPath(), err)
+	}
+	return config, nil
+}
+
+// interpreterFor returns the command line running a module's entrypoint: the module's
+// interpreter, the config file's for its type, or the default of its runtime. It is
+// empty for command, Go and native modules, which don't run under an interpreter.
+func (mm *ModuleManager) interpreterFor(module *ModuleConfig) []string {
+	interpreter := ""
+	if module.Metadata != nil {
+		interpreter = module.Metadata.Interpreter
+	}
+	if interpreter == "" && mm.Config != nil {
+		interpreter = mm.Config.Interpreters[module.Type]
+	}
+	if interpreter == "" {
+		// Only script runtimes have one, including Python through embedding
+		if rt, ok := LookupRuntime(module.Type).(interface{ defaultInterpreter() string }); ok {
+			interpreter = rt.defaultInterpreter()
+		}
+	}
+	return strings.Fields(interpreter)
+}
+
+// moduleEntrypoint returns the script or binary a module runs: entrypoint: from
+// module.yaml, relative to the module, or main<extension>
+func moduleEntrypoint(module *ModuleConfig, extension string) (string, error) {
+	entry := ""
+	if module.Metadata != nil {
+		entry = module.Metadata.Entrypoint
+	}
+
+	if entry == "" {
+		if module.Type == "command" {
+			return "", fmt.Errorf("command modules need an entrypoint: in module.yaml")
+		}
+		script := findMainScript(module.Path, extension)
+		if script == "" {
+			return "", fmt.Errorf("no main%s found in module, add it or set entrypoint: in module.yaml", extension)
+		}
+		return script, nil
+	}
+
+	path := entry
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(module.Path, entry)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	// A command module can also run a tool from PATH
+	if module.Type == "command" && !strings.ContainsRune(entry, filepath.Separator) {
+		if found, err := exec.LookPath(entry); err == nil {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("entrypoint '%s' not found in module", entry)
+}
+
+// moduleCommand returns the command line of a script or command module: interpreter,
+// interpreter_args, then the entrypoint
+func (mm *ModuleManager) moduleCommand(module *ModuleConfig, extension string) ([]string, error) {
+	entry, err := moduleEntrypoint(module, extension)
+	if err != nil {
+		return nil, err
+	}
+
+	argv := mm.interpreterFor(module)
+	if module.Type == "python" {
+		argv = mm.pythonInterpreter(module)
+	}
+	if module.Metadata != nil {
+		argv = append(argv, module.Metadata.InterpreterArgs...)
+	}
+	return append(argv, entry), nil
+}
@@ -1,11 +1,13 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -15,6 +17,12 @@ import (
 type ModuleManager struct {
 	ModulesDirs []string // Support multiple module directories
 	Modules     map[string]*ModuleConfig
+	OutputLimit int     // bytes of stdout/stderr kept per execution
+	Config      *Config // global settings, loaded by DiscoverModules
+
+	probeMu sync.Mutex
+	probes  map[string]probeResult // dependency versions, see CheckDependencies
+	venvMu  sync.Mutex             // serializes virtualenv builds, see EnsureVenv
 }
 
 // NewModuleManager creates a new module manager
@@ -22,12 +30,19 @@ func NewModuleManager(modulesDirs []string) *ModuleManager {
 	return &ModuleManager{
 		ModulesDirs: modulesDirs,
 		Modules:     make(map[string]*ModuleConfig),
+		OutputLimit: DefaultOutputLimit,
 	}
 }
 
 // DiscoverModules scans all module directories and loads module metadata
 // Supports both flat modules and nested namespaces (e.g., smtp/esmtp-enum)
 func (mm *ModuleManager) DiscoverModules() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	mm.Config = config
+
 	for _, dir := range mm.ModulesDirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create modules directory %s: %w", dir, err)
@@ -37,6 +52,7 @@ func (mm *ModuleManager) DiscoverModules() error {
 			return err
 		}
 	}
+	mm.loadNativeModules()
 	return nil
 }
 
@@ -79,21 +95,12 @@ func (mm *ModuleManager) isModuleDir(dir string) bool {
 		return true
 	}
 
-	// Check for known module files
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return false
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			name := entry.Name()
-			if strings.HasSuffix(name, ".py") || strings.HasSuffix(name, ".sh") || strings.HasSuffix(name, ".go") || strings.HasSuffix(name, ".rb") {
-				return true
-			}
+	// Check for the files of a known runtime
+	for _, rt := range Runtimes() {
+		if rt.Detect(dir) {
+			return true
 		}
 	}
-
 	return false
 }
 
@@ -125,22 +132,11 @@ func (mm *ModuleManager) loadModuleFromDir(moduleDir string, qualifiedName strin
 	mm.Modules[qualifiedName] = moduleConfig
 }
 
-// inferModuleType determines module type based on file extensions
+// inferModuleType determines the module type from the first runtime detecting its files
 func (mm *ModuleManager) inferModuleType(moduleDir string) string {
-	entries, _ := os.ReadDir(moduleDir)
-	for _, entry := range entries {
-		name := entry.Name()
-		if strings.HasSuffix(name, ".py") {
-			return "python"
-		}
-		if strings.HasSuffix(name, ".sh") {
-			return "bash"
-		}
-		if strings.HasSuffix(name, ".go") {
-			return "go"
-		}
-		if strings.HasSuffix(name, ".rb") {
-			return "ruby"
+	for _, rt := range Runtimes() {
+		if rt.Detect(moduleDir) {
+			return rt.Name()
 		}
 	}
 	return "unknown"
@@ -160,185 +156,122 @@ func (mm *ModuleManager) GetModule(name string) (*ModuleConfig, error) {
 
 // ExecuteModule runs a module with given arguments
 func (mm *ModuleManager) ExecuteModule(moduleName string, args map[string]string) (*ExecutionResult, error) {
+	return mm.ExecuteModuleContext(context.Background(), moduleName, args)
+}
+
+// ExecuteModuleContext runs a module with given arguments until it exits or ctx is done.
+// Cancelling ctx (or hitting its deadline) terminates the module's whole process group.
+func (mm *ModuleManager) ExecuteModuleContext(ctx context.Context, moduleName string, args map[string]string) (*ExecutionResult, error) {
+	return mm.ExecuteModuleWithOptions(ctx, moduleName, args, ExecOptions{})
+}
+
+// ExecuteModuleWithOptions runs a module like ExecuteModuleContext, with control over
+// where its output is streamed. Output is always captured into the result as well.
+// A module failing its Preflight is not started and the error is returned.
+func (mm *ModuleManager) ExecuteModuleWithOptions(ctx context.Context, moduleName string, args map[string]string, opts ExecOptions) (*ExecutionResult, error) {
 	module, err := mm.GetModule(moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	switch module.Type {
-	case "python":
-		return executePythonModule(module, args)
-	case "bash":
-		return executeBashModule(module, args)
-	case "go":
-		return executeGoModule(module, args)
-	case "ruby":
-		return executeRubyModule(module, args)
-	default:
-		return nil, fmt.Errorf("unsupported module type: %s, supported types are: python, bash, ruby", module.Type)
+	// Work on a copy so defaults and normalised values don't leak into the caller's map
+	validated := make(map[string]string, len(args))
+	for k, v := range args {
+		validated[k] = v
+	}
+	var log io.Writer
+	if !opts.Quiet {
+		log = opts.Stdout
+	}
+	if err := mm.Preflight(ctx, module, validated, opts.Dir, log); err != nil {
+		return nil, err
 	}
+	return mm.ExecutePrepared(ctx, module, validated, opts), nil
 }
 
-// executePythonModule runs a Python module with real-time output
-func executePythonModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
-	result := &ExecutionResult{
-		Timestamp: time.Now(),
+// Preflight gets a module ready to run, cheapest check first so a typo costs no build:
+// it validates args in place (see ValidateArguments, dir is the session directory),
+// checks the module's dependencies, then prepares its runtime. Build output such as
+// pip's goes to log, nil keeps it quiet. Invalid arguments are a *ValidationError and
+// unmet dependencies a *DependencyError.
+func (mm *ModuleManager) Preflight(ctx context.Context, module *ModuleConfig, args map[string]string, dir string, log io.Writer) error {
+	rt := LookupRuntime(module.Type)
+	if rt == nil {
+		return fmt.Errorf("unknown module type, set type: in module.yaml (python, bash, ruby, go, command, or any language with an interpreter:)")
 	}
-
-	// Find the main Python script
-	scriptPath := findMainScript(module.Path, ".py")
-	if scriptPath == "" {
-		result.Success = false
-		result.Error = "no Python script found in module, expected .py file, e.g., main.py or run.py"
-		result.ExitCode = 1
-		return result, nil
+	if err := ValidateArguments(module.Name, module.Metadata, args, dir); err != nil {
+		return err
 	}
 
-	// Build command
-	cmd := exec.Command("python3", scriptPath)
-	cmd.Dir = module.Path
-
-	// Set environment variables for arguments
-	env := os.Environ()
-	for key, value := range args {
-		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	// Python packages are looked up in the virtualenv, which Prepare may still have to build
+	venvPending := HasPythonRequirements(module) && !venvBuilt(module)
+	checks := mm.checkTools(module)
+	if !venvPending {
+		checks = append(checks, mm.checkPythonPackages(module)...)
+	}
+	if failed := FailedDependencies(checks); len(failed) > 0 {
+		return &DependencyError{Module: module.Name, Failed: failed}
 	}
-	cmd.Env = env
-
-	// Stream output in real-time
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	err := cmd.Run()
 
-	if err != nil {
-		result.Success = false
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = 1
+	if err := rt.Prepare(ctx, mm, module, log); err != nil {
+		return err
+	}
+	if venvPending {
+		if failed := FailedDependencies(mm.checkPythonPackages(module)); len(failed) > 0 {
+			return &DependencyError{Module: module.Name, Failed: failed}
 		}
-		result.Error = err.Error()
-	} else {
-		result.Success = true
-		result.ExitCode = 0
 	}
-
-	return result, nil
+	return nil
 }
 
-// executeBashModule runs a Bash script module with real-time output
-func executeBashModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
-	result := &ExecutionResult{
-		Timestamp: time.Now(),
-	}
-
-	scriptPath := findMainScript(module.Path, ".sh")
-	if scriptPath == "" {
-		result.Success = false
-		result.Error = "no Bash script found in module"
-		result.ExitCode = 1
-		return result, nil
+// ExecutePrepared runs a module that passed Preflight with the args it validated.
+// Nothing is checked or built again, so a run over many values prepares only once.
+func (mm *ModuleManager) ExecutePrepared(ctx context.Context, module *ModuleConfig, args map[string]string, opts ExecOptions) *ExecutionResult {
+	if opts.OutputLimit <= 0 {
+		opts.OutputLimit = mm.OutputLimit
 	}
-
-	cmd := exec.Command("bash", scriptPath)
-	cmd.Dir = module.Path
-
-	// Set environment variables
-	env := os.Environ()
-	for key, value := range args {
-		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	if module.Native != nil {
+		return executeNative(ctx, module, args, opts)
 	}
-	cmd.Env = env
-
-	// Stream output in real-time
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	err := cmd.Run()
 
+	cmd, err := LookupRuntime(module.Type).Command(mm, module, args)
 	if err != nil {
-		result.Success = false
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = 1
-		}
-		result.Error = err.Error()
-	} else {
-		result.Success = true
-		result.ExitCode = 0
+		return failedResult(err)
 	}
+	cmd.Dir = module.Path
 
-	return result, nil
-}
+	// Set environment variables for arguments
+	cmd.Env = moduleEnv(args)
+	opts.Interactive = module.Metadata != nil && module.Metadata.Interactive
 
-// executeGoModule runs a Go module
-func executeGoModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
 	result := &ExecutionResult{
 		Timestamp: time.Now(),
-		Success:   false,
-		Error:     "Go module execution not yet implemented, please build and run manually, thanks!",
-		ExitCode:  1,
 	}
-	return result, nil
+	runModuleCommand(ctx, cmd, result, opts)
+	return result
 }
 
-// executeRubyModule runs a Ruby module with real-time output
-func executeRubyModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
-	result := &ExecutionResult{
+// failedResult is the result of a module that could not be started
+func failedResult(err error) *ExecutionResult {
+	return &ExecutionResult{
 		Timestamp: time.Now(),
+		Success:   false,
+		Error:     err.Error(),
+		ExitCode:  1,
 	}
-
-	scriptPath := findMainScript(module.Path, ".rb")
-	if scriptPath == "" {
-		result.Success = false
-		result.Error = "no Ruby script found in module, expected .rb file, e.g., main.rb or run.rb"
-		result.ExitCode = 1
-		return result, nil
-	}
-
-	cmd := exec.Command("ruby", scriptPath)
-	cmd.Dir = module.Path
-
-	// Set environment variables
-	env := os.Environ()
-	for key, value := range args {
-		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
-	}
-	cmd.Env = env
-
-	// Stream output in real-time
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	err := cmd.Run()
-
-	if err != nil {
-		result.Success = false
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = 1
-		}
-		result.Error = err.Error()
-	} else {
-		result.Success = true
-		result.ExitCode = 0
-	}
-
-	return result, nil
 }
 
-// findMainScript finds the main script in a module directory
+// findMainScript finds the main script in a module directory. Without an extension
+// any main or main.* file will do.
 func findMainScript(moduleDir string, extension string) string {
 	entries, _ := os.ReadDir(moduleDir)
 	for _, entry := range entries {
-		if !entry.IsDir() && entry.Name() == "main"+extension {
-			return filepath.Join(moduleDir, entry.Name())
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if name == "main"+extension || (extension == "" && strings.TrimSuffix(name, filepath.Ext(name)) == "main") {
+			return filepath.Join(moduleDir, name)
 		}
 	}
 	return ""
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+)
+
+// countingRuntime counts the modules it prepares
+type countingRuntime struct {
+	ScriptRuntime
+	prepared int
+}
+
+// Prepare implements Runtime
+func (r *countingRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	r.prepared++
+	return nil
+}
+
+// Command implements Runtime
+func (r *countingRuntime) Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error) {
+	return exec.Command("sh", "-c", `echo "$ARG_PORT"`), nil
+}
+
+func TestPreflightPreparesLast(t *testing.T) {
+	rt := &countingRuntime{ScriptRuntime: ScriptRuntime{Type: "counting"}}
+	RegisterRuntime(rt)
+
+	mm := NewModuleManager(nil)
+	module := func(binaries ...string) *ModuleConfig {
+		return &ModuleConfig{Name: "m", Type: "counting", Loaded: true, Metadata: &ModuleMetadata{
+			Interpreter: "sh",
+			Options:     map[string]OptionMeta{"port": {Type: "port", Required: true}},
+			Requires:    &Requirements{Binaries: binaries},
+		}}
+	}
+
+	var verr *ValidationError
+	if err := mm.Preflight(context.Background(), module(), map[string]string{"port": "http"}, "", nil); !errors.As(err, &verr) {
+		t.Fatalf("Preflight with an invalid port = %v, want a *ValidationError", err)
+	}
+	var derr *DependencyError
+	if err := mm.Preflight(context.Background(), module("lmv-no-such-binary"), map[string]string{"port": "80"}, "", nil); !errors.As(err, &derr) {
+		t.Fatalf("Preflight with a missing binary = %v, want a *DependencyError", err)
+	}
+	if rt.prepared != 0 {
+		t.Fatalf("failed preflights prepared the module %d time(s)", rt.prepared)
+	}
+
+	m := module()
+	args := map[string]string{"port": " 80"}
+	if err := mm.Preflight(context.Background(), m, args, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if rt.prepared != 1 || args["port"] != "80" {
+		t.Fatalf("prepared %d time(s) with port %q, want once with \"80\"", rt.prepared, args["port"])
+	}
+
+	// Running what passed preflight neither validates nor prepares again
+	for i := 0; i < 3; i++ {
+		result := mm.ExecutePrepared(context.Background(), m, args, ExecOptions{Quiet: true})
+		if !result.Success || result.Output != "80\n" {
+			t.Fatalf("ExecutePrepared = %+v", result)
+		}
+	}
+	if rt.prepared != 1 {
+		t.Errorf("prepared %d time(s) over 3 runs, want once", rt.prepared)
+	}
+}
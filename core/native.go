@@ -0,0 +1,309 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"lanmanvan/sdk"
+)
+
+// nativeRuntime is the runtime of the modules registered with sdk.Register. They run
+// in-process through executeNative, so there is nothing to detect, build or exec.
+type nativeRuntime struct{}
+
+// Name implements Runtime
+func (nativeRuntime) Name() string {
+	return "native"
+}
+
+// Detect implements Runtime, native modules are registered, not found in directories
+func (nativeRuntime) Detect(dir string) bool {
+	return false
+}
+
+// Prepare implements Runtime
+func (nativeRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	return nil
+}
+
+// Command implements Runtime, native modules have no process
+func (nativeRuntime) Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("native module '%s' runs in-process", module.Name)
+}
+
+// Badge implements Runtime
+func (nativeRuntime) Badge() (string, string) {
+	return "NATIVE", "green"
+}
+
+// Template implements Runtime, native modules are Go code compiled into lmv
+func (nativeRuntime) Template(moduleName string) (string, string) {
+	return "", ""
+}
+
+// loadNativeModules adds the modules registered with sdk.Register. A directory module
+// of the same name takes precedence, so a native module can be overridden locally.
+func (mm *ModuleManager) loadNativeModules() {
+	for _, m := range sdk.Modules() {
+		meta := nativeMetadata(m.Metadata())
+		if _, exists := mm.Modules[meta.Name]; exists {
+			continue
+		}
+		mm.Modules[meta.Name] = &ModuleConfig{
+			Name:     meta.Name,
+			Type:     meta.Type,
+			Metadata: meta,
+			Native:   m,
+			Loaded:   true,
+		}
+	}
+}
+
+// nativeMetadata converts the metadata of a native module to its module.yaml form
+func nativeMetadata(m sdk.Metadata) *ModuleMetadata {
+	meta := &ModuleMetadata{
+		Name:        m.Name,
+		Description: m.Description,
+		Type:        "native",
+		Author:      m.Author,
+		Version:     m.Version,
+		Tags:        m.Tags,
+		Required:    m.Required,
+	}
+	if len(m.Options) > 0 {
+		meta.Options = make(map[string]OptionMeta, len(m.Options))
+		for name, opt := range m.Options {
+			meta.Options[name] = OptionMeta{
+				Type:        opt.Type,
+				Description: opt.Description,
+				Default:     opt.Default,
+				Required:    opt.Required,
+				Choices:     opt.Choices,
+				Pattern:     opt.Pattern,
+				Min:         opt.Min,
+				Max:         opt.Max,
+			}
+		}
+	}
+	return meta
+}
+
+// executeNative runs a native module in-process with captured output and any input
+// but the terminal. When ctx is done the module gets TerminateGracePeriod to return,
+// then the run is abandoned.
+func executeNative(ctx context.Context, module *ModuleConfig, args map[string]string, opts ExecOptions) *ExecutionResult {
+	result := &ExecutionResult{
+		Timestamp: time.Now(),
+	}
+
+	if len(opts.Wrapper) > 0 {
+		result.Success = false
+		result.ExitCode = 1
+		result.Error = fmt.Sprintf("native module '%s' runs in-process and can't run under %s, use wrap=none",
+			module.Name, strings.Join(opts.Wrapper, " "))
+		return result
+	}
+
+	capture := newOutputCapture(opts.OutputLimit)
+	stdout, stderr, stdin := capture.streams(opts)
+	// The terminal is never read: a module reading it would take keystrokes from the
+	// REPL, and keep doing so if it is abandoned. Piped and file input is.
+	if _, isTerminal := terminalFd(stdin); stdin == nil || isTerminal {
+		stdin = strings.NewReader("")
+	}
+	// Once the run is over the module's goroutine may still be going, its writes
+	// and records must not reach streams and results that have moved on
+	gate := &runGate{}
+	reporter := &nativeReporter{
+		stdin:  gate.reader(stdin),
+		stdout: gate.writer(stdout),
+		stderr: gate.writer(stderr),
+		gate:   gate,
+		results: &resultCollector{
+			outputs: make(map[string]string),
+			onProg:  opts.Progress,
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("module panicked: %v", r)
+			}
+		}()
+		done <- module.Native.Run(ctx, sdk.Args(args), reporter)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		select {
+		case err = <-done:
+		case <-time.After(TerminateGracePeriod):
+			err = fmt.Errorf("module did not return within %s of being cancelled", TerminateGracePeriod)
+		}
+	}
+
+	gate.close()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Success = false
+		result.Cancelled = true
+		result.TimedOut = errors.Is(ctxErr, context.DeadlineExceeded)
+		result.ExitCode = 1
+		if result.TimedOut {
+			result.Error = "module timed out"
+		} else {
+			result.Error = "module execution cancelled"
+		}
+	} else if err != nil {
+		result.Success = false
+		result.ExitCode = 1
+	} else {
+		result.Success = true
+	}
+
+	capture.fill(result)
+	reporter.results.fill(result)
+	// The returned error says more than the generic message a process exit gives
+	if err != nil && !result.Cancelled {
+		if result.Error != "" {
+			result.Error += "\n"
+		}
+		result.Error += err.Error()
+	}
+	return result
+}
+
+// nativeReporter is the sdk.Reporter of a native run, its records go through the same
+// collector as the records of directory modules
+type nativeReporter struct {
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	gate    *runGate
+	results *resultCollector
+}
+
+// Stdin implements sdk.Reporter
+func (r *nativeReporter) Stdin() io.Reader {
+	return r.stdin
+}
+
+// Stdout implements sdk.Reporter
+func (r *nativeReporter) Stdout() io.Writer {
+	return r.stdout
+}
+
+// Stderr implements sdk.Reporter
+func (r *nativeReporter) Stderr() io.Writer {
+	return r.stderr
+}
+
+// Finding implements sdk.Reporter
+func (r *nativeReporter) Finding(fields sdk.F) {
+	r.emit("finding", fields)
+}
+
+// Artifact implements sdk.Reporter
+func (r *nativeReporter) Artifact(path, description string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	r.emit("artifact", sdk.F{"path": path, "description": description})
+}
+
+// Progress implements sdk.Reporter
+func (r *nativeReporter) Progress(pct int, message string) {
+	r.emit("progress", sdk.F{"pct": pct, "message": message})
+}
+
+// Output implements sdk.Reporter
+func (r *nativeReporter) Output(key, value string) {
+	r.emit("output", sdk.F{"key": key, "value": value})
+}
+
+// emit hands a record to the collector as the JSON line a process would have written
+func (r *nativeReporter) emit(recordType string, fields sdk.F) {
+	record := make(sdk.F, len(fields)+1)
+	for k, v := range fields {
+		record[k] = v
+	}
+	record["type"] = recordType
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	r.gate.mu.RLock()
+	defer r.gate.mu.RUnlock()
+	if !r.gate.closed {
+		r.results.handleLine(line)
+	}
+}
+
+// runGate cuts a native module off from its streams and collector when its run is over
+type runGate struct {
+	mu     sync.RWMutex
+	closed bool
+}
+
+// close waits for writes in progress and turns the gated streams into no-ops
+func (g *runGate) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// writer returns w behind the gate, writes after close are dropped
+func (g *runGate) writer(w io.Writer) io.Writer {
+	return &gatedWriter{gate: g, w: w}
+}
+
+// reader returns r behind the gate, reads after close see the end of the input
+func (g *runGate) reader(r io.Reader) io.Reader {
+	return &gatedReader{gate: g, r: r}
+}
+
+// gatedWriter is a writer behind a runGate
+type gatedWriter struct {
+	gate *runGate
+	w    io.Writer
+}
+
+// Write implements io.Writer
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.gate.mu.RLock()
+	defer w.gate.mu.RUnlock()
+	if w.gate.closed {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// gatedReader is a reader behind a runGate. A read blocked on a pipe isn't waited
+// for by close, it only keeps the module from reading on.
+type gatedReader struct {
+	gate *runGate
+	r    io.Reader
+}
+
+// Read implements io.Reader
+func (r *gatedReader) Read(p []byte) (int, error) {
+	r.gate.mu.RLock()
+	closed := r.gate.closed
+	r.gate.mu.RUnlock()
+	if closed {
+		return 0, io.EOF
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"lanmanvan/sdk"
+)
+
+// testNative is a native module running fn
+type testNative struct {
+	fn func(ctx context.Context, r sdk.Reporter) error
+}
+
+func (m testNative) Metadata() sdk.Metadata { return sdk.Metadata{Name: "test"} }
+
+func (m testNative) Run(ctx context.Context, args sdk.Args, r sdk.Reporter) error {
+	return m.fn(ctx, r)
+}
+
+// syncBuffer is a bytes.Buffer safe for the writes of an abandoned module
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestExecuteNativeAbandoned(t *testing.T) {
+	defer func(grace time.Duration) { TerminateGracePeriod = grace }(TerminateGracePeriod)
+	TerminateGracePeriod = 50 * time.Millisecond
+
+	// The module ignores cancellation and keeps writing after its run is abandoned
+	stopped := make(chan struct{})
+	defer close(stopped)
+	module := &ModuleConfig{Name: "test", Native: testNative{fn: func(ctx context.Context, r sdk.Reporter) error {
+		for {
+			select {
+			case <-stopped:
+				return nil
+			case <-time.After(5 * time.Millisecond):
+			}
+			io.WriteString(r.Stdout(), "line\n")
+			r.Output("n", "x")
+		}
+	}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var live syncBuffer
+	result := executeNative(ctx, module, nil, ExecOptions{Stdout: &live})
+	if !result.TimedOut {
+		t.Errorf("result = %+v, want a timed out run", result)
+	}
+
+	seen := live.String()
+	time.Sleep(50 * time.Millisecond)
+	if got := live.String(); got != seen {
+		t.Errorf("abandoned module wrote %q to the live stream after its run", got[len(seen):])
+	}
+}
+
+func TestExecuteNativeStdin(t *testing.T) {
+	read := testNative{fn: func(ctx context.Context, r sdk.Reporter) error {
+		data, err := io.ReadAll(r.Stdin())
+		r.Stdout().Write(data)
+		return err
+	}}
+	module := &ModuleConfig{Name: "test", Native: read}
+
+	// A file or pipe given as stdin is read, unlike the terminal
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("from a file\n")
+	f.Seek(0, io.SeekStart)
+	defer f.Close()
+
+	result := executeNative(context.Background(), module, nil, ExecOptions{Quiet: true, Stdin: f})
+	if !result.Success || result.Output != "from a file\n" {
+		t.Errorf("result = %+v, want the file read", result)
+	}
+}
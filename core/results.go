@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Structured results protocol
+//
+// A module may report machine-readable results by writing JSON lines, one
+// record per line, either to the file descriptor named in LMV_RESULT_FD or
+// to the file named in LMV_RESULT_FILE. Every record carries a "type":
+//
+//	{"type":"finding","host":"10.0.0.5","port":22,"service":"ssh","severity":"info"}
+//	{"type":"artifact","path":"/tmp/scan.xml","description":"raw nmap output"}
+//	{"type":"progress","pct":40,"message":"scanning 10.0.0.0/24"}
+//	{"type":"output","key":"os","value":"Linux 5.x"}
+//
+// Unknown types and malformed lines are ignored.
+
+const (
+	// ResultFDEnv names the env var holding the result file descriptor number
+	ResultFDEnv = "LMV_RESULT_FD"
+	// ResultFileEnv names the env var holding the result file path
+	ResultFileEnv = "LMV_RESULT_FILE"
+
+	// resultFD is the descriptor number the result pipe gets in the child (first ExtraFiles entry)
+	resultFD = 3
+	// maxResultLine bounds a single JSON record
+	maxResultLine = 1 << 20
+)
+
+// resultCollector gathers structured records from a module run
+type resultCollector struct {
+	mu        sync.Mutex
+	findings  []Finding
+	artifacts []Artifact
+	progress  int
+	outputs   map[string]string
+	onProg    func(pct int, message string)
+
+	pipeR *os.File
+	pipeW *os.File
+	file  string
+	done  chan struct{}
+}
+
+// newResultCollector prepares the result pipe and file for a command about to start
+func newResultCollector(onProgress func(pct int, message string)) (*resultCollector, error) {
+	rc := &resultCollector{
+		outputs: make(map[string]string),
+		onProg:  onProgress,
+		done:    make(chan struct{}),
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	rc.pipeR, rc.pipeW = r, w
+
+	f, err := os.CreateTemp("", "lmv-result-*.jsonl")
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	rc.file = f.Name()
+	f.Close()
+
+	return rc, nil
+}
+
+// env returns the variables telling the module where to write records
+func (rc *resultCollector) env() []string {
+	return []string{
+		fmt.Sprintf("%s=%d", ResultFDEnv, resultFD),
+		fmt.Sprintf("%s=%s", ResultFileEnv, rc.file),
+	}
+}
+
+// started closes the parent's copy of the write end and begins reading the pipe
+func (rc *resultCollector) started() {
+	rc.pipeW.Close()
+	go func() {
+		defer close(rc.done)
+		rc.read(rc.pipeR)
+	}()
+}
+
+// abort releases everything when the command never started
+func (rc *resultCollector) abort() {
+	rc.pipeW.Close()
+	rc.pipeR.Close()
+	os.Remove(rc.file)
+}
+
+// finish waits up to drainTimeout for the pipe to drain, reads the result file and fills result
+func (rc *resultCollector) finish(result *ExecutionResult, drainTimeout time.Duration) {
+	select {
+	case <-rc.done:
+	case <-time.After(drainTimeout):
+		// A background child still holds the pipe, stop waiting for it
+	}
+	rc.pipeR.Close()
+
+	if f, err := os.Open(rc.file); err == nil {
+		rc.read(f)
+		f.Close()
+	}
+	os.Remove(rc.file)
+	rc.fill(result)
+}
+
+// fill copies the collected records into result
+func (rc *resultCollector) fill(result *ExecutionResult) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	result.Findings = rc.findings
+	result.Artifacts = rc.artifacts
+	result.Progress = rc.progress
+	if len(rc.outputs) > 0 {
+		result.Outputs = rc.outputs
+	}
+}
+
+// read parses JSON lines from r until EOF
+func (rc *resultCollector) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxResultLine)
+	for scanner.Scan() {
+		rc.handleLine(scanner.Bytes())
+	}
+}
+
+// handleLine decodes a single record and stores it
+func (rc *resultCollector) handleLine(line []byte) {
+	line = []byte(strings.TrimSpace(string(line)))
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return
+	}
+
+	recordType, _ := record["type"].(string)
+	delete(record, "type")
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	switch recordType {
+	case "finding":
+		rc.findings = append(rc.findings, parseFinding(record))
+	case "artifact":
+		rc.artifacts = append(rc.artifacts, Artifact{
+			Path:        stringField(record, "path"),
+			Name:        stringField(record, "name"),
+			Description: stringField(record, "description"),
+		})
+	case "progress":
+		pct := intField(record, "pct")
+		if pct < 0 {
+			pct = 0
+		} else if pct > 100 {
+			pct = 100
+		}
+		rc.progress = pct
+		if rc.onProg != nil {
+			rc.onProg(pct, stringField(record, "message"))
+		}
+	case "output":
+		if key := stringField(record, "key"); key != "" {
+			rc.outputs[key] = stringField(record, "value")
+		}
+	}
+}
+
+// parseFinding maps the well-known finding fields and keeps the rest in Data
+func parseFinding(record map[string]interface{}) Finding {
+	f := Finding{
+		Host:     stringField(record, "host"),
+		Port:     intField(record, "port"),
+		Protocol: stringField(record, "protocol"),
+		Service:  stringField(record, "service"),
+		Title:    stringField(record, "title"),
+		Severity: stringField(record, "severity"),
+		Detail:   stringField(record, "detail"),
+	}
+	for _, known := range []string{"host", "port", "protocol", "service", "title", "severity", "detail"} {
+		delete(record, known)
+	}
+	if len(record) > 0 {
+		f.Data = record
+	}
+	return f
+}
+
+// stringField returns a record field as a string
+func stringField(record map[string]interface{}, key string) string {
+	switch v := record[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		if v == float64(int64(v)) {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprintf("%v", v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// intField returns a numeric record field, accepting numbers and numeric strings
+func intField(record map[string]interface{}, key string) int {
+	switch v := record[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		var n int
+		fmt.Sscanf(v, "%d", &n)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResultCollectorHandleLine(t *testing.T) {
+	type progressCall struct {
+		pct     int
+		message string
+	}
+
+	tests := []struct {
+		name         string
+		lines        []string
+		wantFindings []Finding
+		wantArts     []Artifact
+		wantProgress int
+		wantCalls    []progressCall
+		wantOutputs  map[string]string
+	}{
+		{
+			name:  "finding with extra fields",
+			lines: []string{`{"type":"finding","host":"10.0.0.5","port":22,"service":"ssh","severity":"info","banner":"OpenSSH"}`},
+			wantFindings: []Finding{{
+				Host: "10.0.0.5", Port: 22, Service: "ssh", Severity: "info",
+				Data: map[string]interface{}{"banner": "OpenSSH"},
+			}},
+		},
+		{
+			name:         "port as a string",
+			lines:        []string{`{"type":"finding","host":"h","port":"8080"}`},
+			wantFindings: []Finding{{Host: "h", Port: 8080}},
+		},
+		{
+			name:     "artifact",
+			lines:    []string{`  {"type":"artifact","path":"/tmp/scan.xml","description":"raw output"}  `},
+			wantArts: []Artifact{{Path: "/tmp/scan.xml", Description: "raw output"}},
+		},
+		{
+			name:         "progress is clamped",
+			lines:        []string{`{"type":"progress","pct":40,"message":"half"}`, `{"type":"progress","pct":150}`, `{"type":"progress","pct":-3}`},
+			wantProgress: 0,
+			wantCalls:    []progressCall{{40, "half"}, {100, ""}, {0, ""}},
+		},
+		{
+			name:        "outputs, numbers as strings, last wins",
+			lines:       []string{`{"type":"output","key":"os","value":"Linux"}`, `{"type":"output","key":"ttl","value":64}`, `{"type":"output","key":"os","value":"BSD"}`, `{"type":"output","value":"no key"}`},
+			wantOutputs: map[string]string{"os": "BSD", "ttl": "64"},
+		},
+		{
+			name:  "ignored lines",
+			lines: []string{"", "plain output", `{"type":"finding"`, `["type","finding"]`, `{"type":"unknown","host":"h"}`, `{"host":"no type"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []progressCall
+			rc := &resultCollector{
+				outputs: make(map[string]string),
+				onProg: func(pct int, message string) {
+					calls = append(calls, progressCall{pct, message})
+				},
+			}
+			for _, line := range tt.lines {
+				rc.handleLine([]byte(line))
+			}
+
+			result := &ExecutionResult{}
+			rc.fill(result)
+			if !reflect.DeepEqual(result.Findings, tt.wantFindings) {
+				t.Errorf("findings = %#v, want %#v", result.Findings, tt.wantFindings)
+			}
+			if !reflect.DeepEqual(result.Artifacts, tt.wantArts) {
+				t.Errorf("artifacts = %#v, want %#v", result.Artifacts, tt.wantArts)
+			}
+			if result.Progress != tt.wantProgress {
+				t.Errorf("progress = %d, want %d", result.Progress, tt.wantProgress)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("progress calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(result.Outputs, tt.wantOutputs) {
+				t.Errorf("outputs = %v, want %v", result.Outputs, tt.wantOutputs)
+			}
+		})
+	}
+}
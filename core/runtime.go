@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Runtime runs the modules of one type. Built-in runtimes cover Python, Bash, Ruby,
+// Go and a few more interpreted languages; RegisterRuntime adds others.
+type Runtime interface {
+	// Name is the module type it runs, as in type: of module.yaml
+	Name() string
+	// Detect reports whether a directory without a type: holds a module of this runtime
+	Detect(dir string) bool
+	// Prepare gets a module ready to run, e.g. builds it. It runs once before a run and
+	// should be cheap when there is nothing to do. Build output goes to log, if not nil.
+	Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error
+	// Command returns the process running the module, without its environment
+	Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error)
+	// Badge is the short label and core.Color color shown next to module names, e.g. "PY", "blue"
+	Badge() (label, color string)
+	// Template returns the main file of a new module created with 'create', or "" when
+	// the runtime has no template
+	Template(moduleName string) (file, content string)
+}
+
+var (
+	runtimesMu sync.RWMutex
+	runtimes   []Runtime // in registration order, which is the order Detect is tried in
+)
+
+// RegisterRuntime adds a runtime, replacing any registered for the same type
+func RegisterRuntime(rt Runtime) {
+	runtimesMu.Lock()
+	defer runtimesMu.Unlock()
+
+	for i, existing := range runtimes {
+		if existing.Name() == rt.Name() {
+			runtimes[i] = rt
+			return
+		}
+	}
+	runtimes = append(runtimes, rt)
+}
+
+// Runtimes returns the registered runtimes in registration order
+func Runtimes() []Runtime {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+	return append([]Runtime(nil), runtimes...)
+}
+
+// LookupRuntime returns the runtime of a module type. A type nothing registered for
+// runs as a script with the interpreter of the same name, nil for "" and unknown.
+func LookupRuntime(moduleType string) Runtime {
+	if moduleType == "" || moduleType == "unknown" {
+		return nil
+	}
+	for _, rt := range Runtimes() {
+		if rt.Name() == moduleType {
+			return rt
+		}
+	}
+	return &ScriptRuntime{Type: moduleType, BadgeLabel: strings.ToUpper(moduleType), BadgeColor: "white"}
+}
+
+// ScriptRuntime runs main<Extension> with an interpreter, the common case for
+// interpreted languages:
+//
+//	core.RegisterRuntime(&core.ScriptRuntime{Type: "elixir", Extension: ".exs", Interpreter: "elixir"})
+type ScriptRuntime struct {
+	Type        string
+	Extension   string // of the entrypoint, e.g. ".py"
+	Interpreter string // default command line, the type name when empty
+	// DetectAny makes any file with the extension mark a module directory, not just main<Extension>
+	DetectAny  bool
+	BadgeLabel string
+	BadgeColor string
+	// NewTemplate returns the main script of a new module, nil when there is none
+	NewTemplate func(moduleName string) string
+}
+
+// Name implements Runtime
+func (r *ScriptRuntime) Name() string {
+	return r.Type
+}
+
+// Detect implements Runtime
+func (r *ScriptRuntime) Detect(dir string) bool {
+	if r.Extension == "" {
+		return false
+	}
+	if !r.DetectAny {
+		info, err := os.Stat(filepath.Join(dir, "main"+r.Extension))
+		return err == nil && !info.IsDir()
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), r.Extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepare implements Runtime, scripts need no preparation
+func (r *ScriptRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	return nil
+}
+
+// Command implements Runtime: interpreter, interpreter_args, then the entrypoint
+func (r *ScriptRuntime) Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error) {
+	argv, err := mm.moduleCommand(module, r.Extension)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(argv[0], argv[1:]...), nil
+}
+
+// defaultInterpreter is the interpreter of the type unless configured otherwise
+func (r *ScriptRuntime) defaultInterpreter() string {
+	if r.Interpreter != "" {
+		return r.Interpreter
+	}
+	return r.Type
+}
+
+// Badge implements Runtime
+func (r *ScriptRuntime) Badge() (string, string) {
+	return r.BadgeLabel, r.BadgeColor
+}
+
+// Template implements Runtime
+func (r *ScriptRuntime) Template(moduleName string) (string, string) {
+	if r.NewTemplate == nil {
+		return "", ""
+	}
+	return "main" + r.Extension, r.NewTemplate(moduleName)
+}
+
+// pythonRuntime is a script runtime whose modules with requirements get a virtualenv
+type pythonRuntime struct {
+	ScriptRuntime
+}
+
+// Prepare implements Runtime, building the virtualenv on first run
+func (r *pythonRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	if _, err := mm.EnsureVenv(ctx, module, log); err != nil {
+		return fmt.Errorf("failed to prepare the virtualenv of '%s': %v", module.Name, err)
+	}
+	return nil
+}
+
+// goRuntime builds Go modules on first run and runs the cached binary
+type goRuntime struct{}
+
+// Name implements Runtime
+func (goRuntime) Name() string {
+	return "go"
+}
+
+// Detect implements Runtime
+func (goRuntime) Detect(dir string) bool {
+	return len(goSourceFiles(dir)) > 0
+}
+
+// Prepare implements Runtime, building the module unless its sources are unchanged
+func (goRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	_, err := buildGoModule(ctx, module)
+	return err
+}
+
+// Command implements Runtime
+func (goRuntime) Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error) {
+	// Prepare built it, this only finds the cached binary
+	binPath, err := goBinaryPath(module)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		return nil, fmt.Errorf("Go module '%s' is not built", module.Name)
+	}
+	return exec.Command(binPath), nil
+}
+
+// Badge implements Runtime
+func (goRuntime) Badge() (string, string) {
+	return "GO", "magenta"
+}
+
+// Template implements Runtime
+func (goRuntime) Template(moduleName string) (string, string) {
+	return "main.go", `package main
+
+// Module: ` + moduleName + `
+// Description: Your module description
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	target := os.Getenv("ARG_TARGET")
+	if target == "" {
+		target = "localhost"
+	}
+
+	fmt.Printf("[*] Module executing on %s\n", target)
+
+	// Your code here
+
+	fmt.Println("[+] Module completed successfully!")
+}
+`
+}
+
+// commandRuntime runs a prebuilt binary, or a tool from PATH, given by entrypoint:
+type commandRuntime struct{}
+
+// Name implements Runtime
+func (commandRuntime) Name() string {
+	return "command"
+}
+
+// Detect implements Runtime, command modules always declare their type
+func (commandRuntime) Detect(dir string) bool {
+	return false
+}
+
+// Prepare implements Runtime
+func (commandRuntime) Prepare(ctx context.Context, mm *ModuleManager, module *ModuleConfig, log io.Writer) error {
+	return nil
+}
+
+// Command implements Runtime
+func (commandRuntime) Command(mm *ModuleManager, module *ModuleConfig, args map[string]string) (*exec.Cmd, error) {
+	argv, err := mm.moduleCommand(module, "")
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(argv[0], argv[1:]...), nil
+}
+
+// Badge implements Runtime
+func (commandRuntime) Badge() (string, string) {
+	return "CMD", "yellow"
+}
+
+// Template implements Runtime, there is nothing to scaffold for a prebuilt binary
+func (commandRuntime) Template(moduleName string) (string, string) {
+	return "", ""
+}
+
+func init() {
+	RegisterRuntime(&pythonRuntime{ScriptRuntime{
+		Type: "python", Extension: ".py", Interpreter: "python3", DetectAny: true,
+		BadgeLabel: "PY", BadgeColor: "blue", NewTemplate: pythonTemplate,
+	}})
+	RegisterRuntime(&ScriptRuntime{
+		Type: "bash", Extension: ".sh", DetectAny: true,
+		BadgeLabel: "SH", BadgeColor: "cyan", NewTemplate: bashTemplate,
+	})
+	RegisterRuntime(goRuntime{})
+	RegisterRuntime(&ScriptRuntime{
+		Type: "ruby", Extension: ".rb", DetectAny: true,
+		BadgeLabel: "RB", BadgeColor: "red", NewTemplate: rubyTemplate,
+	})
+	RegisterRuntime(&ScriptRuntime{Type: "perl", Extension: ".pl", BadgeLabel: "PERL", BadgeColor: "white"})
+	RegisterRuntime(&ScriptRuntime{Type: "node", Extension: ".js", BadgeLabel: "NODE", BadgeColor: "green"})
+	RegisterRuntime(&ScriptRuntime{Type: "php", Extension: ".php", BadgeLabel: "PHP", BadgeColor: "white"})
+	RegisterRuntime(&ScriptRuntime{Type: "lua", Extension: ".lua", BadgeLabel: "LUA", BadgeColor: "white"})
+	RegisterRuntime(commandRuntime{})
+	RegisterRuntime(nativeRuntime{})
+}
+
+// pythonTemplate is the main.py of a new Python module
+func pythonTemplate(moduleName string) string {
+	return `#!/usr/bin/env python3
+"""
+Module: ` + moduleName + `
+Description: Your module description
+"""
+
+import os
+import sys
+
+def main():
+    # Get arguments from environment variables
+    target = os.getenv('ARG_TARGET') or 'localhost'
+
+    print(f"[*] Module executing on {target}")
+
+    try:
+        # Your code here
+        print("[+] Module completed successfully!")
+    except Exception as e:
+        print(f"[!] Error: {e}")
+        sys.exit(1)
+
+if __name__ == '__main__':
+    main()
+`
+}
+
+// rubyTemplate is the main.rb of a new Ruby module
+func rubyTemplate(moduleName string) string {
+	return `#!/usr/bin/env ruby
+# Module: ` + moduleName + `
+# Description: Your module description
+
+target = ENV['ARG_TARGET'] || 'localhost'
+
+puts "[*] Module executing on #{target}"
+
+begin
+  # Your code here
+  puts "[+] Module completed successfully!"
+rescue => e
+  puts "[!] Error: #{e.message}"
+  exit 1
+end
+`
+}
+
+// bashTemplate is the main.sh of a new Bash module
+func bashTemplate(moduleName string) string {
+	return `#!/bin/bash
+# Module: ` + moduleName + `
+# Description: Your module description
+
+TARGET="${ARG_TARGET:-localhost}"
+
+echo "[*] Module executing on $TARGET"
+
+# Your code here
+
+echo "[+] Module completed successfully!"
+`
+}
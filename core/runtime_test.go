@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// templateTools are the tools the modules created from each template need
+var templateTools = map[string]string{
+	"python": "python3",
+	"bash":   "bash",
+	"go":     "go",
+	"ruby":   "ruby",
+}
+
+func TestTemplatesRun(t *testing.T) {
+	// Keep go's build cache, the Go template is built with the home directory moved
+	if out, err := exec.Command("go", "env", "GOCACHE").Output(); err == nil {
+		t.Setenv("GOCACHE", strings.TrimSpace(string(out)))
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, "modules")
+
+	for _, rt := range Runtimes() {
+		file, content := rt.Template("tmpl-" + rt.Name())
+		if file == "" {
+			continue
+		}
+		t.Run(rt.Name(), func(t *testing.T) {
+			tool, ok := templateTools[rt.Name()]
+			if !ok {
+				t.Fatalf("runtime %s has a template but no tool listed in templateTools", rt.Name())
+			}
+			if _, err := exec.LookPath(tool); err != nil {
+				t.Skipf("%s is not installed", tool)
+			}
+
+			name := "tmpl-" + rt.Name()
+			moduleDir := filepath.Join(dir, name)
+			if err := os.MkdirAll(moduleDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(moduleDir, "module.yaml"), []byte("name: "+name+"\ntype: "+rt.Name()+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(moduleDir, file), []byte(content), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			mm := NewModuleManager([]string{dir})
+			if err := mm.DiscoverModules(); err != nil {
+				t.Fatal(err)
+			}
+			result, err := mm.ExecuteModuleWithOptions(context.Background(), name, nil, ExecOptions{Quiet: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Success || !strings.Contains(result.Output, "Module completed successfully") {
+				t.Errorf("template run: success=%v output=%q error=%q", result.Success, result.Output, result.Error)
+			}
+		})
+	}
+}
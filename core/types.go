@@ -1,12 +1,16 @@
 package core
 
-import "time"
+import (
+	"time"
+
+	"lanmanvan/sdk"
+)
 
 // ModuleMetadata holds information about a module
 type ModuleMetadata struct {
 	Name        string                `yaml:"name"`
 	Description string                `yaml:"description"`
-	Type        string                `yaml:"type"` // python, bash, go
+	Type        string                `yaml:"type"` // python, bash, ruby, go, command, or any interpreted language
 	Author      string                `yaml:"author"`
 	Version     string                `yaml:"version"`
 	Options     map[string]OptionMeta `yaml:"options"`
@@ -14,14 +18,29 @@ type ModuleMetadata struct {
 	Tags        []string              `yaml:"tags"`
 	GitHubURL   string                `yaml:"github_url"`
 	XUrl        string                `yaml:"x_url"`
+	Requires    *Requirements         `yaml:"requires"`
+	Python      *PythonConfig         `yaml:"python"`
+
+	// How the module runs: interpreter interpreter_args... entrypoint
+	Entrypoint      string   `yaml:"entrypoint"`       // script or binary, relative to the module; main.<ext> by default
+	Interpreter     string   `yaml:"interpreter"`      // command line, e.g. pypy3 or /usr/bin/env -S bash -eu
+	InterpreterArgs []string `yaml:"interpreter_args"` // arguments between the interpreter and the entrypoint
+
+	// Interactive modules read the terminal: they run as its foreground process group
+	// and get Ctrl+C themselves, as in a shell. Others never see the terminal.
+	Interactive bool `yaml:"interactive"`
 }
 
 // OptionMeta describes a module option
 type OptionMeta struct {
-	Type        string `yaml:"type"` // string, int, bool, file
-	Description string `yaml:"description"`
-	Default     string `yaml:"default"`
-	Required    bool   `yaml:"required"`
+	Type        string   `yaml:"type"` // string, int, bool, file, ip, cidr, port, url, enum, regex, secret
+	Description string   `yaml:"description"`
+	Default     string   `yaml:"default"`
+	Required    bool     `yaml:"required"`
+	Choices     []string `yaml:"choices"` // allowed values for enum options
+	Pattern     string   `yaml:"pattern"` // regular expression a regex option must fully match
+	Min         *int     `yaml:"min"`     // lower bound for int and port options
+	Max         *int     `yaml:"max"`     // upper bound for int and port options
 }
 
 // ExecutionRequest represents a module execution request
@@ -33,11 +52,40 @@ type ExecutionRequest struct {
 
 // ExecutionResult represents module execution output
 type ExecutionResult struct {
-	Success   bool
-	Output    string
-	Error     string
-	ExitCode  int
-	Timestamp time.Time
+	Success         bool
+	Output          string // captured stdout
+	Error           string // captured stderr, or why the run failed
+	ExitCode        int
+	Timestamp       time.Time
+	Cancelled       bool // run was stopped before the module exited on its own
+	TimedOut        bool // run was stopped because its timeout expired
+	Interrupted     bool // run was stopped by the user with Ctrl+C
+	OutputTruncated bool // captured output hit the output limit
+
+	// Structured results reported through the LMV_RESULT_FD / LMV_RESULT_FILE protocol
+	Findings  []Finding
+	Artifacts []Artifact
+	Progress  int               // last reported progress percentage
+	Outputs   map[string]string // key/value outputs
+}
+
+// Finding is a structured result reported by a module, e.g. an open port or a vulnerability
+type Finding struct {
+	Host     string                 `json:"host,omitempty"`
+	Port     int                    `json:"port,omitempty"`
+	Protocol string                 `json:"protocol,omitempty"`
+	Service  string                 `json:"service,omitempty"`
+	Title    string                 `json:"title,omitempty"`
+	Severity string                 `json:"severity,omitempty"`
+	Detail   string                 `json:"detail,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"` // any other fields of the record
+}
+
+// Artifact is a file produced by a module
+type Artifact struct {
+	Path        string `json:"path"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 // ModuleConfig represents runtime configuration
@@ -48,4 +96,5 @@ type ModuleConfig struct {
 	Metadata  *ModuleMetadata
 	Loaded    bool
 	LoadError string
+	Native    sdk.Module // set for modules compiled into lmv, which have no Path
 }
@@ -2,6 +2,8 @@ package core
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"strings"
 
@@ -150,27 +152,52 @@ func NmapSubBox(title string) string {
 
 // PrintSuccess prints a success message
 func PrintSuccess(msg string) {
-	fmt.Printf("%s %s\n", color.GreenString("[+]"), msg)
+	FprintSuccess(os.Stdout, msg)
 }
 
 // PrintError prints an error message
 func PrintError(msg string) {
-	fmt.Printf("%s %s\n", color.RedString("[!]"), msg)
+	FprintError(os.Stdout, msg)
 }
 
 // PrintInfo prints an info message
 func PrintInfo(msg string) {
-	fmt.Printf("%s %s\n", color.YellowString("[*]"), msg)
+	FprintInfo(os.Stdout, msg)
 }
 
 // PrintDebug prints a debug message
 func PrintDebug(msg string) {
-	fmt.Printf("%s %s\n", color.MagentaString("[~]"), msg)
+	FprintDebug(os.Stdout, msg)
 }
 
 // PrintWarning prints a warning message
 func PrintWarning(msg string) {
-	fmt.Printf("%s %s\n", color.YellowString("[w]"), msg)
+	FprintWarning(os.Stdout, msg)
+}
+
+// FprintSuccess writes a success message to w
+func FprintSuccess(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%s %s\n", color.GreenString("[+]"), msg)
+}
+
+// FprintError writes an error message to w
+func FprintError(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%s %s\n", color.RedString("[!]"), msg)
+}
+
+// FprintInfo writes an info message to w
+func FprintInfo(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%s %s\n", color.YellowString("[*]"), msg)
+}
+
+// FprintDebug writes a debug message to w
+func FprintDebug(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%s %s\n", color.MagentaString("[~]"), msg)
+}
+
+// FprintWarning writes a warning message to w
+func FprintWarning(w io.Writer, msg string) {
+	fmt.Fprintf(w, "%s %s\n", color.YellowString("[w]"), msg)
 }
 
 // CenterText centers text within a width
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OptionError describes a single argument that failed validation
+type OptionError struct {
+	Option  string
+	Value   string
+	Message string
+}
+
+// Error implements the error interface
+func (e OptionError) Error() string {
+	return fmt.Sprintf("%s=%q: %s", e.Option, e.Value, e.Message)
+}
+
+// ValidationError collects every problem found with a module's arguments
+type ValidationError struct {
+	Module  string
+	Missing []string      // required options without a value
+	Invalid []OptionError // options whose value doesn't match the declared type
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing required argument(s): "+strings.Join(e.Missing, ", "))
+	}
+	for _, inv := range e.Invalid {
+		parts = append(parts, inv.Error())
+	}
+	return fmt.Sprintf("invalid arguments for module '%s': %s", e.Module, strings.Join(parts, "; "))
+}
+
+// ValidateArguments applies option defaults and checks every declared option against its type.
+// Values are normalised in place (bools become "true"/"false", file paths are made absolute).
+// Relative file paths are resolved against dir, the working directory of the session;
+// an empty dir means the process's. It returns a *ValidationError listing each missing
+// or invalid option, or nil.
+func ValidateArguments(moduleName string, meta *ModuleMetadata, args map[string]string, dir string) error {
+	if meta == nil {
+		return nil
+	}
+
+	verr := &ValidationError{Module: moduleName}
+
+	// Defaults first, so a required option with a default is satisfied
+	for name, opt := range meta.Options {
+		if _, ok := args[name]; !ok && opt.Default != "" {
+			args[name] = opt.Default
+		}
+	}
+
+	required := make(map[string]bool)
+	for _, name := range meta.Required {
+		required[name] = true
+	}
+	for name, opt := range meta.Options {
+		if opt.Required {
+			required[name] = true
+		}
+	}
+	for name := range required {
+		if _, ok := args[name]; !ok {
+			verr.Missing = append(verr.Missing, name)
+		}
+	}
+	sort.Strings(verr.Missing)
+
+	names := make([]string, 0, len(meta.Options))
+	for name := range meta.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := args[name]
+		if !ok {
+			continue
+		}
+		normalised, err := validateOptionValue(meta.Options[name], value, dir)
+		if err != nil {
+			verr.Invalid = append(verr.Invalid, OptionError{Option: name, Value: value, Message: err.Error()})
+			continue
+		}
+		args[name] = normalised
+	}
+
+	if len(verr.Missing) == 0 && len(verr.Invalid) == 0 {
+		return nil
+	}
+	return verr
+}
+
+// ValidateOption checks and normalises the value of one option as ValidateArguments does,
+// for a run that validated the others already. Undeclared options are returned as is.
+func ValidateOption(meta *ModuleMetadata, name, value, dir string) (string, error) {
+	if meta == nil {
+		return value, nil
+	}
+	opt, ok := meta.Options[name]
+	if !ok {
+		return value, nil
+	}
+	normalised, err := validateOptionValue(opt, value, dir)
+	if err != nil {
+		return "", OptionError{Option: name, Value: value, Message: err.Error()}
+	}
+	return normalised, nil
+}
+
+// validateOptionValue checks a value against the option's declared type and returns its
+// normalised form. Relative file paths are taken relative to dir.
+func validateOptionValue(opt OptionMeta, value, dir string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(opt.Type)) {
+	case "", "string", "secret":
+		return value, nil
+
+	case "int", "integer":
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("expected an integer")
+		}
+		if err := checkRange(n, opt.Min, opt.Max); err != nil {
+			return "", err
+		}
+		return strconv.Itoa(n), nil
+
+	case "bool", "boolean":
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "1", "true", "yes", "y", "on":
+			return "true", nil
+		case "0", "false", "no", "n", "off":
+			return "false", nil
+		}
+		return "", fmt.Errorf("expected a boolean (true/false, yes/no, 1/0, on/off)")
+
+	case "file":
+		// The module runs in its own directory, so a relative path must not reach it as is
+		path := expandHome(value)
+		if !filepath.IsAbs(path) && dir != "" {
+			path = filepath.Join(dir, path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("file does not exist")
+		}
+		if info.IsDir() {
+			return "", fmt.Errorf("expected a file, got a directory")
+		}
+		return path, nil
+
+	case "ip":
+		if net.ParseIP(strings.TrimSpace(value)) == nil {
+			return "", fmt.Errorf("expected an IPv4 or IPv6 address")
+		}
+		return strings.TrimSpace(value), nil
+
+	case "cidr":
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(value)); err != nil {
+			return "", fmt.Errorf("expected a CIDR block, e.g. 10.0.0.0/24")
+		}
+		return strings.TrimSpace(value), nil
+
+	case "port":
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("expected a port number between 1 and 65535")
+		}
+		if err := checkRange(n, opt.Min, opt.Max); err != nil {
+			return "", err
+		}
+		return strconv.Itoa(n), nil
+
+	case "url":
+		u, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", fmt.Errorf("expected an absolute URL, e.g. https://example.com")
+		}
+		return strings.TrimSpace(value), nil
+
+	case "enum":
+		for _, choice := range opt.Choices {
+			if value == choice {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of: %s", strings.Join(opt.Choices, ", "))
+
+	case "regex":
+		if opt.Pattern == "" {
+			return value, nil
+		}
+		re, err := regexp.Compile("^(?:" + opt.Pattern + ")$")
+		if err != nil {
+			return "", fmt.Errorf("module declares an invalid pattern %q: %v", opt.Pattern, err)
+		}
+		if !re.MatchString(value) {
+			return "", fmt.Errorf("does not match pattern %s", opt.Pattern)
+		}
+		return value, nil
+
+	default:
+		// Unknown types are passed through untouched
+		return value, nil
+	}
+}
+
+// IsSecret reports whether the option holds a secret such as a password or an API key,
+// whose value must not be shown or stored
+func (opt OptionMeta) IsSecret() bool {
+	return strings.EqualFold(strings.TrimSpace(opt.Type), "secret")
+}
+
+// checkRange enforces the optional min/max bounds of a numeric option
+func checkRange(n int, min, max *int) error {
+	if min != nil && n < *min {
+		return fmt.Errorf("must be >= %d", *min)
+	}
+	if max != nil && n > *max {
+		return fmt.Errorf("must be <= %d", *max)
+	}
+	return nil
+}
+
+// expandHome expands a leading ~/ to the user's home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
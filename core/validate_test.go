@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	dir := t.TempDir()
+	wordlist := filepath.Join(dir, "words.txt")
+	if err := os.WriteFile(wordlist, []byte("admin\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Relative paths are resolved against the session directory, not the process's
+	t.Chdir(t.TempDir())
+
+	one, ten := 1, 10
+	meta := &ModuleMetadata{
+		Options: map[string]OptionMeta{
+			"host":    {Type: "ip", Required: true},
+			"threads": {Type: "int", Default: "4", Min: &one, Max: &ten},
+			"verbose": {Type: "bool"},
+			"port":    {Type: "port"},
+			"net":     {Type: "cidr"},
+			"url":     {Type: "url"},
+			"mode":    {Type: "enum", Choices: []string{"fast", "slow"}},
+			"user":    {Type: "regex", Pattern: "[a-z]+"},
+			"list":    {Type: "file"},
+			"note":    {Type: "string"},
+		},
+		Required: []string{"note"},
+	}
+
+	tests := []struct {
+		name        string
+		args        map[string]string
+		want        map[string]string // normalised arguments, when valid
+		wantMissing []string
+		wantInvalid []string
+	}{
+		{
+			name: "defaults and normalisation",
+			args: map[string]string{"host": "10.0.0.1", "note": "x", "verbose": "yes", "list": "words.txt"},
+			want: map[string]string{"host": "10.0.0.1", "note": "x", "verbose": "true", "list": wordlist, "threads": "4"},
+		},
+		{
+			name: "every type valid",
+			args: map[string]string{
+				"host": "::1", "note": "x", "threads": " 10 ", "port": "443", "net": "10.0.0.0/24",
+				"url": "https://example.com", "mode": "slow", "user": "bob", "verbose": "off",
+			},
+			want: map[string]string{
+				"host": "::1", "note": "x", "threads": "10", "port": "443", "net": "10.0.0.0/24",
+				"url": "https://example.com", "mode": "slow", "user": "bob", "verbose": "false",
+			},
+		},
+		{
+			name:        "missing required",
+			args:        map[string]string{},
+			wantMissing: []string{"host", "note"},
+		},
+		{
+			name: "invalid values",
+			args: map[string]string{
+				"host": "10.0.0.300", "note": "x", "threads": "11", "port": "70000", "net": "10.0.0.0",
+				"url": "example.com", "mode": "medium", "user": "Bob1", "verbose": "maybe", "list": "missing.txt",
+			},
+			wantInvalid: []string{"host", "list", "mode", "net", "port", "threads", "url", "user", "verbose"},
+		},
+		{
+			name: "absolute file",
+			args: map[string]string{"host": "10.0.0.1", "note": "x", "list": wordlist},
+			want: map[string]string{"host": "10.0.0.1", "note": "x", "list": wordlist, "threads": "4"},
+		},
+		{
+			name:        "directory for a file",
+			args:        map[string]string{"host": "10.0.0.1", "note": "x", "list": dir},
+			wantInvalid: []string{"list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateArguments("test", meta, tt.args, dir)
+			if tt.wantMissing == nil && tt.wantInvalid == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tt.args, tt.want) {
+					t.Errorf("arguments = %v, want %v", tt.args, tt.want)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("error = %v, want a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(verr.Missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", verr.Missing, tt.wantMissing)
+			}
+			var invalid []string
+			for _, inv := range verr.Invalid {
+				invalid = append(invalid, inv.Option)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("invalid = %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestValidateArgumentsWithoutMetadata(t *testing.T) {
+	args := map[string]string{"anything": "goes"}
+	if err := ValidateArguments("test", nil, args, ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// venvReadyMarker is written into a venv once its requirements are installed
+const venvReadyMarker = ".lmv-ready"
+
+// PythonConfig is the python: section of module.yaml
+type PythonConfig struct {
+	Requirements []string `yaml:"requirements"` // pip requirement specifiers, e.g. requests>=2.28
+}
+
+// venvCacheDir returns the directory holding the Python virtualenvs of modules
+func venvCacheDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "venvs")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "venvs")
+}
+
+// venvCacheName is the venv directory prefix of a module
+func venvCacheName(module *ModuleConfig) string {
+	return strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(module.Name)
+}
+
+// HasPythonRequirements reports whether a Python module has a requirements.txt or a
+// python.requirements list, and so runs in its own virtualenv
+func HasPythonRequirements(module *ModuleConfig) bool {
+	if module.Type != "python" {
+		return false
+	}
+	if module.Metadata != nil && module.Metadata.Python != nil && len(module.Metadata.Python.Requirements) > 0 {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(module.Path, "requirements.txt"))
+	return err == nil
+}
+
+// VenvPath returns the virtualenv directory for the module's current requirements,
+// whether or not it has been built yet. A change to the requirements gives a new path.
+func VenvPath(module *ModuleConfig) (string, error) {
+	h := sha256.New()
+	if data, err := os.ReadFile(filepath.Join(module.Path, "requirements.txt")); err == nil {
+		h.Write(data)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read requirements.txt: %v", err)
+	}
+	if module.Metadata != nil && module.Metadata.Python != nil {
+		for _, req := range module.Metadata.Python.Requirements {
+			fmt.Fprintf(h, "\x00%s", req)
+		}
+	}
+	hash := hex.EncodeToString(h.Sum(nil))[:16]
+	return filepath.Join(venvCacheDir(), venvCacheName(module)+"-"+hash), nil
+}
+
+// VenvReady reports whether the virtualenv at path has its requirements installed
+func VenvReady(path string) bool {
+	_, err := os.Stat(filepath.Join(path, venvReadyMarker))
+	return err == nil
+}
+
+// venvPython returns the interpreter of a virtualenv
+func venvPython(path string) string {
+	return filepath.Join(path, "bin", "python")
+}
+
+// venvBuilt reports whether the virtualenv for the module's current requirements is ready
+func venvBuilt(module *ModuleConfig) bool {
+	path, err := VenvPath(module)
+	return err == nil && VenvReady(path)
+}
+
+// pythonInterpreter returns the interpreter a Python module runs with: its virtualenv's
+// when it has requirements and the venv is built, its configured interpreter otherwise
+func (mm *ModuleManager) pythonInterpreter(module *ModuleConfig) []string {
+	if HasPythonRequirements(module) {
+		if path, err := VenvPath(module); err == nil && VenvReady(path) {
+			return []string{venvPython(path)}
+		}
+	}
+	if module.Type != "python" {
+		return []string{"python3"}
+	}
+	return mm.interpreterFor(module)
+}
+
+// EnsureVenv creates the module's virtualenv and installs its requirements, unless a
+// venv for the same requirements is already built - then nothing touches the network.
+// pip output goes to log, or is only reported on failure when log is nil.
+// It returns the venv path, "" for modules without requirements.
+func (mm *ModuleManager) EnsureVenv(ctx context.Context, module *ModuleConfig, log io.Writer) (string, error) {
+	if !HasPythonRequirements(module) {
+		return "", nil
+	}
+	path, err := VenvPath(module)
+	if err != nil {
+		return "", err
+	}
+
+	mm.venvMu.Lock()
+	defer mm.venvMu.Unlock()
+
+	if VenvReady(path) {
+		return path, nil
+	}
+	// The venv is created by the module's interpreter, so pypy3 modules get a pypy3 venv
+	base := mm.interpreterFor(module)
+	if _, err := exec.LookPath(base[0]); err != nil {
+		return "", fmt.Errorf("%s not found in PATH, required to create the virtualenv", base[0])
+	}
+
+	// A venv without the marker is a failed or interrupted install: start over
+	os.RemoveAll(path)
+	if err := os.MkdirAll(venvCacheDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create venv cache: %v", err)
+	}
+
+	var output bytes.Buffer
+	if log == nil {
+		log = &output
+	} else {
+		fmt.Fprintf(log, "%s Installing the requirements of '%s' into %s...\n", Color("yellow", "[*]"), Color("cyan", module.Name), path)
+	}
+	install := []string{venvPython(path), "-m", "pip", "install", "--disable-pip-version-check"}
+	if _, err := os.Stat(filepath.Join(module.Path, "requirements.txt")); err == nil {
+		install = append(install, "-r", "requirements.txt")
+	}
+	if module.Metadata != nil && module.Metadata.Python != nil {
+		install = append(install, module.Metadata.Python.Requirements...)
+	}
+	steps := []struct {
+		name string
+		args []string
+	}{
+		{base[0] + " -m venv", append(append([]string{}, base...), "-m", "venv", path)},
+		{"pip install", install},
+	}
+
+	for _, step := range steps {
+		cmd := exec.CommandContext(ctx, step.args[0], step.args[1:]...)
+		cmd.Dir = module.Path // requirements.txt may refer to files next to it
+		cmd.Stdout, cmd.Stderr = log, log
+		if err := cmd.Run(); err != nil {
+			os.RemoveAll(path)
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			if tail := strings.TrimSpace(lines[len(lines)-1]); tail != "" {
+				return "", fmt.Errorf("%s failed: %v: %s", step.name, err, tail)
+			}
+			return "", fmt.Errorf("%s failed: %v", step.name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(path, venvReadyMarker), nil, 0644); err != nil {
+		return "", fmt.Errorf("failed to mark the venv as ready: %v", err)
+	}
+
+	// Drop venvs built for older requirements
+	mm.removeVenvs(module, path)
+	return path, nil
+}
+
+// RebuildVenv removes the module's current virtualenv and builds it again
+func (mm *ModuleManager) RebuildVenv(ctx context.Context, module *ModuleConfig, log io.Writer) (string, error) {
+	if path, err := VenvPath(module); err == nil {
+		mm.venvMu.Lock()
+		os.RemoveAll(path)
+		mm.venvMu.Unlock()
+	}
+	return mm.EnsureVenv(ctx, module, log)
+}
+
+// CleanVenvs removes every virtualenv of the module and returns how many there were
+func (mm *ModuleManager) CleanVenvs(module *ModuleConfig) int {
+	mm.venvMu.Lock()
+	defer mm.venvMu.Unlock()
+	return mm.removeVenvs(module, "")
+}
+
+// removeVenvs removes the module's virtualenvs except keep
+func (mm *ModuleManager) removeVenvs(module *ModuleConfig, keep string) int {
+	venvs, _ := filepath.Glob(filepath.Join(venvCacheDir(), venvCacheName(module)+"-"+strings.Repeat("?", 16)))
+	removed := 0
+	for _, path := range venvs {
+		if path != keep && os.RemoveAll(path) == nil {
+			removed++
+		}
+	}
+	return removed
+}
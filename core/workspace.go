@@ -0,0 +1,473 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names inside a workspace database
+var (
+	bucketRuns     = []byte("runs")
+	bucketFindings = []byte("findings")
+	bucketHosts    = []byte("hosts")
+	bucketServices = []byte("services")
+)
+
+// validWorkspaceName restricts workspace names to safe file names
+var validWorkspaceName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// RunRecord is a module execution stored in a workspace
+type RunRecord struct {
+	ID        uint64            `json:"id"`
+	Module    string            `json:"module"`
+	Args      map[string]string `json:"args"`
+	Started   time.Time         `json:"started"`
+	Duration  time.Duration     `json:"duration"`
+	ExitCode  int               `json:"exit_code"`
+	Success   bool              `json:"success"`
+	Cancelled bool              `json:"cancelled,omitempty"`
+	Output    string            `json:"output,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Outputs   map[string]string `json:"outputs,omitempty"`
+}
+
+// FindingRecord is a structured finding stored in a workspace
+type FindingRecord struct {
+	ID     uint64    `json:"id"`
+	RunID  uint64    `json:"run_id"`
+	Module string    `json:"module"`
+	Time   time.Time `json:"time"`
+	Finding
+}
+
+// HostRecord is a host seen in at least one finding
+type HostRecord struct {
+	Address   string    `json:"address"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Modules   []string  `json:"modules"`
+	Findings  int       `json:"findings"`
+}
+
+// ServiceRecord is a host/port pair seen in at least one finding
+type ServiceRecord struct {
+	Host     string    `json:"host"`
+	Port     int       `json:"port"`
+	Protocol string    `json:"protocol,omitempty"`
+	Service  string    `json:"service,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Workspace is a persistent store of module runs, hosts, services and findings. Its
+// database is only open while a run is recorded or a query reads it, so several
+// sessions can share a workspace.
+type Workspace struct {
+	Name string
+	Path string
+}
+
+// WorkspacesDir returns the directory holding all workspace databases
+func WorkspacesDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "workspaces")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "workspaces")
+}
+
+// workspacePath returns the database file of a workspace
+func workspacePath(name string) string {
+	return filepath.Join(WorkspacesDir(), name+".db")
+}
+
+// WorkspaceExists reports whether a workspace database exists
+func WorkspaceExists(name string) bool {
+	_, err := os.Stat(workspacePath(name))
+	return err == nil
+}
+
+// ListWorkspaces returns the names of all workspaces, sorted
+func ListWorkspaces() ([]string, error) {
+	entries, err := os.ReadDir(WorkspacesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".db") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".db"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OpenWorkspace opens a workspace, creating it if it doesn't exist yet
+func OpenWorkspace(name string) (*Workspace, error) {
+	if !validWorkspaceName.MatchString(name) {
+		return nil, fmt.Errorf("invalid workspace name '%s', use letters, digits, '.', '_' and '-'", name)
+	}
+	if err := os.MkdirAll(WorkspacesDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create workspaces directory: %v", err)
+	}
+
+	w := &Workspace{Name: name, Path: workspacePath(name)}
+	db, err := w.open(false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketRuns, bucketFindings, bucketHosts, bucketServices} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise workspace '%s': %v", name, err)
+	}
+	return w, nil
+}
+
+// open opens the database, read-only databases share their lock with other readers.
+// Another session holds it only while it records or reads, so waiting is brief.
+func (w *Workspace) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(w.Path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		if err == bolt.ErrTimeout {
+			return nil, fmt.Errorf("workspace '%s' is busy in another session", w.Name)
+		}
+		return nil, fmt.Errorf("failed to open workspace '%s': %v", w.Name, err)
+	}
+	return db, nil
+}
+
+// update runs fn in a read-write transaction
+func (w *Workspace) update(fn func(tx *bolt.Tx) error) error {
+	db, err := w.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+// view runs fn in a read-only transaction
+func (w *Workspace) view(fn func(tx *bolt.Tx) error) error {
+	db, err := w.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// DeleteWorkspace removes a workspace database
+func DeleteWorkspace(name string) error {
+	if !validWorkspaceName.MatchString(name) {
+		return fmt.Errorf("invalid workspace name '%s'", name)
+	}
+	if err := os.Remove(workspacePath(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("workspace '%s' does not exist", name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close releases the workspace. The database is only open during an operation, so
+// there is nothing left to close.
+func (w *Workspace) Close() error {
+	return nil
+}
+
+// RecordRun stores a module execution together with its findings, and
+// updates the hosts and services seen in those findings
+func (w *Workspace) RecordRun(moduleName string, args map[string]string, result *ExecutionResult, duration time.Duration) (*RunRecord, error) {
+	run := &RunRecord{
+		Module:    moduleName,
+		Args:      args,
+		Started:   result.Timestamp,
+		Duration:  duration,
+		ExitCode:  result.ExitCode,
+		Success:   result.Success,
+		Cancelled: result.Cancelled,
+		Output:    result.Output,
+		Error:     result.Error,
+		Outputs:   result.Outputs,
+	}
+	if run.Started.IsZero() {
+		run.Started = time.Now().Add(-duration)
+	}
+
+	err := w.update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(bucketRuns)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+		if err := putJSON(runs, itob(id), run); err != nil {
+			return err
+		}
+
+		findings := tx.Bucket(bucketFindings)
+		for _, f := range result.Findings {
+			fid, err := findings.NextSequence()
+			if err != nil {
+				return err
+			}
+			record := FindingRecord{ID: fid, RunID: id, Module: moduleName, Time: time.Now(), Finding: f}
+			if err := putJSON(findings, itob(fid), record); err != nil {
+				return err
+			}
+			if err := w.trackHost(tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record run: %v", err)
+	}
+	return run, nil
+}
+
+// trackHost updates the host and service tables from a finding
+func (w *Workspace) trackHost(tx *bolt.Tx, f FindingRecord) error {
+	if f.Host == "" {
+		return nil
+	}
+
+	hosts := tx.Bucket(bucketHosts)
+	var host HostRecord
+	if data := hosts.Get([]byte(f.Host)); data != nil {
+		if err := json.Unmarshal(data, &host); err != nil {
+			return err
+		}
+	} else {
+		host = HostRecord{Address: f.Host, FirstSeen: f.Time}
+	}
+	host.LastSeen = f.Time
+	host.Findings++
+	if !containsString(host.Modules, f.Module) {
+		host.Modules = append(host.Modules, f.Module)
+	}
+	if err := putJSON(hosts, []byte(f.Host), host); err != nil {
+		return err
+	}
+
+	if f.Port <= 0 {
+		return nil
+	}
+	services := tx.Bucket(bucketServices)
+	key := []byte(fmt.Sprintf("%s|%d|%s", f.Host, f.Port, f.Protocol))
+	var svc ServiceRecord
+	if data := services.Get(key); data != nil {
+		if err := json.Unmarshal(data, &svc); err != nil {
+			return err
+		}
+	} else {
+		svc = ServiceRecord{Host: f.Host, Port: f.Port, Protocol: f.Protocol}
+	}
+	if f.Service != "" {
+		svc.Service = f.Service
+	}
+	svc.LastSeen = f.Time
+	return putJSON(services, key, svc)
+}
+
+// Runs returns all recorded runs, oldest first
+func (w *Workspace) Runs() ([]RunRecord, error) {
+	var runs []RunRecord
+	err := w.each(bucketRuns, func(data []byte) error {
+		var r RunRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		runs = append(runs, r)
+		return nil
+	})
+	return runs, err
+}
+
+// Run returns a single run by ID
+func (w *Workspace) Run(id uint64) (*RunRecord, error) {
+	var run *RunRecord
+	err := w.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketRuns).Get(itob(id))
+		if data == nil {
+			return fmt.Errorf("run %d not found", id)
+		}
+		run = &RunRecord{}
+		return json.Unmarshal(data, run)
+	})
+	return run, err
+}
+
+// Findings returns all recorded findings, oldest first
+func (w *Workspace) Findings() ([]FindingRecord, error) {
+	var findings []FindingRecord
+	err := w.each(bucketFindings, func(data []byte) error {
+		var f FindingRecord
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		findings = append(findings, f)
+		return nil
+	})
+	return findings, err
+}
+
+// Hosts returns all known hosts, sorted by address
+func (w *Workspace) Hosts() ([]HostRecord, error) {
+	var hosts []HostRecord
+	err := w.each(bucketHosts, func(data []byte) error {
+		var h HostRecord
+		if err := json.Unmarshal(data, &h); err != nil {
+			return err
+		}
+		hosts = append(hosts, h)
+		return nil
+	})
+	return hosts, err
+}
+
+// Services returns all known services, sorted by host then port
+func (w *Workspace) Services() ([]ServiceRecord, error) {
+	var services []ServiceRecord
+	err := w.each(bucketServices, func(data []byte) error {
+		var s ServiceRecord
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		services = append(services, s)
+		return nil
+	})
+	sort.SliceStable(services, func(i, j int) bool {
+		if services[i].Host != services[j].Host {
+			return services[i].Host < services[j].Host
+		}
+		return services[i].Port < services[j].Port
+	})
+	return services, err
+}
+
+// each calls fn for every value of a bucket in key order
+func (w *Workspace) each(bucket []byte, fn func(data []byte) error) error {
+	return w.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, v []byte) error {
+			return fn(v)
+		})
+	})
+}
+
+// putJSON stores v as JSON under key
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// itob encodes a sequence number as a sortable big-endian key
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Row returns the record as column name -> display value, used for filtering and export
+func (r RunRecord) Row() map[string]string {
+	status := "ok"
+	if r.Cancelled {
+		status = "cancelled"
+	} else if !r.Success {
+		status = "failed"
+	}
+	args := make([]string, 0, len(r.Args))
+	for k, v := range r.Args {
+		args = append(args, k+"="+v)
+	}
+	sort.Strings(args)
+	return map[string]string{
+		"id":       strconv.FormatUint(r.ID, 10),
+		"module":   r.Module,
+		"started":  r.Started.Format("2006-01-02 15:04:05"),
+		"duration": r.Duration.Round(time.Millisecond).String(),
+		"exit":     strconv.Itoa(r.ExitCode),
+		"status":   status,
+		"args":     strings.Join(args, " "),
+	}
+}
+
+// Row returns the record as column name -> display value, used for filtering and export
+func (f FindingRecord) Row() map[string]string {
+	port := ""
+	if f.Port > 0 {
+		port = strconv.Itoa(f.Port)
+	}
+	return map[string]string{
+		"id":       strconv.FormatUint(f.ID, 10),
+		"run":      strconv.FormatUint(f.RunID, 10),
+		"module":   f.Module,
+		"host":     f.Host,
+		"port":     port,
+		"protocol": f.Protocol,
+		"service":  f.Service,
+		"severity": f.Severity,
+		"title":    f.Title,
+		"detail":   f.Detail,
+	}
+}
+
+// Row returns the record as column name -> display value, used for filtering and export
+func (h HostRecord) Row() map[string]string {
+	return map[string]string{
+		"address":    h.Address,
+		"first_seen": h.FirstSeen.Format("2006-01-02 15:04:05"),
+		"last_seen":  h.LastSeen.Format("2006-01-02 15:04:05"),
+		"modules":    strings.Join(h.Modules, ","),
+		"findings":   strconv.Itoa(h.Findings),
+	}
+}
+
+// Row returns the record as column name -> display value, used for filtering and export
+func (s ServiceRecord) Row() map[string]string {
+	return map[string]string{
+		"host":      s.Host,
+		"port":      strconv.Itoa(s.Port),
+		"protocol":  s.Protocol,
+		"service":   s.Service,
+		"last_seen": s.LastSeen.Format("2006-01-02 15:04:05"),
+	}
+}
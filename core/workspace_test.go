@@ -0,0 +1,140 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceRecordRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	ws, err := OpenWorkspace("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	results := []*ExecutionResult{
+		{Success: true, Output: "scanned", Findings: []Finding{
+			{Host: "10.0.0.1", Port: 22, Protocol: "tcp", Service: "ssh"},
+			{Host: "10.0.0.1", Port: 80, Protocol: "tcp"},
+			{Host: "10.0.0.2", Title: "ping reply"},
+		}},
+		{Success: false, ExitCode: 2, Error: "boom", Findings: []Finding{
+			{Host: "10.0.0.1", Port: 80, Protocol: "tcp", Service: "http"},
+		}},
+	}
+	for _, result := range results {
+		if _, err := ws.RecordRun("portscan", map[string]string{"host": "10.0.0.0/30"}, result, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := ws.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != 1 || !runs[0].Success || runs[1].ExitCode != 2 || runs[1].Error != "boom" {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if !reflect.DeepEqual(runs[0].Args, map[string]string{"host": "10.0.0.0/30"}) {
+		t.Errorf("args = %v", runs[0].Args)
+	}
+	if run, err := ws.Run(2); err != nil || run.ExitCode != 2 {
+		t.Errorf("Run(2) = %+v, %v", run, err)
+	}
+	if _, err := ws.Run(3); err == nil {
+		t.Error("Run(3) of a workspace with 2 runs succeeded")
+	}
+
+	findings, err := ws.Findings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 4 || findings[3].RunID != 2 || findings[3].Module != "portscan" {
+		t.Errorf("findings = %+v", findings)
+	}
+
+	hosts, err := ws.Hosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0].Address != "10.0.0.1" || hosts[0].Findings != 3 || hosts[1].Findings != 1 {
+		t.Errorf("hosts = %+v", hosts)
+	}
+
+	services, err := ws.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range services {
+		got = append(got, s.Row()["port"]+"/"+s.Service)
+	}
+	// The later finding names the service on port 80
+	if want := []string{"22/ssh", "80/http"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("services = %v, want %v", got, want)
+	}
+}
+
+func TestWorkspaceNames(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, name := range []string{"", "../escape", "a b"} {
+		if ws, err := OpenWorkspace(name); err == nil {
+			ws.Close()
+			t.Errorf("OpenWorkspace(%q) succeeded", name)
+		}
+	}
+
+	for _, name := range []string{"beta", "alpha"} {
+		ws, err := OpenWorkspace(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws.Close()
+	}
+	if names, err := ListWorkspaces(); err != nil || !reflect.DeepEqual(names, []string{"alpha", "beta"}) {
+		t.Errorf("ListWorkspaces() = %v, %v", names, err)
+	}
+	if err := DeleteWorkspace("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if WorkspaceExists("alpha") || !WorkspaceExists("beta") {
+		t.Error("DeleteWorkspace removed the wrong workspace")
+	}
+	if err := DeleteWorkspace("alpha"); err == nil {
+		t.Error("deleting a missing workspace succeeded")
+	}
+}
+
+func TestWorkspaceShared(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Two sessions on the same workspace both record, without waiting on each other
+	first, err := OpenWorkspace("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := OpenWorkspace("shared")
+	if err != nil {
+		t.Fatalf("second session: %v", err)
+	}
+	defer second.Close()
+
+	started := time.Now()
+	for _, ws := range []*Workspace{first, second, first} {
+		if _, err := ws.RecordRun("ping", nil, &ExecutionResult{Success: true}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("recording took %s, a session waited for the other's lock", elapsed)
+	}
+	runs, err := second.Runs()
+	if err != nil || len(runs) != 3 {
+		t.Errorf("runs = %d (%v), want the 3 runs of both sessions", len(runs), err)
+	}
+}
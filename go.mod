@@ -7,11 +7,12 @@ toolchain go1.24.9
 require (
 	github.com/chzyer/readline v1.5.1 // or latest version you want
 	github.com/fatih/color v1.18.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/sys v0.40.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.40.0 // indirect
 )
@@ -1,10 +1,10 @@
 import argparse
+import json
 import os
 import subprocess
 import shutil
 import glob
 import sys
-import yaml
 ## lmv_module.py : author : hmza
 
 HOME = os.path.expanduser("~")
@@ -13,12 +13,75 @@ MODULES_DIR = os.path.join(LANMANVAN_DIR, "modules")
 REPO_FILE = os.path.join(LANMANVAN_DIR, "repo_url.yaml")
 
 def load_repos():
+    import yaml  # only the module manager needs PyYAML, not modules emitting results
     if os.path.exists(REPO_FILE):
         with open(REPO_FILE, "r") as f:
             repos = yaml.safe_load(f) or {}
         return repos
     return {}
 
+# ── Structured results ─────────────────────────────────────────────────────────
+# Modules can report machine-readable results that lmv collects into the run's
+# findings, artifacts, progress and outputs. From a Python module:
+#
+#   import os, sys
+#   sys.path.insert(0, os.path.expanduser("~/lanmanvan"))
+#   from lmv_module import emit_finding, emit_progress
+#
+#   emit_progress(40, "scanning")
+#   emit_finding(host="10.0.0.5", port=22, service="ssh", severity="info")
+#
+# Records go to the descriptor in LMV_RESULT_FD, or to the file in
+# LMV_RESULT_FILE when the descriptor isn't usable (e.g. under sudo).
+# Outside of lmv both are unset and the helpers do nothing.
+
+def emit(record_type, **fields):
+    """Emit one structured result record of the given type"""
+    record = dict(fields)
+    record["type"] = record_type
+    line = (json.dumps(record, default=str) + "\n").encode()
+
+    fd = os.environ.get("LMV_RESULT_FD")
+    if fd:
+        try:
+            os.write(int(fd), line)
+            return
+        except (OSError, ValueError):
+            pass
+
+    path = os.environ.get("LMV_RESULT_FILE")
+    if path:
+        with open(path, "ab") as f:
+            f.write(line)
+
+def emit_finding(host=None, port=None, **fields):
+    """Report a finding, e.g. emit_finding(host="10.0.0.5", port=22, service="ssh")"""
+    if host is not None:
+        fields["host"] = host
+    if port is not None:
+        fields["port"] = port
+    emit("finding", **fields)
+
+def emit_artifact(path, description=None, name=None):
+    """Report a file produced by the module"""
+    fields = {"path": os.path.abspath(path)}
+    if description:
+        fields["description"] = description
+    if name:
+        fields["name"] = name
+    emit("artifact", **fields)
+
+def emit_progress(pct, message=None):
+    """Report progress as a percentage (0-100)"""
+    fields = {"pct": pct}
+    if message:
+        fields["message"] = message
+    emit("progress", **fields)
+
+def emit_output(key, value):
+    """Report a key/value output"""
+    emit("output", key=key, value=value)
+
 def is_module_dir(path):
     """Check if a directory is a module directory"""
     # Check for module.yaml
@@ -8,13 +8,13 @@ import (
 	"strings"
 
 	"lanmanvan/cli"
+	"lanmanvan/core"
 )
 
 func main() {
 	var modulesDirs string
 	var version bool
-	var versionText string
-	versionText = "2.0"
+	versionText := core.Version
 
 	var exec bool
 	var exec_cmd string
@@ -36,7 +36,7 @@ func main() {
 	flag.Parse()
 
 	if version {
-		fmt.Printf("lmv-ng " + versionText + " - Advanced Modular Framework in Go ")
+		fmt.Printf("lmv-ng %s - Advanced Modular Framework in Go ", versionText)
 		os.Exit(0)
 	}
 
@@ -74,32 +74,11 @@ func main() {
 	bannerShown := false
 
 	if resourceFile != "" {
-		content, err := os.ReadFile(resourceFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		// The resource file is a .lmv script; its errors are already printed
+		if err := cliInstance.ScriptStart(show_banner, resourceFile); err != nil {
 			os.Exit(1)
 		}
-
-		lines := strings.Split(string(content), "\n")
-		var commands []string
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			commands = append(commands, line)
-		}
-
-		for _, cmd := range commands {
-			b := show_banner && !bannerShown
-			if err := cliInstance.IdleStart(b, cmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
-			if b {
-				bannerShown = true
-			}
-		}
+		bannerShown = show_banner
 	}
 
 	if exec {
@@ -0,0 +1,7 @@
+package main
+
+// Native modules are compiled into lmv: importing a package runs the sdk.Register
+// calls of its init functions. Add the packages of your own native modules here.
+import (
+	_ "lanmanvan/native"
+)
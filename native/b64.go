@@ -0,0 +1,68 @@
+// Package native holds the modules compiled into lmv. Each file registers one
+// module with sdk.Register; modules.go at the root links the package in.
+package native
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"lanmanvan/sdk"
+)
+
+// B64 encodes and decodes base64, its input option or stdin
+type B64 struct{}
+
+func init() {
+	sdk.Register(B64{})
+}
+
+// Metadata implements sdk.Module
+func (B64) Metadata() sdk.Metadata {
+	return sdk.Metadata{
+		Name:        "b64",
+		Description: "Base64 encode or decode input, or stdin",
+		Author:      "lanmanvan",
+		Version:     "1.0.0",
+		Tags:        []string{"encoding"},
+		Options: map[string]sdk.Option{
+			"input": {Type: "string", Description: "Data to encode or decode, stdin when empty"},
+			"mode":  {Type: "enum", Description: "encode or decode", Default: "encode", Choices: []string{"encode", "decode"}},
+			"url":   {Type: "bool", Description: "Use the URL-safe alphabet", Default: "false"},
+		},
+	}
+}
+
+// Run implements sdk.Module
+func (B64) Run(ctx context.Context, args sdk.Args, r sdk.Reporter) error {
+	data := []byte(args.Get("input"))
+	if _, ok := args["input"]; !ok {
+		var err error
+		if data, err = io.ReadAll(r.Stdin()); err != nil {
+			return err
+		}
+		data = bytes.TrimRight(data, "\r\n")
+	}
+
+	encoding := base64.StdEncoding
+	if args.Bool("url", false) {
+		encoding = base64.URLEncoding
+	}
+
+	var out string
+	if args.Get("mode") == "decode" {
+		decoded, err := encoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("invalid base64: %v", err)
+		}
+		out = string(decoded)
+	} else {
+		out = encoding.EncodeToString(data)
+	}
+
+	fmt.Fprintln(r.Stdout(), out)
+	return nil
+}
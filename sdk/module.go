@@ -0,0 +1,137 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Module is a native module: Go code compiled into lmv that runs in-process, without
+// fork/exec, which suits tiny modules run thousands of times in loops. Register it
+// from an init function and lmv lists it next to the directory modules:
+//
+//	func init() { sdk.Register(&Echo{}) }
+//
+//	func (e *Echo) Metadata() sdk.Metadata {
+//		return sdk.Metadata{Name: "echo", Description: "Prints its input"}
+//	}
+//
+//	func (e *Echo) Run(ctx context.Context, args sdk.Args, r sdk.Reporter) error {
+//		fmt.Fprintln(r.Stdout(), args.Get("input"))
+//		return nil
+//	}
+//
+// Run must return once ctx is done. Its output goes to the reporter's streams, its
+// results to the reporter; a non-nil error fails the run.
+type Module interface {
+	Metadata() Metadata
+	Run(ctx context.Context, args Args, r Reporter) error
+}
+
+// Metadata describes a native module, like module.yaml does for directory modules
+type Metadata struct {
+	Name        string
+	Description string
+	Author      string
+	Version     string
+	Tags        []string
+	Options     map[string]Option
+	Required    []string
+}
+
+// Option describes a module option, see the options: section of module.yaml
+type Option struct {
+	Type        string // string, int, bool, file, ip, cidr, port, url, enum, regex
+	Description string
+	Default     string
+	Required    bool
+	Choices     []string // allowed values for enum options
+	Pattern     string   // regular expression a regex option must fully match
+	Min         *int     // lower bound for int and port options
+	Max         *int     // upper bound for int and port options
+}
+
+// Args holds the validated arguments of a run, with defaults applied
+type Args map[string]string
+
+// Get returns an argument, "" when it is not set
+func (a Args) Get(name string) string {
+	return a[name]
+}
+
+// Int returns an integer argument, def when it is not set or not a number
+func (a Args) Int(name string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(a[name]))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Bool returns a boolean argument, def when it is not set
+func (a Args) Bool(name string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(a[name])) {
+	case "true", "yes", "1", "on":
+		return true
+	case "false", "no", "0", "off":
+		return false
+	}
+	return def
+}
+
+// Reporter connects a native module to its run: the streams a directory module would
+// get as stdin, stdout and stderr, and the structured results it would emit. Stdin
+// holds piped input only, it is empty rather than the terminal.
+type Reporter interface {
+	Stdin() io.Reader
+	Stdout() io.Writer
+	Stderr() io.Writer
+
+	Finding(fields F)
+	Artifact(path, description string)
+	Progress(pct int, message string)
+	Output(key, value string)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Module)
+)
+
+// Register makes a native module available to lmv under its metadata name. It panics
+// when the name is empty or already taken, as both are programming errors.
+func Register(m Module) {
+	name := m.Metadata().Name
+	if name == "" {
+		panic("sdk: Register of a module without a name")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("sdk: Register called twice for module %s", name))
+	}
+	registry[name] = m
+}
+
+// Modules returns the registered native modules, sorted by name
+func Modules() []Module {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	modules := make([]Module, len(names))
+	for i, name := range names {
+		modules[i] = registry[name]
+	}
+	return modules
+}
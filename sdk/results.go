@@ -0,0 +1,107 @@
+// Package sdk helps Go modules talk to the LanManVan framework.
+//
+// Modules report machine-readable results by emitting JSON line records,
+// which lmv collects into the run's findings, artifacts, progress and outputs:
+//
+//	sdk.Progress(40, "scanning")
+//	sdk.Finding(sdk.F{"host": "10.0.0.5", "port": 22, "service": "ssh"})
+//	sdk.Output("os", "Linux")
+//
+// Outside of lmv the helpers do nothing. lmv builds Go modules against its own
+// copy of this package, see the README for modules that have a go.mod.
+//
+// Native modules, compiled into lmv, implement Module instead and report
+// through their Reporter.
+package sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	// ResultFDEnv names the env var holding the result file descriptor number
+	ResultFDEnv = "LMV_RESULT_FD"
+	// ResultFileEnv names the env var holding the result file path
+	ResultFileEnv = "LMV_RESULT_FILE"
+)
+
+// F holds the fields of a record
+type F map[string]interface{}
+
+var (
+	emitMu   sync.Mutex
+	resultFD *os.File
+	fdOpened bool
+)
+
+// Emit writes one record of the given type. Records go to the descriptor in
+// LMV_RESULT_FD, or to the file in LMV_RESULT_FILE when the descriptor isn't usable.
+func Emit(recordType string, fields F) error {
+	record := make(F, len(fields)+1)
+	for k, v := range fields {
+		record[k] = v
+	}
+	record["type"] = recordType
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	emitMu.Lock()
+	defer emitMu.Unlock()
+
+	if !fdOpened {
+		fdOpened = true
+		if fd, err := strconv.Atoi(os.Getenv(ResultFDEnv)); err == nil && fd > 2 {
+			resultFD = os.NewFile(uintptr(fd), "lmv-result")
+		}
+	}
+	if resultFD != nil {
+		if _, err := resultFD.Write(line); err == nil {
+			return nil
+		}
+		resultFD = nil
+	}
+
+	path := os.Getenv(ResultFileEnv)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+// Finding reports a finding, well-known fields are host, port, protocol,
+// service, title, severity and detail; any other field is kept as extra data
+func Finding(fields F) error {
+	return Emit("finding", fields)
+}
+
+// Artifact reports a file produced by the module
+func Artifact(path, description string) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return Emit("artifact", F{"path": path, "description": description})
+}
+
+// Progress reports progress as a percentage (0-100)
+func Progress(pct int, message string) error {
+	return Emit("progress", F{"pct": pct, "message": message})
+}
+
+// Output reports a key/value output
+func Output(key, value string) error {
+	return Emit("output", F{"key": key, "value": value})
+}
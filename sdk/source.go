@@ -0,0 +1,9 @@
+package sdk
+
+import "embed"
+
+// Source holds the files of this package. lmv writes them out next to a generated
+// go.mod, so Go modules can import lanmanvan/sdk without the lmv sources.
+//
+//go:embed *.go
+var Source embed.FS